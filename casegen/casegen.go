@@ -0,0 +1,548 @@
+// Package casegen generates connectivity test cases exercising every rule of a set of NetworkPolicies.
+//
+// For every policy, representative pods are synthesized out of the label selectors: pods selected and
+// not selected by the policy, pods matching every peer of every rule and pods just missing them (wrong
+// labels, wrong namespace). Cases are then generated on the ports of the rules and on a port that no rule
+// allows, and the expected verdict of every case is computed by kubepox.
+//
+// ipBlock peers are not exercised, as the address of a pod can't be chosen.
+package casegen
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aporeto-inc/kubepox"
+
+	api "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// Verdicts of a Case.
+const (
+	Allow = "allow"
+	Deny  = "deny"
+)
+
+// otherValue is used to build label values that a selector doesn't expect.
+const otherValue = "kubepox-other"
+
+// defaultPort is probed for rules that allow every port.
+const defaultPort = 80
+
+// ProbeLabel is set on every synthesized pod, so that the probe Service can select them.
+const ProbeLabel = "kubepox.io/probe"
+
+// firstNamedPort is the number given to the first named port found in the policies.
+const firstNamedPort = 8000
+
+// CaseList is the set of pods and cases generated for a set of policies.
+type CaseList struct {
+	Namespaces []Namespace `json:"namespaces"`
+	Pods       []Pod       `json:"pods"`
+	Cases      []Case      `json:"cases"`
+}
+
+// Namespace is a namespace needed by the cases.
+type Namespace struct {
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// Pod is a synthesized pod. Every pod listens on all the probed ports.
+type Pod struct {
+	Name      string              `json:"name"`
+	Namespace string              `json:"namespace"`
+	Labels    map[string]string   `json:"labels,omitempty"`
+	Ports     []api.ContainerPort `json:"ports,omitempty"`
+}
+
+// Case is a connection between two pods and the verdict expected from the policies.
+type Case struct {
+	From     string       `json:"from"`
+	To       string       `json:"to"`
+	Port     int32        `json:"port"`
+	Protocol api.Protocol `json:"protocol"`
+	Expect   string       `json:"expect"`
+	// Reason describes the path of the policies exercised by the case.
+	Reason string `json:"reason"`
+}
+
+// generator holds the state of a generation.
+type generator struct {
+	policies     *networking.NetworkPolicyList
+	namespaces   map[string]*api.Namespace
+	pods         map[string]*api.Pod
+	podKeys      map[string]string
+	namedPorts   map[string]api.ContainerPort
+	cases        map[string]*Case
+	caseOrder    []string
+	namespaceSeq int
+	podSeq       int
+	// outside is a namespace with no label.
+	outside string
+}
+
+// Generate generates the cases exercising every rule of the policies.
+// namespaces gives the labels of the existing namespaces, it can be nil.
+func Generate(allPolicies *networking.NetworkPolicyList, namespaces *api.NamespaceList) (*CaseList, error) {
+	g := &generator{
+		policies:   allPolicies,
+		namespaces: map[string]*api.Namespace{},
+		pods:       map[string]*api.Pod{},
+		podKeys:    map[string]string{},
+		namedPorts: map[string]api.ContainerPort{},
+		cases:      map[string]*Case{},
+	}
+
+	if namespaces != nil {
+		for i := range namespaces.Items {
+			namespace := namespaces.Items[i]
+			g.namespaces[namespace.Name] = &namespace
+		}
+	}
+	g.collectNamedPorts()
+
+	for i := range allPolicies.Items {
+		if err := g.policy(&allPolicies.Items[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return g.caseList()
+}
+
+// collectNamedPorts assigns a number to every named port of the rules, with the protocol of the rule naming it.
+// A pod can't declare a name twice: when rules name a port with several protocols, the first one is declared,
+// and the cases of the others are expected to be denied.
+func (g *generator) collectNamedPorts() {
+	names := map[string]api.Protocol{}
+	add := func(ports []networking.NetworkPolicyPort) {
+		for _, port := range ports {
+			if port.Port == nil || port.Port.Type != intstr.String {
+				continue
+			}
+			if _, ok := names[port.Port.StrVal]; ok {
+				continue
+			}
+			protocol := api.ProtocolTCP
+			if port.Protocol != nil {
+				protocol = *port.Protocol
+			}
+			names[port.Port.StrVal] = protocol
+		}
+	}
+	for _, policy := range g.policies.Items {
+		for _, rule := range policy.Spec.Ingress {
+			add(rule.Ports)
+		}
+		for _, rule := range policy.Spec.Egress {
+			add(rule.Ports)
+		}
+	}
+
+	sorted := []string{}
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	for i, name := range sorted {
+		g.namedPorts[name] = api.ContainerPort{
+			Name:          name,
+			ContainerPort: firstNamedPort + int32(i),
+			Protocol:      names[name],
+		}
+	}
+}
+
+// endpoint is a pod with the description of how it relates to the policy.
+type endpoint struct {
+	pod         *api.Pod
+	description string
+}
+
+// policy generates the cases of a policy.
+func (g *generator) policy(policy *networking.NetworkPolicy) error {
+	selected := g.pod(policy.Namespace, satisfyingLabels(&policy.Spec.PodSelector))
+	var notSelected *api.Pod
+	if labels, ok := violatingLabels(&policy.Spec.PodSelector); ok {
+		notSelected = g.pod(policy.Namespace, labels)
+	}
+	name := policy.Namespace + "/" + policy.Name
+
+	if kubepox.IsPolicyApplicableToIngress(policy) {
+		if len(policy.Spec.Ingress) == 0 {
+			any := g.pod(g.namespace(nil), nil)
+			g.addCase(any, selected, defaultPort, api.ProtocolTCP, fmt.Sprintf("%s: ingress isolated without rules", name))
+		}
+		for i, rule := range policy.Spec.Ingress {
+			ruleName := fmt.Sprintf("%s: ingress[%d]", name, i)
+			ports := g.ports(rule.Ports)
+			for _, peer := range g.peers(policy, rule.From) {
+				for _, port := range ports {
+					g.addCase(peer.pod, selected, port.number, port.protocol, fmt.Sprintf("%s from %s on %s", ruleName, peer.description, port.description))
+				}
+				if notSelected != nil {
+					g.addCase(peer.pod, notSelected, ports[0].number, ports[0].protocol, fmt.Sprintf("%s from %s to a pod not selected by the policy", ruleName, peer.description))
+				}
+			}
+		}
+	}
+
+	if kubepox.IsPolicyApplicableToEgress(policy) {
+		if len(policy.Spec.Egress) == 0 {
+			any := g.pod(g.namespace(nil), nil)
+			g.addCase(selected, any, defaultPort, api.ProtocolTCP, fmt.Sprintf("%s: egress isolated without rules", name))
+		}
+		for i, rule := range policy.Spec.Egress {
+			ruleName := fmt.Sprintf("%s: egress[%d]", name, i)
+			ports := g.ports(rule.Ports)
+			for _, peer := range g.peers(policy, rule.To) {
+				for _, port := range ports {
+					g.addCase(selected, peer.pod, port.number, port.protocol, fmt.Sprintf("%s to %s on %s", ruleName, peer.description, port.description))
+				}
+				if notSelected != nil {
+					g.addCase(notSelected, peer.pod, ports[0].number, ports[0].protocol, fmt.Sprintf("%s from a pod not selected by the policy to %s", ruleName, peer.description))
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// peers returns the pods matching each peer of a rule and the pods just missing them.
+func (g *generator) peers(policy *networking.NetworkPolicy, peers []networking.NetworkPolicyPeer) []endpoint {
+	if len(peers) == 0 {
+		return []endpoint{
+			endpoint{pod: g.pod(g.namespace(nil), nil), description: "any pod"},
+		}
+	}
+
+	endpoints := []endpoint{}
+	for i, peer := range peers {
+		if peer.IPBlock != nil {
+			continue
+		}
+
+		podLabels := map[string]string{}
+		if peer.PodSelector != nil {
+			podLabels = satisfyingLabels(peer.PodSelector)
+		}
+		namespace := policy.Namespace
+		if peer.NamespaceSelector != nil {
+			namespace = g.namespace(satisfyingLabels(peer.NamespaceSelector))
+		}
+		endpoints = append(endpoints, endpoint{
+			pod:         g.pod(namespace, podLabels),
+			description: fmt.Sprintf("a pod matching peer %d", i),
+		})
+
+		if peer.PodSelector != nil {
+			if labels, ok := violatingLabels(peer.PodSelector); ok {
+				endpoints = append(endpoints, endpoint{
+					pod:         g.pod(namespace, labels),
+					description: fmt.Sprintf("a pod with labels not matching peer %d", i),
+				})
+			}
+		}
+
+		var otherNamespace string
+		if peer.NamespaceSelector == nil {
+			otherNamespace = g.namespace(nil)
+		} else if labels, ok := violatingLabels(peer.NamespaceSelector); ok {
+			otherNamespace = g.namespace(labels)
+		}
+		if otherNamespace != "" {
+			endpoints = append(endpoints, endpoint{
+				pod:         g.pod(otherNamespace, podLabels),
+				description: fmt.Sprintf("a pod in a namespace not matching peer %d", i),
+			})
+		}
+	}
+	return endpoints
+}
+
+// probedPort is a port to probe with its description.
+type probedPort struct {
+	number      int32
+	protocol    api.Protocol
+	description string
+}
+
+// ports returns the ports of a rule to probe, followed by a port not allowed by the rule.
+func (g *generator) ports(ports []networking.NetworkPolicyPort) []probedPort {
+	if len(ports) == 0 {
+		return []probedPort{
+			probedPort{number: defaultPort, protocol: api.ProtocolTCP, description: "any port"},
+		}
+	}
+
+	probed := []probedPort{}
+	used := map[int32]bool{}
+	for _, port := range ports {
+		protocol := api.ProtocolTCP
+		if port.Protocol != nil {
+			protocol = *port.Protocol
+		}
+		switch {
+		case port.Port == nil:
+			probed = append(probed, probedPort{number: defaultPort, protocol: protocol, description: "any " + string(protocol) + " port"})
+			used[defaultPort] = true
+		case port.Port.Type == intstr.String:
+			number := g.namedPorts[port.Port.StrVal].ContainerPort
+			probed = append(probed, probedPort{number: number, protocol: protocol, description: fmt.Sprintf("named port %s/%s", protocol, port.Port.StrVal)})
+			used[number] = true
+		default:
+			probed = append(probed, probedPort{number: port.Port.IntVal, protocol: protocol, description: fmt.Sprintf("port %s/%d", protocol, port.Port.IntVal)})
+			used[port.Port.IntVal] = true
+		}
+	}
+
+	// A port not allowed by the rule, for the negative path.
+	other := int32(defaultPort + 1)
+	for used[other] {
+		other++
+	}
+	probed = append(probed, probedPort{number: other, protocol: probed[0].protocol, description: fmt.Sprintf("port %s/%d not allowed by the rule", probed[0].protocol, other)})
+
+	return probed
+}
+
+// namespace returns the name of a namespace with the given labels, creating one if needed.
+// nil labels return a namespace with no label, distinct from the namespaces of the policies.
+func (g *generator) namespace(labels map[string]string) string {
+	if labels == nil {
+		if g.outside == "" {
+			g.outside = g.newNamespace(nil)
+		}
+		return g.outside
+	}
+
+	names := []string{}
+	for name := range g.namespaces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if equalLabels(g.namespaces[name].Labels, labels) {
+			return name
+		}
+	}
+
+	return g.newNamespace(labels)
+}
+
+// newNamespace creates a namespace with the given labels.
+func (g *generator) newNamespace(labels map[string]string) string {
+	g.namespaceSeq++
+	name := fmt.Sprintf("kubepox-ns-%d", g.namespaceSeq)
+	g.namespaces[name] = &api.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: labels,
+		},
+	}
+	return name
+}
+
+// pod returns a pod of the namespace with the given labels, creating one if needed.
+func (g *generator) pod(namespace string, labels map[string]string) *api.Pod {
+	if _, ok := g.namespaces[namespace]; !ok {
+		g.namespaces[namespace] = &api.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: namespace,
+			},
+		}
+	}
+
+	key := namespace + "|" + labelsString(labels)
+	if name, ok := g.podKeys[key]; ok {
+		return g.pods[name]
+	}
+
+	podLabels := map[string]string{
+		ProbeLabel: "true",
+	}
+	for k, v := range labels {
+		podLabels[k] = v
+	}
+
+	g.podSeq++
+	pod := &api.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("kubepox-pod-%d", g.podSeq),
+			Namespace: namespace,
+			Labels:    podLabels,
+		},
+		Spec: api.PodSpec{
+			Containers: []api.Container{
+				api.Container{
+					Name:  "server",
+					Ports: g.containerPorts(),
+				},
+			},
+		},
+	}
+	g.pods[namespace+"/"+pod.Name] = pod
+	g.podKeys[key] = namespace + "/" + pod.Name
+	return pod
+}
+
+// containerPorts returns the named ports of the policies, declared on every pod.
+func (g *generator) containerPorts() []api.ContainerPort {
+	names := []string{}
+	for name := range g.namedPorts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	ports := []api.ContainerPort{}
+	for _, name := range names {
+		ports = append(ports, g.namedPorts[name])
+	}
+	return ports
+}
+
+func (g *generator) addCase(src, dst *api.Pod, port int32, protocol api.Protocol, reason string) {
+	key := fmt.Sprintf("%s/%s>%s/%s:%s/%d", src.Namespace, src.Name, dst.Namespace, dst.Name, protocol, port)
+	if _, ok := g.cases[key]; ok {
+		return
+	}
+	g.cases[key] = &Case{
+		From:     src.Namespace + "/" + src.Name,
+		To:       dst.Namespace + "/" + dst.Name,
+		Port:     port,
+		Protocol: protocol,
+		Reason:   reason,
+	}
+	g.caseOrder = append(g.caseOrder, key)
+}
+
+// caseList evaluates the expected verdict of every case and builds the CaseList.
+func (g *generator) caseList() (*CaseList, error) {
+	namespaces := &api.NamespaceList{}
+	list := &CaseList{
+		Namespaces: []Namespace{},
+		Pods:       []Pod{},
+		Cases:      []Case{},
+	}
+
+	names := []string{}
+	for name := range g.namespaces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		namespaces.Items = append(namespaces.Items, *g.namespaces[name])
+		list.Namespaces = append(list.Namespaces, Namespace{Name: name, Labels: g.namespaces[name].Labels})
+	}
+
+	podNames := []string{}
+	for name := range g.pods {
+		podNames = append(podNames, name)
+	}
+	sort.Strings(podNames)
+	for _, name := range podNames {
+		pod := g.pods[name]
+		list.Pods = append(list.Pods, Pod{
+			Name:      pod.Name,
+			Namespace: pod.Namespace,
+			Labels:    pod.Labels,
+			Ports:     pod.Spec.Containers[0].Ports,
+		})
+	}
+
+	for _, key := range g.caseOrder {
+		c := g.cases[key]
+		verdict, err := kubepox.EvaluateTraffic(kubepox.PodEndpoint(g.pods[c.From]), kubepox.PodEndpoint(g.pods[c.To]), c.Port, c.Protocol, namespaces, g.policies)
+		if err != nil {
+			return nil, err
+		}
+		c.Expect = Deny
+		if verdict.Allowed {
+			c.Expect = Allow
+		}
+		list.Cases = append(list.Cases, *c)
+	}
+
+	return list, nil
+}
+
+// satisfyingLabels returns a set of labels matched by the selector.
+func satisfyingLabels(selector *metav1.LabelSelector) map[string]string {
+	labels := map[string]string{}
+	for k, v := range selector.MatchLabels {
+		labels[k] = v
+	}
+	for _, requirement := range selector.MatchExpressions {
+		switch requirement.Operator {
+		case metav1.LabelSelectorOpIn:
+			if len(requirement.Values) > 0 {
+				labels[requirement.Key] = requirement.Values[0]
+			}
+		case metav1.LabelSelectorOpNotIn:
+			if _, ok := labels[requirement.Key]; !ok {
+				labels[requirement.Key] = otherValue
+			}
+		case metav1.LabelSelectorOpExists:
+			if _, ok := labels[requirement.Key]; !ok {
+				labels[requirement.Key] = "kubepox"
+			}
+		case metav1.LabelSelectorOpDoesNotExist:
+			delete(labels, requirement.Key)
+		}
+	}
+	return labels
+}
+
+// violatingLabels returns a set of labels close to the selector but not matched by it.
+// It returns false for an empty selector, which matches everything.
+func violatingLabels(selector *metav1.LabelSelector) (map[string]string, bool) {
+	labels := satisfyingLabels(selector)
+
+	keys := []string{}
+	for k := range selector.MatchLabels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	if len(keys) > 0 {
+		labels[keys[0]] = otherValue
+		return labels, true
+	}
+
+	if len(selector.MatchExpressions) == 0 {
+		return nil, false
+	}
+	requirement := selector.MatchExpressions[0]
+	switch requirement.Operator {
+	case metav1.LabelSelectorOpIn:
+		labels[requirement.Key] = otherValue
+	case metav1.LabelSelectorOpNotIn:
+		if len(requirement.Values) == 0 {
+			return nil, false
+		}
+		labels[requirement.Key] = requirement.Values[0]
+	case metav1.LabelSelectorOpExists:
+		delete(labels, requirement.Key)
+	case metav1.LabelSelectorOpDoesNotExist:
+		labels[requirement.Key] = "kubepox"
+	}
+	return labels, true
+}
+
+func labelsString(labels map[string]string) string {
+	pairs := []string{}
+	for k, v := range labels {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func equalLabels(a, b map[string]string) bool {
+	return labelsString(a) == labelsString(b)
+}
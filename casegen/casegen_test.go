@@ -0,0 +1,333 @@
+package casegen
+
+import (
+	"strings"
+	"testing"
+
+	batch "k8s.io/api/batch/v1"
+	api "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+var (
+	tcp      = api.ProtocolTCP
+	udp      = api.ProtocolUDP
+	postgres = intstr.FromInt(5432)
+	dns      = intstr.FromInt(53)
+	metrics  = intstr.FromString("metrics")
+
+	allowAPIToDB = networking.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "web"},
+		Spec: networking.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "db"}},
+			PolicyTypes: []networking.PolicyType{networking.PolicyTypeIngress},
+			Ingress: []networking.NetworkPolicyIngressRule{
+				networking.NetworkPolicyIngressRule{
+					From: []networking.NetworkPolicyPeer{
+						networking.NetworkPolicyPeer{
+							PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "api"}},
+						},
+					},
+					Ports: []networking.NetworkPolicyPort{
+						networking.NetworkPolicyPort{Protocol: &tcp, Port: &postgres},
+					},
+				},
+				networking.NetworkPolicyIngressRule{
+					From: []networking.NetworkPolicyPeer{
+						networking.NetworkPolicyPeer{
+							NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "ops"}},
+						},
+					},
+					Ports: []networking.NetworkPolicyPort{
+						networking.NetworkPolicyPort{Port: &metrics},
+					},
+				},
+			},
+		},
+	}
+
+	allowDNS = networking.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "dns", Namespace: "clients"},
+		Spec: networking.NetworkPolicySpec{
+			PolicyTypes: []networking.PolicyType{networking.PolicyTypeEgress},
+			Egress: []networking.NetworkPolicyEgressRule{
+				networking.NetworkPolicyEgressRule{
+					Ports: []networking.NetworkPolicyPort{
+						networking.NetworkPolicyPort{Protocol: &udp, Port: &dns},
+					},
+				},
+			},
+		},
+	}
+)
+
+// findCase returns the case between pods with the given labels on a port.
+func findCase(list *CaseList, from, to map[string]string, fromNamespace string, port int32) *Case {
+	pods := map[string]Pod{}
+	for _, pod := range list.Pods {
+		pods[pod.Namespace+"/"+pod.Name] = pod
+	}
+	matches := func(pod Pod, labels map[string]string) bool {
+		for k, v := range labels {
+			if pod.Labels[k] != v {
+				return false
+			}
+		}
+		return true
+	}
+	for i, c := range list.Cases {
+		src, dst := pods[c.From], pods[c.To]
+		if matches(src, from) && matches(dst, to) && c.Port == port && (fromNamespace == "" || src.Namespace == fromNamespace) {
+			return &list.Cases[i]
+		}
+	}
+	return nil
+}
+
+func TestGenerate(t *testing.T) {
+	list, err := Generate(&networking.NetworkPolicyList{Items: []networking.NetworkPolicy{allowAPIToDB, allowDNS}}, nil)
+	if err != nil {
+		t.Fatalf("Error generating cases: %s", err)
+	}
+
+	db := map[string]string{"app": "db"}
+	type testStruct struct {
+		description   string
+		from          map[string]string
+		fromNamespace string
+		port          int32
+		expect        string
+	}
+
+	tests := []testStruct{
+		testStruct{
+			description:   "allowed peer on allowed port",
+			from:          map[string]string{"app": "api"},
+			fromNamespace: "web",
+			port:          5432,
+			expect:        Allow,
+		},
+		testStruct{
+			description:   "allowed peer on other port",
+			from:          map[string]string{"app": "api"},
+			fromNamespace: "web",
+			port:          81,
+			expect:        Deny,
+		},
+		testStruct{
+			description:   "peer with other labels",
+			from:          map[string]string{"app": otherValue},
+			fromNamespace: "web",
+			port:          5432,
+			expect:        Deny,
+		},
+		testStruct{
+			description: "peer in an allowed namespace on the named port",
+			from:        map[string]string{},
+			port:        firstNamedPort,
+			expect:      Allow,
+		},
+	}
+
+	for i, test := range tests {
+		t.Log("Testing Generate ", i)
+		c := findCase(list, test.from, db, test.fromNamespace, test.port)
+		if c == nil {
+			t.Errorf("No case %s in %+v", test.description, list.Cases)
+			continue
+		}
+		if c.Expect != test.expect {
+			t.Errorf("Case %s: got %s expected %s", test.description, c.Expect, test.expect)
+		}
+	}
+
+	opsFound := false
+	for _, namespace := range list.Namespaces {
+		if namespace.Labels["team"] == "ops" {
+			opsFound = true
+		}
+	}
+	if !opsFound {
+		t.Errorf("No namespace labeled team=ops in %+v", list.Namespaces)
+	}
+
+	for _, pod := range list.Pods {
+		if pod.Labels[ProbeLabel] != "true" {
+			t.Errorf("Pod %s/%s is missing the probe label", pod.Namespace, pod.Name)
+		}
+		if len(pod.Ports) != 1 || pod.Ports[0].Name != "metrics" || pod.Ports[0].ContainerPort != firstNamedPort {
+			t.Errorf("Pod %s/%s has ports %+v expected metrics", pod.Namespace, pod.Name, pod.Ports)
+		}
+	}
+}
+
+func TestNamedPortProtocol(t *testing.T) {
+	syslog := intstr.FromString("syslog")
+	allowSyslog := networking.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "syslog", Namespace: "logs"},
+		Spec: networking.NetworkPolicySpec{
+			PolicyTypes: []networking.PolicyType{networking.PolicyTypeIngress},
+			Ingress: []networking.NetworkPolicyIngressRule{
+				networking.NetworkPolicyIngressRule{
+					Ports: []networking.NetworkPolicyPort{
+						networking.NetworkPolicyPort{Protocol: &udp, Port: &syslog},
+					},
+				},
+			},
+		},
+	}
+	list, err := Generate(&networking.NetworkPolicyList{Items: []networking.NetworkPolicy{allowSyslog, allowAPIToDB}}, nil)
+	if err != nil {
+		t.Fatalf("Error generating cases: %s", err)
+	}
+
+	type testStruct struct {
+		name     string
+		protocol api.Protocol
+	}
+
+	tests := []testStruct{
+		testStruct{
+			name:     "metrics",
+			protocol: api.ProtocolTCP,
+		},
+		testStruct{
+			name:     "syslog",
+			protocol: api.ProtocolUDP,
+		},
+	}
+
+	for i, test := range tests {
+		t.Log("Testing NamedPortProtocol ", i)
+		for _, pod := range list.Pods {
+			found := false
+			for _, port := range pod.Ports {
+				if port.Name == test.name {
+					found = true
+					if port.Protocol != test.protocol {
+						t.Errorf("Test %d Got protocol %s for port %s of pod %s/%s expected %s", i, port.Protocol, test.name, pod.Namespace, pod.Name, test.protocol)
+					}
+				}
+			}
+			if !found {
+				t.Errorf("Test %d Pod %s/%s has no port %s: %+v", i, pod.Namespace, pod.Name, test.name, pod.Ports)
+			}
+		}
+	}
+
+	allowed := false
+	for _, c := range list.Cases {
+		if c.Protocol == api.ProtocolUDP && c.Expect == Allow && strings.HasPrefix(c.To, "logs/") {
+			allowed = true
+		}
+	}
+	if !allowed {
+		t.Errorf("No allowed UDP case to the syslog port in %+v", list.Cases)
+	}
+}
+
+func TestProbeManifests(t *testing.T) {
+	http := intstr.FromInt(80)
+	allowWeb := networking.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "clients"},
+		Spec: networking.NetworkPolicySpec{
+			PolicyTypes: []networking.PolicyType{networking.PolicyTypeEgress},
+			Egress: []networking.NetworkPolicyEgressRule{
+				networking.NetworkPolicyEgressRule{
+					Ports: []networking.NetworkPolicyPort{
+						networking.NetworkPolicyPort{Protocol: &tcp, Port: &http},
+					},
+				},
+			},
+		},
+	}
+	policies := &networking.NetworkPolicyList{Items: []networking.NetworkPolicy{allowAPIToDB, allowDNS, allowWeb}}
+	list, err := Generate(policies, nil)
+	if err != nil {
+		t.Fatalf("Error generating cases: %s", err)
+	}
+
+	udpCases := 0
+	for _, c := range list.Cases {
+		if c.Protocol == api.ProtocolUDP {
+			udpCases++
+		}
+	}
+	if udpCases == 0 {
+		t.Fatalf("Expected UDP cases in %+v", list.Cases)
+	}
+
+	objects, err := ProbeManifests(list, policies, ProbeOptions{
+		Image:                DefaultProbeImage,
+		DNSNamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"kubernetes.io/metadata.name": "kube-system"}},
+		DNSPodSelector:       &metav1.LabelSelector{MatchLabels: map[string]string{"k8s-app": "kube-dns"}},
+	})
+	if err != nil {
+		t.Fatalf("Error generating probes: %s", err)
+	}
+	namespaces, services, pods, jobs, dnsJobs := 0, 0, 0, 0, 0
+	dnsPolicies := []string{}
+	for _, object := range objects {
+		if _, ok := object.(*batch.Job); !ok && jobs > 0 {
+			t.Errorf("Object %+v follows the jobs", object)
+		}
+		switch o := object.(type) {
+		case *api.Namespace:
+			namespaces++
+		case *api.Service:
+			services++
+		case *api.Pod:
+			pods++
+			served := false
+			for _, env := range o.Spec.Containers[0].Env {
+				served = served || strings.HasPrefix(env.Name, "SERVE_PORT_")
+			}
+			if served && o.Spec.Containers[0].ReadinessProbe == nil {
+				t.Errorf("Pod %s/%s has no readiness probe", o.Namespace, o.Name)
+			}
+		case *batch.Job:
+			jobs++
+			if o.Spec.Template.Annotations[ExpectAnnotation] != Allow && o.Spec.Template.Annotations[ExpectAnnotation] != Deny {
+				t.Errorf("Job %s has no expected verdict", o.Name)
+			}
+			// Only the sources of namespace clients are isolated for egress.
+			if (o.Spec.Template.Labels[ProbeDNSLabel] == "true") != (o.Namespace == "clients") {
+				t.Errorf("Job %s of namespace %s has labels %v", o.Name, o.Namespace, o.Spec.Template.Labels)
+			}
+			if o.Spec.Template.Labels[ProbeDNSLabel] == "true" {
+				dnsJobs++
+			}
+			// The probes wait for their destination, and fail at a deadline.
+			if len(o.Spec.Template.Spec.InitContainers) != 1 || o.Spec.ActiveDeadlineSeconds == nil {
+				t.Errorf("Job %s doesn't wait for its destination: %+v", o.Name, o.Spec)
+			}
+			command := strings.Join(o.Spec.Template.Spec.Containers[0].Command, " ")
+			if strings.HasPrefix(command, "sh -c until") != (o.Spec.Template.Annotations[ExpectAnnotation] == Allow) {
+				t.Errorf("Job %s expected %s has command %q", o.Name, o.Spec.Template.Annotations[ExpectAnnotation], command)
+			}
+		case *networking.NetworkPolicy:
+			dnsPolicies = append(dnsPolicies, o.Namespace+"/"+o.Name)
+			if o.Spec.PodSelector.MatchLabels[ProbeDNSLabel] != "true" || len(o.Spec.Egress) != 1 {
+				t.Errorf("Policy %s/%s selects %+v expected the probes needing DNS", o.Namespace, o.Name, o.Spec.PodSelector)
+			}
+		}
+	}
+
+	if namespaces != len(list.Namespaces) || services != len(list.Namespaces) {
+		t.Errorf("Got %d namespaces and %d services expected %d", namespaces, services, len(list.Namespaces))
+	}
+	if pods != len(list.Pods) {
+		t.Errorf("Got %d pods expected %d", pods, len(list.Pods))
+	}
+	if jobs != len(list.Cases)-udpCases {
+		t.Errorf("Got %d jobs expected %d", jobs, len(list.Cases)-udpCases)
+	}
+	if dnsJobs == 0 {
+		t.Errorf("Expected jobs with the %s label", ProbeDNSLabel)
+	}
+	if len(dnsPolicies) != 1 || dnsPolicies[0] != "clients/"+ProbeDNSPolicy {
+		t.Errorf("Got DNS policies %v expected clients/%s", dnsPolicies, ProbeDNSPolicy)
+	}
+}
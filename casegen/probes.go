@@ -0,0 +1,281 @@
+package casegen
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aporeto-inc/kubepox"
+
+	batch "k8s.io/api/batch/v1"
+	api "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// DefaultProbeImage is the image running the probe servers and clients. It provides the porter and connect commands.
+const DefaultProbeImage = "registry.k8s.io/e2e-test-images/agnhost:2.39"
+
+// ProbeService is the name of the headless Service giving a DNS name to the synthesized pods of a namespace.
+const ProbeService = "kubepox-probe"
+
+// ProbeDNSLabel is set on the probe Jobs whose source is isolated for egress, so that the allow DNS policy
+// generated along with them selects them, and only them.
+const ProbeDNSLabel = "kubepox.io/probe-dns"
+
+// ProbeDNSPolicy is the name of the policy allowing the probe Jobs to resolve their destination.
+const ProbeDNSPolicy = "kubepox-probe-dns"
+
+// Annotations set on the probe Jobs.
+const (
+	ExpectAnnotation = "kubepox.io/expect"
+	CaseAnnotation   = "kubepox.io/case"
+)
+
+// probeTimeout is the time given to a probe to connect.
+const probeTimeout = "5s"
+
+// probeSettleSeconds is the time given to the network plugin to program the policies once the destination of a
+// probe is resolvable, before a probe expected to be denied connects.
+const probeSettleSeconds = 10
+
+// probeDeadlineSeconds is the time given to a probe Job to wait for its destination and connect.
+const probeDeadlineSeconds = int64(300)
+
+// ProbeOptions are the options of the probe manifests.
+type ProbeOptions struct {
+	// Image runs the probe servers and clients.
+	Image string
+	// DNSNamespaceSelector and DNSPodSelector select the DNS pods the probes resolve their destination with.
+	DNSNamespaceSelector *metav1.LabelSelector
+	DNSPodSelector       *metav1.LabelSelector
+}
+
+// ProbeManifests generates the manifests deploying the synthesized pods of the list, and a Job per case
+// trying to connect from the source to the destination of the case. The Job of a case expected to be
+// allowed must succeed, the Job of a case expected to be denied must fail.
+//
+// The probe Jobs run in the namespace of the source of the case, with its labels, and reach the
+// destination through its DNS name. The Jobs whose source is isolated for egress by the policies get the
+// ProbeDNSLabel, and a ProbeDNSPolicy allowing them, and only them, to reach the DNS pods is generated in
+// their namespace: this rule is a prerequisite of the probes, not part of the tested policies.
+// UDP cases are not probed, as a UDP connection can't tell a dropped packet from an idle server.
+//
+// The probes don't depend on the order the manifests are applied in, as long as the tested policies are applied
+// with them: a probe first waits for the DNS name of its destination to resolve, which it does once the server pod
+// is ready, and gives the network plugin probeSettleSeconds to program the policies. A probe expected to be
+// allowed then retries to connect, and a probe expected to be denied connects once. Every Job fails after
+// probeDeadlineSeconds.
+func ProbeManifests(list *CaseList, policies *networking.NetworkPolicyList, options ProbeOptions) ([]runtime.Object, error) {
+	objects := []runtime.Object{}
+	image := options.Image
+
+	for _, namespace := range list.Namespaces {
+		objects = append(objects,
+			&api.Namespace{
+				TypeMeta: metav1.TypeMeta{
+					APIVersion: "v1",
+					Kind:       "Namespace",
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   namespace.Name,
+					Labels: namespace.Labels,
+				},
+			},
+			&api.Service{
+				TypeMeta: metav1.TypeMeta{
+					APIVersion: "v1",
+					Kind:       "Service",
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      ProbeService,
+					Namespace: namespace.Name,
+				},
+				Spec: api.ServiceSpec{
+					ClusterIP: api.ClusterIPNone,
+					Selector: map[string]string{
+						ProbeLabel: "true",
+					},
+				},
+			},
+		)
+	}
+
+	served := map[string]map[int32]api.Protocol{}
+	for _, c := range list.Cases {
+		if served[c.To] == nil {
+			served[c.To] = map[int32]api.Protocol{}
+		}
+		served[c.To][c.Port] = c.Protocol
+	}
+
+	pods := map[string]*Pod{}
+	for i := range list.Pods {
+		pod := &list.Pods[i]
+		key := pod.Namespace + "/" + pod.Name
+		pods[key] = pod
+		objects = append(objects, serverPod(pod, served[key], image))
+	}
+
+	jobs := []runtime.Object{}
+	dnsNamespaces := map[string]bool{}
+	for i, c := range list.Cases {
+		if c.Protocol == api.ProtocolUDP {
+			continue
+		}
+		src, dst := pods[c.From], pods[c.To]
+		if src == nil || dst == nil {
+			continue
+		}
+		job := probeJob(fmt.Sprintf("kubepox-case-%d", i+1), &c, src, dst, image)
+
+		isolated, err := kubepox.IsPodSelectedEgress(&api.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: src.Namespace, Labels: src.Labels}}, policies)
+		if err != nil {
+			return nil, err
+		}
+		if isolated {
+			job.Spec.Template.Labels[ProbeDNSLabel] = "true"
+			dnsNamespaces[src.Namespace] = true
+		}
+		jobs = append(jobs, job)
+	}
+
+	for _, namespace := range list.Namespaces {
+		if !dnsNamespaces[namespace.Name] {
+			continue
+		}
+		policy := kubepox.NewAllowDNSPolicy(namespace.Name, options.DNSNamespaceSelector, options.DNSPodSelector)
+		policy.Name = ProbeDNSPolicy
+		policy.Spec.PodSelector = metav1.LabelSelector{
+			MatchLabels: map[string]string{
+				ProbeDNSLabel: "true",
+			},
+		}
+		objects = append(objects, policy)
+	}
+
+	return append(objects, jobs...), nil
+}
+
+// serverPod returns a pod listening on all the ports it is probed on. It is ready, and gets its DNS name, once it
+// accepts connections on its first TCP port.
+func serverPod(pod *Pod, ports map[int32]api.Protocol, image string) *api.Pod {
+	numbers := []int{}
+	for number := range ports {
+		numbers = append(numbers, int(number))
+	}
+	sort.Ints(numbers)
+
+	env := []api.EnvVar{}
+	var readinessProbe *api.Probe
+	for _, number := range numbers {
+		prefix := "SERVE_PORT_"
+		switch ports[int32(number)] {
+		case api.ProtocolUDP:
+			// porter doesn't serve UDP, and UDP cases are not probed.
+			continue
+		case api.ProtocolSCTP:
+			prefix = "SERVE_SCTP_PORT_"
+		default:
+			if readinessProbe == nil {
+				readinessProbe = &api.Probe{
+					Handler: api.Handler{
+						TCPSocket: &api.TCPSocketAction{Port: intstr.FromInt(number)},
+					},
+					PeriodSeconds: 1,
+				}
+			}
+		}
+		env = append(env, api.EnvVar{
+			Name:  fmt.Sprintf("%s%d", prefix, number),
+			Value: "kubepox",
+		})
+	}
+
+	return &api.Pod{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "Pod",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      pod.Name,
+			Namespace: pod.Namespace,
+			Labels:    pod.Labels,
+		},
+		Spec: api.PodSpec{
+			Hostname:  pod.Name,
+			Subdomain: ProbeService,
+			Containers: []api.Container{
+				api.Container{
+					Name:           "server",
+					Image:          image,
+					Args:           []string{"porter"},
+					Env:            env,
+					Ports:          pod.Ports,
+					ReadinessProbe: readinessProbe,
+				},
+			},
+		},
+	}
+}
+
+// probeJob returns a Job connecting from a pod like src to dst, once dst resolves.
+func probeJob(name string, c *Case, src, dst *Pod, image string) *batch.Job {
+	backoffLimit := int32(0)
+	deadline := probeDeadlineSeconds
+	host := fmt.Sprintf("%s.%s.%s.svc.cluster.local", dst.Name, ProbeService, dst.Namespace)
+	connect := fmt.Sprintf("/agnhost connect %s:%d --timeout=%s --protocol=%s", host, c.Port, probeTimeout, strings.ToLower(string(c.Protocol)))
+	if c.Expect == Allow {
+		connect = fmt.Sprintf("until %s; do sleep 1; done", connect)
+	}
+	annotations := map[string]string{
+		ExpectAnnotation: c.Expect,
+		CaseAnnotation:   fmt.Sprintf("%s -> %s %s/%d", c.From, c.To, c.Protocol, c.Port),
+	}
+
+	labels := map[string]string{}
+	for k, v := range src.Labels {
+		labels[k] = v
+	}
+
+	return &batch.Job{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: batch.SchemeGroupVersion.String(),
+			Kind:       "Job",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   src.Namespace,
+			Annotations: annotations,
+		},
+		Spec: batch.JobSpec{
+			BackoffLimit:          &backoffLimit,
+			ActiveDeadlineSeconds: &deadline,
+			Template: api.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels:      labels,
+					Annotations: annotations,
+				},
+				Spec: api.PodSpec{
+					RestartPolicy: api.RestartPolicyNever,
+					InitContainers: []api.Container{
+						api.Container{
+							Name:    "wait",
+							Image:   image,
+							Command: []string{"sh", "-c", fmt.Sprintf("until nslookup %s; do sleep 1; done; sleep %d", host, probeSettleSeconds)},
+						},
+					},
+					Containers: []api.Container{
+						api.Container{
+							Name:    "probe",
+							Image:   image,
+							Command: []string{"sh", "-c", connect},
+						},
+					},
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,184 @@
+package cluster
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	batchlisters "k8s.io/client-go/listers/batch/v1"
+	batchv1beta1listers "k8s.io/client-go/listers/batch/v1beta1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	networkinglisters "k8s.io/client-go/listers/networking/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Cache is a Source kept up to date by watching the Kubernetes API.
+// Services and EndpointSlices are not watched. The controllers of pods are watched so that workloads can be
+// resolved, which requires the permission to list and watch them.
+type Cache struct {
+	factory      informers.SharedInformerFactory
+	pods         corelisters.PodLister
+	policies     networkinglisters.NetworkPolicyLister
+	namespaces   corelisters.NamespaceLister
+	replicaSets  appslisters.ReplicaSetLister
+	jobs         batchlisters.JobLister
+	deployments  appslisters.DeploymentLister
+	statefulSets appslisters.StatefulSetLister
+	daemonSets   appslisters.DaemonSetLister
+	cronJobs     batchv1beta1listers.CronJobLister
+	changes      chan struct{}
+}
+
+// NewCache returns a Cache of the objects of a namespace, or of all the namespaces if namespace is empty.
+// Namespaces themselves are only watched for all the namespaces, as watching them requires cluster wide permissions.
+func NewCache(client kubernetes.Interface, namespace string) *Cache {
+	options := []informers.SharedInformerOption{}
+	if namespace != "" {
+		options = append(options, informers.WithNamespace(namespace))
+	}
+	factory := informers.NewSharedInformerFactoryWithOptions(client, 0, options...)
+
+	c := &Cache{
+		factory:      factory,
+		pods:         factory.Core().V1().Pods().Lister(),
+		policies:     factory.Networking().V1().NetworkPolicies().Lister(),
+		replicaSets:  factory.Apps().V1().ReplicaSets().Lister(),
+		jobs:         factory.Batch().V1().Jobs().Lister(),
+		deployments:  factory.Apps().V1().Deployments().Lister(),
+		statefulSets: factory.Apps().V1().StatefulSets().Lister(),
+		daemonSets:   factory.Apps().V1().DaemonSets().Lister(),
+		cronJobs:     factory.Batch().V1beta1().CronJobs().Lister(),
+		changes:      make(chan struct{}, 1),
+	}
+
+	// Every event only flags the cache as changed, which coalesces bursts of events
+	// (e.g. during a rollout) into a single notification.
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(interface{}) { c.notify() },
+		UpdateFunc: func(interface{}, interface{}) { c.notify() },
+		DeleteFunc: func(interface{}) { c.notify() },
+	}
+	factory.Core().V1().Pods().Informer().AddEventHandler(handler)
+	factory.Networking().V1().NetworkPolicies().Informer().AddEventHandler(handler)
+	factory.Apps().V1().ReplicaSets().Informer().AddEventHandler(handler)
+	factory.Batch().V1().Jobs().Informer().AddEventHandler(handler)
+	factory.Apps().V1().Deployments().Informer().AddEventHandler(handler)
+	factory.Apps().V1().StatefulSets().Informer().AddEventHandler(handler)
+	factory.Apps().V1().DaemonSets().Informer().AddEventHandler(handler)
+	factory.Batch().V1beta1().CronJobs().Informer().AddEventHandler(handler)
+	if namespace == "" {
+		c.namespaces = factory.Core().V1().Namespaces().Lister()
+		factory.Core().V1().Namespaces().Informer().AddEventHandler(handler)
+	}
+
+	return c
+}
+
+func (c *Cache) notify() {
+	select {
+	case c.changes <- struct{}{}:
+	default:
+	}
+}
+
+// Start starts watching the Kubernetes API and waits until the Cache is populated.
+func (c *Cache) Start(stop <-chan struct{}) error {
+	c.factory.Start(stop)
+	for informer, synced := range c.factory.WaitForCacheSync(stop) {
+		if !synced {
+			return fmt.Errorf("couldn't sync the cache for %v", informer)
+		}
+	}
+	return nil
+}
+
+// Changes returns a channel that receives a value after the Cache has changed.
+func (c *Cache) Changes() <-chan struct{} {
+	return c.changes
+}
+
+// State implements Source.
+func (c *Cache) State() (*State, error) {
+	state := &State{}
+
+	if c.namespaces != nil {
+		namespaces, err := c.namespaces.List(labels.Everything())
+		if err != nil {
+			return nil, err
+		}
+		for _, namespace := range namespaces {
+			state.Namespaces.Items = append(state.Namespaces.Items, *namespace)
+		}
+	}
+
+	pods, err := c.pods.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	for _, pod := range pods {
+		state.Pods.Items = append(state.Pods.Items, *pod)
+	}
+
+	policies, err := c.policies.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	for _, policy := range policies {
+		state.Policies.Items = append(state.Policies.Items, *policy)
+	}
+
+	replicaSets, err := c.replicaSets.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	for _, replicaSet := range replicaSets {
+		state.ReplicaSets.Items = append(state.ReplicaSets.Items, *replicaSet)
+	}
+
+	jobs, err := c.jobs.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	for _, job := range jobs {
+		state.Jobs.Items = append(state.Jobs.Items, *job)
+	}
+
+	deployments, err := c.deployments.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	for _, deployment := range deployments {
+		state.Deployments.Items = append(state.Deployments.Items, *deployment)
+	}
+
+	statefulSets, err := c.statefulSets.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	for _, statefulSet := range statefulSets {
+		state.StatefulSets.Items = append(state.StatefulSets.Items, *statefulSet)
+	}
+
+	daemonSets, err := c.daemonSets.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	for _, daemonSet := range daemonSets {
+		state.DaemonSets.Items = append(state.DaemonSets.Items, *daemonSet)
+	}
+
+	cronJobs, err := c.cronJobs.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	for _, cronJob := range cronJobs {
+		state.CronJobs.Items = append(state.CronJobs.Items, *cronJob)
+	}
+
+	state.Sort()
+	return state, nil
+}
+
+var _ Source = &Cache{}
@@ -0,0 +1,36 @@
+package cluster
+
+import (
+	"testing"
+
+	apps "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCacheWorkloads(t *testing.T) {
+	pod := ownedPod("api-5f6c7-abcde", KindReplicaSet, "api-5f6c7", nil)
+	controller := true
+	replicaSet := &apps.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "api-5f6c7",
+			Namespace:       "web",
+			OwnerReferences: []metav1.OwnerReference{{Kind: KindDeployment, Name: "api-server", Controller: &controller}},
+		},
+	}
+	cache := NewCache(fake.NewSimpleClientset(&pod, replicaSet), "web")
+
+	stop := make(chan struct{})
+	defer close(stop)
+	if err := cache.Start(stop); err != nil {
+		t.Fatalf("Error starting the cache: %s", err)
+	}
+	state, err := cache.State()
+	if err != nil {
+		t.Fatalf("Error getting the state: %s", err)
+	}
+
+	if workload := state.WorkloadOf(state.Pod("web", pod.Name)); workload.String() != "deployment/api-server" {
+		t.Errorf("Got workload %s expected deployment/api-server", workload)
+	}
+}
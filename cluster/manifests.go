@@ -0,0 +1,310 @@
+package cluster
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	apps "k8s.io/api/apps/v1"
+	batch "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	api "k8s.io/api/core/v1"
+	discovery "k8s.io/api/discovery/v1beta1"
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+// LoadManifests builds a State out of YAML or JSON manifest files.
+// Directories are walked recursively for .yaml, .yml and .json files.
+// The file and line of every NetworkPolicy are recorded in the Locations of the State.
+// Objects of other kinds than Namespace, Pod, NetworkPolicy, Service, EndpointSlice and the controllers of pods
+// (Deployment, ReplicaSet, StatefulSet, DaemonSet, Job and CronJob) are ignored.
+func LoadManifests(paths ...string) (*State, error) {
+	state := &State{}
+
+	for _, path := range paths {
+		err := filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() || !isManifest(file) {
+				return nil
+			}
+			data, err := ioutil.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			if err := state.addManifestFile(file, data); err != nil {
+				return fmt.Errorf("%s: %v", file, err)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return state, nil
+}
+
+func isManifest(file string) bool {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+	return false
+}
+
+// Location is the position of an object in a manifest file.
+type Location struct {
+	File string `json:"file"`
+	Line int    `json:"line"`
+}
+
+// document is a YAML document of a manifest file, starting at line, with the lines of the file.
+type document struct {
+	line  int
+	lines []string
+}
+
+// splitDocuments splits a manifest file in YAML documents, separated by lines starting with "---" followed by
+// a space or the end of the line, such as "--- # comment" or "--- !tag". The line of a document is its first
+// line that is neither blank nor a comment: the separator itself when content follows it. A JSON file is a
+// single document.
+func splitDocuments(data []byte) []document {
+	documents := []document{}
+	current := document{}
+	for i, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, "---") && (len(line) == 3 || strings.ContainsAny(line[3:4], " \t\r")) {
+			documents = append(documents, current)
+			current = document{}
+			if rest := strings.TrimSpace(line[3:]); rest != "" && !strings.HasPrefix(rest, "#") {
+				current.line = i + 1
+				current.lines = append(current.lines, line)
+			}
+			continue
+		}
+		trimmed := strings.TrimSpace(line)
+		if current.line == 0 && trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+			current.line = i + 1
+		}
+		if current.line != 0 {
+			current.lines = append(current.lines, line)
+		}
+	}
+	documents = append(documents, current)
+	return documents
+}
+
+var (
+	// metadataLine matches the metadata key of an object, in YAML or indented JSON, possibly as a YAML list item.
+	metadataLine = regexp.MustCompile(`^(\s*(?:-\s+)?)"?metadata"?\s*:\s*\{?\s*$`)
+	// nameKeyLine matches a name key and captures its value.
+	nameKeyLine = regexp.MustCompile(`^\s*"?name"?\s*:\s*["']?([^"']*?)["']?\s*,?\s*$`)
+)
+
+// nameLine returns the line of the document declaring the name in the metadata of an object, searched from
+// line, 0 if there is none. Only the keys directly under metadata are considered, so that a label or a
+// selector named name is never taken for the name of the object.
+func (d *document) nameLine(name string, line int) int {
+	for i := line - d.line; i >= 0 && i < len(d.lines); i++ {
+		metadata := metadataLine.FindStringSubmatch(d.lines[i])
+		if metadata == nil {
+			continue
+		}
+		indent := -1
+		for j := i + 1; j < len(d.lines); j++ {
+			trimmed := strings.TrimSpace(d.lines[j])
+			if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+				continue
+			}
+			lineIndent := len(d.lines[j]) - len(strings.TrimLeft(d.lines[j], " \t"))
+			if lineIndent <= len(metadata[1]) {
+				break
+			}
+			if indent < 0 {
+				indent = lineIndent
+			}
+			if lineIndent != indent {
+				continue
+			}
+			if match := nameKeyLine.FindStringSubmatch(d.lines[j]); match != nil && match[1] == name {
+				return d.line + j
+			}
+		}
+	}
+	return 0
+}
+
+// addManifestFile adds the objects of a manifest file to the State, recording the location of its NetworkPolicies.
+// A policy is located at the start of its document, or at its name when the document is a list.
+func (s *State) addManifestFile(file string, data []byte) error {
+	if s.Locations == nil {
+		s.Locations = map[string]Location{}
+	}
+	for _, document := range splitDocuments(data) {
+		if document.line == 0 {
+			continue
+		}
+		before := len(s.Policies.Items)
+		if err := s.AddManifest([]byte(strings.Join(document.lines, "\n"))); err != nil {
+			return err
+		}
+		line := document.line
+		for i := before; i < len(s.Policies.Items); i++ {
+			policy := &s.Policies.Items[i]
+			location := Location{File: file, Line: document.line}
+			if len(s.Policies.Items)-before > 1 {
+				if found := document.nameLine(policy.Name, line); found != 0 {
+					location.Line = found
+					line = found + 1
+				}
+			}
+			s.Locations[policy.Namespace+"/"+policy.Name] = location
+		}
+	}
+	return nil
+}
+
+// AddManifest decodes all the objects of a YAML or JSON document, possibly multi-document, and adds them to the State.
+func (s *State) AddManifest(data []byte) error {
+	decoder := yaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), 4096)
+	for {
+		raw := runtime.RawExtension{}
+		if err := decoder.Decode(&raw); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if len(bytes.TrimSpace(raw.Raw)) == 0 || bytes.Equal(bytes.TrimSpace(raw.Raw), []byte("null")) {
+			continue
+		}
+		if err := s.addRaw(raw.Raw); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *State) addRaw(data []byte) error {
+	obj, _, err := scheme.Codecs.UniversalDeserializer().Decode(data, nil, nil)
+	if err != nil {
+		if runtime.IsNotRegisteredError(err) {
+			return nil
+		}
+		return err
+	}
+	return s.AddObject(obj)
+}
+
+// AddObject adds a decoded object to the State. Lists are flattened.
+func (s *State) AddObject(obj runtime.Object) error {
+	switch o := obj.(type) {
+	case *api.Namespace:
+		s.Namespaces.Items = append(s.Namespaces.Items, *o)
+	case *api.NamespaceList:
+		s.Namespaces.Items = append(s.Namespaces.Items, o.Items...)
+	case *api.Pod:
+		defaultNamespace(o)
+		s.Pods.Items = append(s.Pods.Items, *o)
+	case *api.PodList:
+		for i := range o.Items {
+			defaultNamespace(&o.Items[i])
+			s.Pods.Items = append(s.Pods.Items, o.Items[i])
+		}
+	case *networking.NetworkPolicy:
+		defaultNamespace(o)
+		s.Policies.Items = append(s.Policies.Items, *o)
+	case *networking.NetworkPolicyList:
+		for i := range o.Items {
+			defaultNamespace(&o.Items[i])
+			s.Policies.Items = append(s.Policies.Items, o.Items[i])
+		}
+	case *api.Service:
+		defaultNamespace(o)
+		s.Services.Items = append(s.Services.Items, *o)
+	case *api.ServiceList:
+		for i := range o.Items {
+			defaultNamespace(&o.Items[i])
+			s.Services.Items = append(s.Services.Items, o.Items[i])
+		}
+	case *discovery.EndpointSlice:
+		defaultNamespace(o)
+		s.EndpointSlices.Items = append(s.EndpointSlices.Items, *o)
+	case *discovery.EndpointSliceList:
+		for i := range o.Items {
+			defaultNamespace(&o.Items[i])
+			s.EndpointSlices.Items = append(s.EndpointSlices.Items, o.Items[i])
+		}
+	case *apps.ReplicaSet:
+		defaultNamespace(o)
+		s.ReplicaSets.Items = append(s.ReplicaSets.Items, *o)
+	case *apps.ReplicaSetList:
+		for i := range o.Items {
+			defaultNamespace(&o.Items[i])
+			s.ReplicaSets.Items = append(s.ReplicaSets.Items, o.Items[i])
+		}
+	case *batch.Job:
+		defaultNamespace(o)
+		s.Jobs.Items = append(s.Jobs.Items, *o)
+	case *batch.JobList:
+		for i := range o.Items {
+			defaultNamespace(&o.Items[i])
+			s.Jobs.Items = append(s.Jobs.Items, o.Items[i])
+		}
+	case *apps.Deployment:
+		defaultNamespace(o)
+		s.Deployments.Items = append(s.Deployments.Items, *o)
+	case *apps.DeploymentList:
+		for i := range o.Items {
+			defaultNamespace(&o.Items[i])
+			s.Deployments.Items = append(s.Deployments.Items, o.Items[i])
+		}
+	case *apps.StatefulSet:
+		defaultNamespace(o)
+		s.StatefulSets.Items = append(s.StatefulSets.Items, *o)
+	case *apps.StatefulSetList:
+		for i := range o.Items {
+			defaultNamespace(&o.Items[i])
+			s.StatefulSets.Items = append(s.StatefulSets.Items, o.Items[i])
+		}
+	case *apps.DaemonSet:
+		defaultNamespace(o)
+		s.DaemonSets.Items = append(s.DaemonSets.Items, *o)
+	case *apps.DaemonSetList:
+		for i := range o.Items {
+			defaultNamespace(&o.Items[i])
+			s.DaemonSets.Items = append(s.DaemonSets.Items, o.Items[i])
+		}
+	case *batchv1beta1.CronJob:
+		defaultNamespace(o)
+		s.CronJobs.Items = append(s.CronJobs.Items, *o)
+	case *batchv1beta1.CronJobList:
+		for i := range o.Items {
+			defaultNamespace(&o.Items[i])
+			s.CronJobs.Items = append(s.CronJobs.Items, o.Items[i])
+		}
+	case *api.List:
+		for _, item := range o.Items {
+			if err := s.addRaw(item.Raw); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// defaultNamespace sets the namespace of an object to "default" when the manifest doesn't specify it, like kubectl apply does.
+func defaultNamespace(obj metav1.Object) {
+	if obj.GetNamespace() == "" {
+		obj.SetNamespace(api.NamespaceDefault)
+	}
+}
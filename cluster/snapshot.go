@@ -0,0 +1,355 @@
+package cluster
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	apps "k8s.io/api/apps/v1"
+	batch "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	api "k8s.io/api/core/v1"
+	discovery "k8s.io/api/discovery/v1beta1"
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// SnapshotVersion is the version of the snapshot format written by SaveSnapshot.
+const SnapshotVersion = 1
+
+// lastAppliedAnnotation is set by kubectl apply and holds a copy of the whole object.
+const lastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+// Snapshot is the State of a cluster captured at a point in time, to be replayed offline.
+type Snapshot struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Context is the name of the kubeconfig context the snapshot was taken from.
+	Context string `json:"context,omitempty"`
+	// Namespace is the namespace the snapshot was restricted to, empty for all the namespaces.
+	Namespace string `json:"namespace,omitempty"`
+
+	Namespaces []api.Namespace            `json:"namespaces"`
+	Pods       []api.Pod                  `json:"pods"`
+	Policies   []networking.NetworkPolicy `json:"policies"`
+
+	Services       []api.Service             `json:"services,omitempty"`
+	EndpointSlices []discovery.EndpointSlice `json:"endpointSlices,omitempty"`
+	ReplicaSets    []apps.ReplicaSet         `json:"replicaSets,omitempty"`
+	Jobs           []batch.Job               `json:"jobs,omitempty"`
+	Deployments    []apps.Deployment         `json:"deployments,omitempty"`
+	StatefulSets   []apps.StatefulSet        `json:"statefulSets,omitempty"`
+	DaemonSets     []apps.DaemonSet          `json:"daemonSets,omitempty"`
+	CronJobs       []batchv1beta1.CronJob    `json:"cronJobs,omitempty"`
+}
+
+// NewSnapshot captures the State, stripped of the fields irrelevant to the evaluation of policies:
+// managed fields, statuses other than the phase and addresses of pods, container specs other than ports,
+// statuses of Services, everything but the metadata and pod templates of the controllers of pods.
+func NewSnapshot(state *State) *Snapshot {
+	snapshot := &Snapshot{
+		Version:    SnapshotVersion,
+		CreatedAt:  time.Now().UTC(),
+		Namespaces: []api.Namespace{},
+		Pods:       []api.Pod{},
+		Policies:   []networking.NetworkPolicy{},
+	}
+
+	for _, namespace := range state.Namespaces.Items {
+		snapshot.Namespaces = append(snapshot.Namespaces, api.Namespace{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Namespace"},
+			ObjectMeta: stripMeta(&namespace.ObjectMeta),
+		})
+	}
+
+	for _, pod := range state.Pods.Items {
+		snapshot.Pods = append(snapshot.Pods, api.Pod{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+			ObjectMeta: stripMeta(&pod.ObjectMeta),
+			Spec:       stripPodSpec(&pod.Spec),
+			Status: api.PodStatus{
+				Phase:  pod.Status.Phase,
+				PodIP:  pod.Status.PodIP,
+				PodIPs: pod.Status.PodIPs,
+			},
+		})
+	}
+
+	for _, policy := range state.Policies.Items {
+		snapshot.Policies = append(snapshot.Policies, networking.NetworkPolicy{
+			TypeMeta:   metav1.TypeMeta{APIVersion: networking.SchemeGroupVersion.String(), Kind: "NetworkPolicy"},
+			ObjectMeta: stripMeta(&policy.ObjectMeta),
+			Spec:       policy.Spec,
+		})
+	}
+
+	for _, service := range state.Services.Items {
+		snapshot.Services = append(snapshot.Services, api.Service{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Service"},
+			ObjectMeta: stripMeta(&service.ObjectMeta),
+			Spec:       service.Spec,
+		})
+	}
+
+	for _, slice := range state.EndpointSlices.Items {
+		stripped := slice
+		stripped.TypeMeta = metav1.TypeMeta{APIVersion: discovery.SchemeGroupVersion.String(), Kind: "EndpointSlice"}
+		stripped.ObjectMeta = stripMeta(&slice.ObjectMeta)
+		snapshot.EndpointSlices = append(snapshot.EndpointSlices, stripped)
+	}
+
+	// Only the owners and pod templates of the controllers of pods are needed.
+	for _, replicaSet := range state.ReplicaSets.Items {
+		snapshot.ReplicaSets = append(snapshot.ReplicaSets, apps.ReplicaSet{
+			TypeMeta:   metav1.TypeMeta{APIVersion: apps.SchemeGroupVersion.String(), Kind: "ReplicaSet"},
+			ObjectMeta: stripMeta(&replicaSet.ObjectMeta),
+			Spec:       apps.ReplicaSetSpec{Template: stripTemplate(&replicaSet.Spec.Template)},
+		})
+	}
+
+	for _, job := range state.Jobs.Items {
+		snapshot.Jobs = append(snapshot.Jobs, batch.Job{
+			TypeMeta:   metav1.TypeMeta{APIVersion: batch.SchemeGroupVersion.String(), Kind: "Job"},
+			ObjectMeta: stripMeta(&job.ObjectMeta),
+			Spec:       batch.JobSpec{Template: stripTemplate(&job.Spec.Template)},
+		})
+	}
+
+	for _, deployment := range state.Deployments.Items {
+		snapshot.Deployments = append(snapshot.Deployments, apps.Deployment{
+			TypeMeta:   metav1.TypeMeta{APIVersion: apps.SchemeGroupVersion.String(), Kind: "Deployment"},
+			ObjectMeta: stripMeta(&deployment.ObjectMeta),
+			Spec:       apps.DeploymentSpec{Template: stripTemplate(&deployment.Spec.Template)},
+		})
+	}
+
+	for _, statefulSet := range state.StatefulSets.Items {
+		snapshot.StatefulSets = append(snapshot.StatefulSets, apps.StatefulSet{
+			TypeMeta:   metav1.TypeMeta{APIVersion: apps.SchemeGroupVersion.String(), Kind: "StatefulSet"},
+			ObjectMeta: stripMeta(&statefulSet.ObjectMeta),
+			Spec:       apps.StatefulSetSpec{Template: stripTemplate(&statefulSet.Spec.Template)},
+		})
+	}
+
+	for _, daemonSet := range state.DaemonSets.Items {
+		snapshot.DaemonSets = append(snapshot.DaemonSets, apps.DaemonSet{
+			TypeMeta:   metav1.TypeMeta{APIVersion: apps.SchemeGroupVersion.String(), Kind: "DaemonSet"},
+			ObjectMeta: stripMeta(&daemonSet.ObjectMeta),
+			Spec:       apps.DaemonSetSpec{Template: stripTemplate(&daemonSet.Spec.Template)},
+		})
+	}
+
+	for _, cronJob := range state.CronJobs.Items {
+		stripped := batchv1beta1.CronJob{
+			TypeMeta:   metav1.TypeMeta{APIVersion: batchv1beta1.SchemeGroupVersion.String(), Kind: "CronJob"},
+			ObjectMeta: stripMeta(&cronJob.ObjectMeta),
+		}
+		stripped.Spec.JobTemplate.Spec.Template = stripTemplate(&cronJob.Spec.JobTemplate.Spec.Template)
+		snapshot.CronJobs = append(snapshot.CronJobs, stripped)
+	}
+
+	return snapshot
+}
+
+// stripMeta keeps the identity, labels, annotations and owners of an object.
+func stripMeta(meta *metav1.ObjectMeta) metav1.ObjectMeta {
+	stripped := metav1.ObjectMeta{
+		Name:              meta.Name,
+		Namespace:         meta.Namespace,
+		UID:               meta.UID,
+		CreationTimestamp: meta.CreationTimestamp,
+		DeletionTimestamp: meta.DeletionTimestamp,
+		Labels:            meta.Labels,
+		OwnerReferences:   meta.OwnerReferences,
+	}
+	for k, v := range meta.Annotations {
+		if k == lastAppliedAnnotation {
+			continue
+		}
+		if stripped.Annotations == nil {
+			stripped.Annotations = map[string]string{}
+		}
+		stripped.Annotations[k] = v
+	}
+	return stripped
+}
+
+// stripPodSpec keeps the node, the host network and the names and ports of the containers of a pod.
+func stripPodSpec(spec *api.PodSpec) api.PodSpec {
+	stripped := api.PodSpec{
+		NodeName:    spec.NodeName,
+		HostNetwork: spec.HostNetwork,
+	}
+	for _, container := range spec.Containers {
+		stripped.Containers = append(stripped.Containers, api.Container{
+			Name:  container.Name,
+			Ports: container.Ports,
+		})
+	}
+	return stripped
+}
+
+// stripTemplate keeps the labels and the stripped spec of a pod template.
+func stripTemplate(template *api.PodTemplateSpec) api.PodTemplateSpec {
+	return api.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: template.Labels,
+		},
+		Spec: stripPodSpec(&template.Spec),
+	}
+}
+
+// State returns the State captured by the snapshot.
+func (s *Snapshot) State() *State {
+	state := &State{}
+	state.Namespaces.Items = append(state.Namespaces.Items, s.Namespaces...)
+	state.Pods.Items = append(state.Pods.Items, s.Pods...)
+	state.Policies.Items = append(state.Policies.Items, s.Policies...)
+	state.Services.Items = append(state.Services.Items, s.Services...)
+	state.EndpointSlices.Items = append(state.EndpointSlices.Items, s.EndpointSlices...)
+	state.ReplicaSets.Items = append(state.ReplicaSets.Items, s.ReplicaSets...)
+	state.Jobs.Items = append(state.Jobs.Items, s.Jobs...)
+	state.Deployments.Items = append(state.Deployments.Items, s.Deployments...)
+	state.StatefulSets.Items = append(state.StatefulSets.Items, s.StatefulSets...)
+	state.DaemonSets.Items = append(state.DaemonSets.Items, s.DaemonSets...)
+	state.CronJobs.Items = append(state.CronJobs.Items, s.CronJobs...)
+	return state
+}
+
+// Clientset returns an in-memory Kubernetes client serving the objects of the snapshot,
+// so that anything working on a live cluster can replay it.
+func (s *Snapshot) Clientset() kubernetes.Interface {
+	objects := []runtime.Object{}
+	for i := range s.Namespaces {
+		objects = append(objects, &s.Namespaces[i])
+	}
+	for i := range s.Pods {
+		objects = append(objects, &s.Pods[i])
+	}
+	for i := range s.Policies {
+		objects = append(objects, &s.Policies[i])
+	}
+	for i := range s.Services {
+		objects = append(objects, &s.Services[i])
+	}
+	for i := range s.EndpointSlices {
+		objects = append(objects, &s.EndpointSlices[i])
+	}
+	for i := range s.ReplicaSets {
+		objects = append(objects, &s.ReplicaSets[i])
+	}
+	for i := range s.Jobs {
+		objects = append(objects, &s.Jobs[i])
+	}
+	for i := range s.Deployments {
+		objects = append(objects, &s.Deployments[i])
+	}
+	for i := range s.StatefulSets {
+		objects = append(objects, &s.StatefulSets[i])
+	}
+	for i := range s.DaemonSets {
+		objects = append(objects, &s.DaemonSets[i])
+	}
+	for i := range s.CronJobs {
+		objects = append(objects, &s.CronJobs[i])
+	}
+	return fake.NewSimpleClientset(objects...)
+}
+
+// SaveSnapshot writes the snapshot as JSON to the file, compressed with gzip if its name ends with .gz.
+func SaveSnapshot(file string, snapshot *Snapshot) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = f
+	var gz *gzip.Writer
+	if strings.HasSuffix(file, ".gz") {
+		gz = gzip.NewWriter(f)
+		w = gz
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(snapshot); err != nil {
+		f.Close()
+		return err
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// LoadSnapshot reads a snapshot written by SaveSnapshot, compressed or not.
+func LoadSnapshot(file string) (*Snapshot, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var reader io.Reader = r
+	if magic, err := r.Peek(2); err == nil && bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		reader = gz
+	}
+
+	snapshot := &Snapshot{}
+	if err := json.NewDecoder(reader).Decode(snapshot); err != nil {
+		return nil, fmt.Errorf("invalid snapshot %s: %v", file, err)
+	}
+	if snapshot.Version != SnapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %d in %s, expected %d", snapshot.Version, file, SnapshotVersion)
+	}
+	return snapshot, nil
+}
+
+// LoadPath returns the State saved in a snapshot file, or the State of the manifest files of the path otherwise.
+func LoadPath(path string) (*State, error) {
+	if isSnapshot(path) {
+		snapshot, err := LoadSnapshot(path)
+		if err != nil {
+			return nil, err
+		}
+		return snapshot.State(), nil
+	}
+	return LoadManifests(path)
+}
+
+// isSnapshot returns true if the file is gzipped or a JSON document with a version and no kind.
+func isSnapshot(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return false
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	if bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+		return true
+	}
+	header := struct {
+		Version int    `json:"version"`
+		Kind    string `json:"kind"`
+	}{}
+	return json.Unmarshal(data, &header) == nil && header.Version > 0 && header.Kind == ""
+}
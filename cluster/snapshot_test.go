@@ -0,0 +1,89 @@
+package cluster
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	api "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSnapshot(t *testing.T) {
+	state, err := LoadManifests("testdata")
+	if err != nil {
+		t.Fatalf("Error loading manifests: %s", err)
+	}
+	state.Pods.Items[0].ManagedFields = []metav1.ManagedFieldsEntry{{Manager: "kubectl"}}
+	state.Pods.Items[0].Annotations = map[string]string{lastAppliedAnnotation: "{}"}
+	state.Pods.Items[0].Spec.Containers = []api.Container{{
+		Name:  "nginx",
+		Env:   []api.EnvVar{{Name: "PASSWORD", Value: "secret"}},
+		Ports: []api.ContainerPort{{Name: "http", ContainerPort: 80}},
+	}}
+	state.Pods.Items[0].Status.Conditions = []api.PodCondition{{Type: api.PodReady}}
+	state.Pods.Items[0].Status.PodIP = "10.0.0.1"
+
+	dir, err := ioutil.TempDir("", "kubepox")
+	if err != nil {
+		t.Fatalf("Error creating directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"snapshot.json", "snapshot.json.gz"} {
+		t.Log("Testing ", name)
+		file := filepath.Join(dir, name)
+		if err := SaveSnapshot(file, NewSnapshot(state)); err != nil {
+			t.Fatalf("Error saving snapshot: %s", err)
+		}
+		snapshot, err := LoadSnapshot(file)
+		if err != nil {
+			t.Fatalf("Error loading snapshot: %s", err)
+		}
+
+		loaded := snapshot.State()
+		pod := loaded.Pod("web", "frontend")
+		if pod == nil {
+			t.Fatalf("Couldn't find pod web/frontend in %+v", loaded.Pods.Items)
+		}
+		if len(pod.ManagedFields) != 0 || len(pod.Annotations) != 0 || len(pod.Status.Conditions) != 0 {
+			t.Errorf("Pod %+v isn't stripped", pod)
+		}
+		if len(pod.Spec.Containers) != 1 || len(pod.Spec.Containers[0].Env) != 0 || pod.Spec.Containers[0].Ports[0].Name != "http" {
+			t.Errorf("Got containers %+v expected nginx with port http only", pod.Spec.Containers)
+		}
+		if pod.Status.PodIP != "10.0.0.1" || pod.Labels["role"] != "frontend" {
+			t.Errorf("Pod %+v lost its labels or IP", pod)
+		}
+		if loaded.Policy("web", "deny") == nil || len(loaded.Namespaces.Items) != 1 {
+			t.Errorf("Got state %+v expected the policies and namespaces of the manifests", loaded)
+		}
+
+		// The snapshot replays as a live cluster.
+		replayed, err := Load(context.Background(), snapshot.Clientset(), "web")
+		if err != nil {
+			t.Fatalf("Error loading state: %s", err)
+		}
+		if replayed.Pod("web", "frontend") == nil || replayed.Policy("web", "deny") == nil || replayed.Service("web", "frontend") == nil {
+			t.Errorf("Got replayed state %+v expected the objects of the snapshot", replayed)
+		}
+	}
+}
+
+func TestLoadSnapshotVersion(t *testing.T) {
+	file, err := ioutil.TempFile("", "kubepox")
+	if err != nil {
+		t.Fatalf("Error creating file: %s", err)
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.WriteString(`{"version": 42}`); err != nil {
+		t.Fatalf("Error writing file: %s", err)
+	}
+	file.Close()
+
+	if _, err := LoadSnapshot(file.Name()); err == nil {
+		t.Errorf("Loaded a snapshot with an unsupported version")
+	}
+}
@@ -0,0 +1,256 @@
+// Package cluster gathers the Kubernetes objects evaluated by kubepox,
+// either from a live cluster or from manifest files.
+package cluster
+
+import (
+	"context"
+	"sort"
+
+	apps "k8s.io/api/apps/v1"
+	batch "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	api "k8s.io/api/core/v1"
+	discovery "k8s.io/api/discovery/v1beta1"
+	networking "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// State holds the objects needed to evaluate NetworkPolicies.
+type State struct {
+	Namespaces api.NamespaceList
+	Pods       api.PodList
+	Policies   networking.NetworkPolicyList
+	// Services and EndpointSlices are only used to resolve the backends of Services.
+	Services       api.ServiceList
+	EndpointSlices discovery.EndpointSliceList
+	// ReplicaSets and Jobs are only used to find the workloads owning pods.
+	ReplicaSets apps.ReplicaSetList
+	Jobs        batch.JobList
+	// Deployments, StatefulSets, DaemonSets and CronJobs are only used for the pod templates of workloads
+	// that have no pod yet.
+	Deployments  apps.DeploymentList
+	StatefulSets apps.StatefulSetList
+	DaemonSets   apps.DaemonSetList
+	CronJobs     batchv1beta1.CronJobList
+	// Locations are the positions of the NetworkPolicies loaded from manifest files, by namespace/name.
+	Locations map[string]Location
+}
+
+// Source provides the State to evaluate.
+type Source interface {
+	State() (*State, error)
+}
+
+// StaticSource is a Source that always returns the same State.
+type StaticSource struct {
+	state *State
+}
+
+// NewStaticSource returns a Source for a State that never changes, such as loaded manifests.
+func NewStaticSource(state *State) *StaticSource {
+	return &StaticSource{
+		state: state,
+	}
+}
+
+// State implements Source.
+func (s *StaticSource) State() (*State, error) {
+	return s.state, nil
+}
+
+// Load retrieves the current State from the Kubernetes API.
+// An empty namespace retrieves the objects of all the namespaces.
+// Namespaces, Services, EndpointSlices and the controllers of pods are only used to resolve selectors, Services and workloads:
+// the State is still returned if they can't be listed.
+func Load(ctx context.Context, client kubernetes.Interface, namespace string) (*State, error) {
+	state := &State{}
+
+	namespaces, err := client.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	if err != nil && !errors.IsForbidden(err) {
+		return nil, err
+	}
+	if namespaces != nil {
+		state.Namespaces = *namespaces
+	}
+
+	pods, err := client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	state.Pods = *pods
+
+	policies, err := client.NetworkingV1().NetworkPolicies(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	state.Policies = *policies
+
+	services, err := client.CoreV1().Services(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil && !errors.IsForbidden(err) {
+		return nil, err
+	}
+	if services != nil {
+		state.Services = *services
+	}
+
+	// EndpointSlices are not served by clusters older than Kubernetes 1.17.
+	slices, err := client.DiscoveryV1beta1().EndpointSlices(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil && !errors.IsForbidden(err) && !errors.IsNotFound(err) {
+		return nil, err
+	}
+	if slices != nil {
+		state.EndpointSlices = *slices
+	}
+
+	replicaSets, err := client.AppsV1().ReplicaSets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil && !errors.IsForbidden(err) {
+		return nil, err
+	}
+	if replicaSets != nil {
+		state.ReplicaSets = *replicaSets
+	}
+
+	jobs, err := client.BatchV1().Jobs(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil && !errors.IsForbidden(err) {
+		return nil, err
+	}
+	if jobs != nil {
+		state.Jobs = *jobs
+	}
+
+	deployments, err := client.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil && !errors.IsForbidden(err) {
+		return nil, err
+	}
+	if deployments != nil {
+		state.Deployments = *deployments
+	}
+
+	statefulSets, err := client.AppsV1().StatefulSets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil && !errors.IsForbidden(err) {
+		return nil, err
+	}
+	if statefulSets != nil {
+		state.StatefulSets = *statefulSets
+	}
+
+	daemonSets, err := client.AppsV1().DaemonSets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil && !errors.IsForbidden(err) {
+		return nil, err
+	}
+	if daemonSets != nil {
+		state.DaemonSets = *daemonSets
+	}
+
+	// CronJobs are served by batch/v1beta1 until Kubernetes 1.21 and may be removed from it later.
+	cronJobs, err := client.BatchV1beta1().CronJobs(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil && !errors.IsForbidden(err) && !errors.IsNotFound(err) {
+		return nil, err
+	}
+	if cronJobs != nil {
+		state.CronJobs = *cronJobs
+	}
+
+	return state, nil
+}
+
+// Sort orders the objects of the State by namespace and name, so that results are stable.
+func (s *State) Sort() {
+	sort.Slice(s.Namespaces.Items, func(i, j int) bool {
+		return s.Namespaces.Items[i].Name < s.Namespaces.Items[j].Name
+	})
+	sort.Slice(s.Pods.Items, func(i, j int) bool {
+		return lessObject(&s.Pods.Items[i].ObjectMeta, &s.Pods.Items[j].ObjectMeta)
+	})
+	sort.Slice(s.Policies.Items, func(i, j int) bool {
+		return lessObject(&s.Policies.Items[i].ObjectMeta, &s.Policies.Items[j].ObjectMeta)
+	})
+	sort.Slice(s.Services.Items, func(i, j int) bool {
+		return lessObject(&s.Services.Items[i].ObjectMeta, &s.Services.Items[j].ObjectMeta)
+	})
+	sort.Slice(s.EndpointSlices.Items, func(i, j int) bool {
+		return lessObject(&s.EndpointSlices.Items[i].ObjectMeta, &s.EndpointSlices.Items[j].ObjectMeta)
+	})
+}
+
+func lessObject(a, b *metav1.ObjectMeta) bool {
+	if a.Namespace != b.Namespace {
+		return a.Namespace < b.Namespace
+	}
+	return a.Name < b.Name
+}
+
+// Namespace returns the namespace with the given name, nil if it isn't part of the State.
+func (s *State) Namespace(name string) *api.Namespace {
+	for i := range s.Namespaces.Items {
+		if s.Namespaces.Items[i].Name == name {
+			return &s.Namespaces.Items[i]
+		}
+	}
+	return nil
+}
+
+// Pod returns the pod with the given namespace and name, nil if it doesn't exist.
+func (s *State) Pod(namespace, name string) *api.Pod {
+	for i := range s.Pods.Items {
+		if s.Pods.Items[i].Namespace == namespace && s.Pods.Items[i].Name == name {
+			return &s.Pods.Items[i]
+		}
+	}
+	return nil
+}
+
+// Policy returns the NetworkPolicy with the given namespace and name, nil if it doesn't exist.
+func (s *State) Policy(namespace, name string) *networking.NetworkPolicy {
+	for i := range s.Policies.Items {
+		if s.Policies.Items[i].Namespace == namespace && s.Policies.Items[i].Name == name {
+			return &s.Policies.Items[i]
+		}
+	}
+	return nil
+}
+
+// Service returns the Service with the given namespace and name, nil if it doesn't exist.
+func (s *State) Service(namespace, name string) *api.Service {
+	for i := range s.Services.Items {
+		if s.Services.Items[i].Namespace == namespace && s.Services.Items[i].Name == name {
+			return &s.Services.Items[i]
+		}
+	}
+	return nil
+}
+
+// PodsInNamespace returns the pods of a namespace.
+func (s *State) PodsInNamespace(namespace string) *api.PodList {
+	pods := &api.PodList{
+		Items: []api.Pod{},
+	}
+	for _, pod := range s.Pods.Items {
+		if pod.Namespace == namespace {
+			pods.Items = append(pods.Items, pod)
+		}
+	}
+	return pods
+}
+
+// PodByIP returns the pod owning the IP, nil if no pod owns it.
+// Pods on the host network and terminated pods don't own their IP.
+func (s *State) PodByIP(ip string) *api.Pod {
+	for i := range s.Pods.Items {
+		pod := &s.Pods.Items[i]
+		if pod.Spec.HostNetwork || pod.Status.Phase == api.PodSucceeded || pod.Status.Phase == api.PodFailed {
+			continue
+		}
+		if pod.Status.PodIP == ip {
+			return pod
+		}
+		for _, podIP := range pod.Status.PodIPs {
+			if podIP.IP == ip {
+				return pod
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package cluster
+
+import (
+	"context"
+	"testing"
+
+	api "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestLoadManifests(t *testing.T) {
+	state, err := LoadManifests("testdata")
+	if err != nil {
+		t.Fatalf("Error loading manifests: %s", err)
+	}
+
+	if len(state.Namespaces.Items) != 1 || state.Namespaces.Items[0].Labels["team"] != "web" {
+		t.Errorf("Got namespaces %+v expected web", state.Namespaces.Items)
+	}
+	if state.Pod("web", "frontend") == nil {
+		t.Errorf("Couldn't find pod web/frontend in %+v", state.Pods.Items)
+	}
+	if len(state.Pods.Items) != 1 {
+		t.Errorf("Got %d pods expected 1", len(state.Pods.Items))
+	}
+	if state.Policy("web", "deny") == nil {
+		t.Errorf("Couldn't find policy web/deny in %+v", state.Policies.Items)
+	}
+	if state.Policy("default", "nonamespace") == nil {
+		t.Errorf("Couldn't find policy default/nonamespace in %+v", state.Policies.Items)
+	}
+	if state.Service("web", "frontend") == nil {
+		t.Errorf("Couldn't find service web/frontend in %+v", state.Services.Items)
+	}
+	if len(state.Deployments.Items) != 1 || state.Deployments.Items[0].Namespace != "default" {
+		t.Errorf("Got deployments %+v expected default/backend", state.Deployments.Items)
+	}
+	if location := state.Locations["web/deny"]; location != (Location{File: "testdata/manifests.yaml", Line: 45}) {
+		t.Errorf("Got location %+v of web/deny expected testdata/manifests.yaml:45", location)
+	}
+	if location := state.Locations["default/nonamespace"]; location.Line != 52 {
+		t.Errorf("Got location %+v of default/nonamespace expected line 52", location)
+	}
+}
+
+func TestManifestLocations(t *testing.T) {
+	manifest := `# Policies of the web namespace
+apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: deny
+  namespace: web
+spec:
+  podSelector: {}
+---
+
+# Second document
+apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: allow
+  namespace: web
+spec:
+  podSelector: {}
+`
+	state := &State{}
+	if err := state.addManifestFile("policies.yaml", []byte(manifest)); err != nil {
+		t.Fatalf("Error adding manifest: %s", err)
+	}
+	expected := map[string]Location{
+		"web/deny":  Location{File: "policies.yaml", Line: 2},
+		"web/allow": Location{File: "policies.yaml", Line: 12},
+	}
+	for policy, location := range expected {
+		if state.Locations[policy] != location {
+			t.Errorf("Got location %+v of %s expected %+v", state.Locations[policy], policy, location)
+		}
+	}
+}
+
+func TestManifestSeparators(t *testing.T) {
+	manifest := `apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: deny
+  namespace: web
+spec:
+  podSelector: {}
+--- # A list, whose first policy selects pods by a label named name
+apiVersion: v1
+kind: List
+items:
+- apiVersion: networking.k8s.io/v1
+  kind: NetworkPolicy
+  metadata:
+    name: first
+    namespace: web
+  spec:
+    podSelector:
+      matchLabels:
+        name: second
+- apiVersion: networking.k8s.io/v1
+  kind: NetworkPolicy
+  metadata:
+    labels:
+      name: second
+    name: second
+    namespace: web
+  spec:
+    podSelector: {}
+--- !!map
+apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: tagged
+  namespace: web
+spec:
+  podSelector: {}
+`
+	state := &State{}
+	if err := state.addManifestFile("policies.yaml", []byte(manifest)); err != nil {
+		t.Fatalf("Error adding manifest: %s", err)
+	}
+	expected := map[string]Location{
+		"web/deny":   Location{File: "policies.yaml", Line: 1},
+		"web/first":  Location{File: "policies.yaml", Line: 15},
+		"web/second": Location{File: "policies.yaml", Line: 26},
+		"web/tagged": Location{File: "policies.yaml", Line: 30},
+	}
+	if len(state.Policies.Items) != len(expected) {
+		t.Errorf("Got %d policies expected %d", len(state.Policies.Items), len(expected))
+	}
+	for policy, location := range expected {
+		if state.Locations[policy] != location {
+			t.Errorf("Got location %+v of %s expected %+v", state.Locations[policy], policy, location)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		&api.Pod{ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "x"}},
+		&api.Pod{ObjectMeta: metav1.ObjectMeta{Name: "b", Namespace: "y"}},
+		&api.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "x"}},
+	)
+
+	state, err := Load(context.Background(), client, "x")
+	if err != nil {
+		t.Fatalf("Error loading state: %s", err)
+	}
+	if len(state.Pods.Items) != 1 || state.Pod("x", "a") == nil {
+		t.Errorf("Got pods %+v expected x/a", state.Pods.Items)
+	}
+	if len(state.Namespaces.Items) != 1 {
+		t.Errorf("Got %d namespaces expected 1", len(state.Namespaces.Items))
+	}
+}
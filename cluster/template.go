@@ -0,0 +1,108 @@
+package cluster
+
+import (
+	"github.com/aporeto-inc/kubepox"
+
+	api "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// TemplateAnnotation is set on the pods synthesized from pod templates, to the workload of the template.
+const TemplateAnnotation = "kubepox.aporeto.io/template"
+
+// Template is the pod template of a workload.
+type Template struct {
+	Workload Workload
+	Template *api.PodTemplateSpec
+}
+
+// Templates returns the pod templates of the workloads of the State: Deployments, StatefulSets, DaemonSets
+// and CronJobs, and the ReplicaSets and Jobs not owned by another controller.
+func (s *State) Templates() []Template {
+	templates := []Template{}
+	add := func(kind string, meta *metav1.ObjectMeta, template *api.PodTemplateSpec) {
+		templates = append(templates, Template{
+			Workload: Workload{Kind: kind, Namespace: meta.Namespace, Name: meta.Name},
+			Template: template,
+		})
+	}
+	for i := range s.Deployments.Items {
+		add(KindDeployment, &s.Deployments.Items[i].ObjectMeta, &s.Deployments.Items[i].Spec.Template)
+	}
+	for i := range s.StatefulSets.Items {
+		add(KindStatefulSet, &s.StatefulSets.Items[i].ObjectMeta, &s.StatefulSets.Items[i].Spec.Template)
+	}
+	for i := range s.DaemonSets.Items {
+		add(KindDaemonSet, &s.DaemonSets.Items[i].ObjectMeta, &s.DaemonSets.Items[i].Spec.Template)
+	}
+	for i := range s.CronJobs.Items {
+		add(KindCronJob, &s.CronJobs.Items[i].ObjectMeta, &s.CronJobs.Items[i].Spec.JobTemplate.Spec.Template)
+	}
+	for i := range s.ReplicaSets.Items {
+		if metav1.GetControllerOf(&s.ReplicaSets.Items[i]) == nil {
+			add(KindReplicaSet, &s.ReplicaSets.Items[i].ObjectMeta, &s.ReplicaSets.Items[i].Spec.Template)
+		}
+	}
+	for i := range s.Jobs.Items {
+		if metav1.GetControllerOf(&s.Jobs.Items[i]) == nil {
+			add(KindJob, &s.Jobs.Items[i].ObjectMeta, &s.Jobs.Items[i].Spec.Template)
+		}
+	}
+	return templates
+}
+
+// WorkloadTemplate returns the pod template of the workload, nil if the State has none.
+func (s *State) WorkloadTemplate(workload Workload) *Template {
+	for _, template := range s.Templates() {
+		if template.Workload == workload {
+			return &template
+		}
+	}
+	return nil
+}
+
+// Pod synthesizes a pod of the template, named after its workload and owned by it,
+// so that the workload of the pod is the workload of the template.
+func (t *Template) Pod() *api.Pod {
+	controller := true
+	pod := kubepox.PodFromTemplate(t.Template, t.Workload.Namespace)
+	pod.Name = t.Workload.Name
+	pod.OwnerReferences = []metav1.OwnerReference{{Kind: t.Workload.Kind, Name: t.Workload.Name, Controller: &controller}}
+	if pod.Annotations == nil {
+		pod.Annotations = map[string]string{}
+	}
+	pod.Annotations[TemplateAnnotation] = t.Workload.String()
+	return pod
+}
+
+// IsTemplatePod returns true if the pod was synthesized from a pod template.
+func IsTemplatePod(pod *api.Pod) bool {
+	_, ok := pod.Annotations[TemplateAnnotation]
+	return ok
+}
+
+// PendingPods returns a pod synthesized from the template of every workload of the State without any pod,
+// such as the workloads of manifests that are not applied yet.
+func (s *State) PendingPods() *api.PodList {
+	pods := &api.PodList{
+		Items: []api.Pod{},
+	}
+	for _, template := range s.Templates() {
+		if len(s.WorkloadPods(template.Workload).Items) == 0 {
+			pods.Items = append(pods.Items, *template.Pod())
+		}
+	}
+	return pods
+}
+
+// ResolveWorkload returns the pods of the workload or, when it has none, a pod synthesized from its template.
+// The list is empty if the workload has neither pods nor template.
+func (s *State) ResolveWorkload(workload Workload) *api.PodList {
+	pods := s.WorkloadPods(workload)
+	if len(pods.Items) == 0 {
+		if template := s.WorkloadTemplate(workload); template != nil {
+			pods.Items = append(pods.Items, *template.Pod())
+		}
+	}
+	return pods
+}
@@ -0,0 +1,88 @@
+package cluster
+
+import (
+	"testing"
+
+	apps "k8s.io/api/apps/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	api "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func podTemplate(labels map[string]string) api.PodTemplateSpec {
+	return api.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: labels,
+		},
+		Spec: api.PodSpec{
+			Containers: []api.Container{{Name: "main"}},
+		},
+	}
+}
+
+func TestTemplates(t *testing.T) {
+	controller := true
+	state := &State{}
+	state.Pods.Items = []api.Pod{
+		ownedPod("frontend-7d4b9-abcde", KindReplicaSet, "frontend-7d4b9", map[string]string{"pod-template-hash": "7d4b9", "role": "frontend"}),
+	}
+	state.Deployments.Items = []apps.Deployment{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "frontend", Namespace: "web"},
+			Spec:       apps.DeploymentSpec{Template: podTemplate(map[string]string{"role": "frontend"})},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "web"},
+			Spec:       apps.DeploymentSpec{Template: podTemplate(map[string]string{"role": "api"})},
+		},
+	}
+	state.ReplicaSets.Items = []apps.ReplicaSet{
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            "api-5f6c7",
+				Namespace:       "web",
+				OwnerReferences: []metav1.OwnerReference{{Kind: KindDeployment, Name: "api", Controller: &controller}},
+			},
+			Spec: apps.ReplicaSetSpec{Template: podTemplate(map[string]string{"role": "api"})},
+		},
+	}
+	cronJob := batchv1beta1.CronJob{ObjectMeta: metav1.ObjectMeta{Name: "backup", Namespace: "web"}}
+	cronJob.Spec.JobTemplate.Spec.Template = podTemplate(map[string]string{"role": "backup"})
+	state.CronJobs.Items = []batchv1beta1.CronJob{cronJob}
+
+	// The ReplicaSet of a Deployment is not a template of its own.
+	if templates := state.Templates(); len(templates) != 3 {
+		t.Errorf("Got templates %+v expected deployment/frontend, deployment/api and cronjob/backup", templates)
+	}
+
+	pending := state.PendingPods()
+	if len(pending.Items) != 2 {
+		t.Fatalf("Got pending pods %+v expected api and backup", pending.Items)
+	}
+	pod := &pending.Items[0]
+	if pod.Name != "api" || pod.Namespace != "web" || pod.Labels["role"] != "api" || !IsTemplatePod(pod) {
+		t.Errorf("Got pod %+v expected web/api synthesized from its template", pod)
+	}
+	if workload := state.WorkloadOf(pod); workload.String() != "deployment/api" {
+		t.Errorf("Got workload %s for the pod of the template expected deployment/api", workload)
+	}
+	if IsTemplatePod(&state.Pods.Items[0]) {
+		t.Errorf("Pod %s is not synthesized from a template", state.Pods.Items[0].Name)
+	}
+
+	workload, _ := ParseWorkload("cj/backup", "web")
+	if template := state.WorkloadTemplate(workload); template == nil || template.Pod().Labels["role"] != "backup" {
+		t.Errorf("Got template %+v for cj/backup expected the template of the CronJob", template)
+	}
+	if pods := state.ResolveWorkload(workload); len(pods.Items) != 1 || !IsTemplatePod(&pods.Items[0]) {
+		t.Errorf("Got pods %+v for cj/backup expected the pod of its template", pods.Items)
+	}
+	workload, _ = ParseWorkload("deploy/frontend", "web")
+	if pods := state.ResolveWorkload(workload); len(pods.Items) != 1 || IsTemplatePod(&pods.Items[0]) {
+		t.Errorf("Got pods %+v for deploy/frontend expected its running pod", pods.Items)
+	}
+	workload, _ = ParseWorkload("deploy/unknown", "web")
+	if template := state.WorkloadTemplate(workload); template != nil {
+		t.Errorf("Got template %+v for an unknown deployment", template)
+	}
+}
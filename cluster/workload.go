@@ -0,0 +1,224 @@
+package cluster
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aporeto-inc/kubepox"
+
+	api "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Kinds of workloads.
+const (
+	KindPod         = "Pod"
+	KindDeployment  = "Deployment"
+	KindReplicaSet  = "ReplicaSet"
+	KindStatefulSet = "StatefulSet"
+	KindDaemonSet   = "DaemonSet"
+	KindJob         = "Job"
+	KindCronJob     = "CronJob"
+)
+
+// kindAliases maps the names of kinds accepted in workload references, as kubectl does, to kinds.
+var kindAliases = map[string]string{
+	"po":           KindPod,
+	"pod":          KindPod,
+	"pods":         KindPod,
+	"deploy":       KindDeployment,
+	"deployment":   KindDeployment,
+	"deployments":  KindDeployment,
+	"rs":           KindReplicaSet,
+	"replicaset":   KindReplicaSet,
+	"replicasets":  KindReplicaSet,
+	"sts":          KindStatefulSet,
+	"statefulset":  KindStatefulSet,
+	"statefulsets": KindStatefulSet,
+	"ds":           KindDaemonSet,
+	"daemonset":    KindDaemonSet,
+	"daemonsets":   KindDaemonSet,
+	"job":          KindJob,
+	"jobs":         KindJob,
+	"cj":           KindCronJob,
+	"cronjob":      KindCronJob,
+	"cronjobs":     KindCronJob,
+}
+
+// Workload is the top level controller owning pods, or a pod owned by no controller.
+type Workload struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+}
+
+// String returns kind/name, the kind in lower case as in kubectl references.
+func (w Workload) String() string {
+	return strings.ToLower(w.Kind) + "/" + w.Name
+}
+
+// ParseWorkload parses a workload reference: kind/name, such as deploy/web, or the name of a pod.
+// The workload is in the given namespace.
+func ParseWorkload(ref, namespace string) (Workload, error) {
+	i := strings.Index(ref, "/")
+	if i < 0 {
+		return Workload{Kind: KindPod, Namespace: namespace, Name: ref}, nil
+	}
+	kind, ok := kindAliases[strings.ToLower(ref[:i])]
+	if !ok {
+		return Workload{}, fmt.Errorf("unknown workload kind %q in %q", ref[:i], ref)
+	}
+	return Workload{Kind: kind, Namespace: namespace, Name: ref[i+1:]}, nil
+}
+
+// ParseQualifiedWorkload parses a workload reference that may start with its namespace: [namespace/]name
+// or [namespace/]kind/name. Without a namespace, the workload is in the given namespace.
+func ParseQualifiedWorkload(ref, namespace string) (Workload, error) {
+	parts := strings.Split(ref, "/")
+	switch len(parts) {
+	case 2:
+		if _, err := ParseWorkload(ref, namespace); err != nil {
+			return ParseWorkload(parts[1], parts[0])
+		}
+	case 3:
+		return ParseWorkload(parts[1]+"/"+parts[2], parts[0])
+	}
+	return ParseWorkload(ref, namespace)
+}
+
+// WorkloadOf returns the workload owning the pod, walking the owners of its controller:
+// ReplicaSets up to their Deployment and Jobs up to their CronJob.
+// When the ReplicaSet is not part of the State, its Deployment is inferred from the pod-template-hash label.
+func (s *State) WorkloadOf(pod *api.Pod) Workload {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return Workload{Kind: KindPod, Namespace: pod.Namespace, Name: pod.Name}
+	}
+	workload := Workload{Kind: owner.Kind, Namespace: pod.Namespace, Name: owner.Name}
+
+	switch owner.Kind {
+	case KindReplicaSet:
+		for i := range s.ReplicaSets.Items {
+			replicaSet := &s.ReplicaSets.Items[i]
+			if replicaSet.Namespace == pod.Namespace && replicaSet.Name == owner.Name {
+				if parent := metav1.GetControllerOf(replicaSet); parent != nil {
+					workload.Kind, workload.Name = parent.Kind, parent.Name
+				}
+				return workload
+			}
+		}
+		if hash := pod.Labels["pod-template-hash"]; hash != "" && strings.HasSuffix(owner.Name, "-"+hash) {
+			workload.Kind, workload.Name = KindDeployment, strings.TrimSuffix(owner.Name, "-"+hash)
+		}
+	case KindJob:
+		for i := range s.Jobs.Items {
+			job := &s.Jobs.Items[i]
+			if job.Namespace == pod.Namespace && job.Name == owner.Name {
+				if parent := metav1.GetControllerOf(job); parent != nil {
+					workload.Kind, workload.Name = parent.Kind, parent.Name
+				}
+				return workload
+			}
+		}
+	}
+	return workload
+}
+
+// WorkloadPods returns the pods of the workload, sorted by name.
+// Intermediate controllers are workloads as well: a ReplicaSet of a Deployment returns its own pods only,
+// and a pod is the workload of itself, even when owned by a controller.
+func (s *State) WorkloadPods(workload Workload) *api.PodList {
+	pods := &api.PodList{
+		Items: []api.Pod{},
+	}
+	for i := range s.Pods.Items {
+		pod := &s.Pods.Items[i]
+		if pod.Namespace != workload.Namespace {
+			continue
+		}
+		owner := metav1.GetControllerOf(pod)
+		switch {
+		case workload.Kind == KindPod && pod.Name == workload.Name,
+			owner != nil && owner.Kind == workload.Kind && owner.Name == workload.Name,
+			s.WorkloadOf(pod) == workload:
+			pods.Items = append(pods.Items, *pod)
+		}
+	}
+	sort.Slice(pods.Items, func(i, j int) bool {
+		return pods.Items[i].Name < pods.Items[j].Name
+	})
+	return pods
+}
+
+// revisionAnnotation is set by the Deployment controller on its ReplicaSets, numbering the revisions of its pod template.
+const revisionAnnotation = "deployment.kubernetes.io/revision"
+
+// WorkloadPod returns the pod evaluated for the whole workload, nil if the workload has neither pods nor template.
+// The pods of a workload share their labels, except during a rollout: the pods of the newest revision, the ones
+// that remain once the rollout is done, are preferred. The revision of a pod is the revision of its ReplicaSet,
+// then its creation time. Enforceable pods are preferred to the others, and a workload without any pod is
+// evaluated with a pod synthesized from its pod template.
+func (s *State) WorkloadPod(workload Workload) *api.Pod {
+	pods := s.ResolveWorkload(workload)
+	var best *api.Pod
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if best == nil || s.newerPod(pod, best) {
+			best = pod
+		}
+	}
+	return best
+}
+
+// newerPod returns true if the pod a is preferred to b to evaluate their workload.
+func (s *State) newerPod(a, b *api.Pod) bool {
+	if enforceable := kubepox.ClassifyPod(a).Enforceable(); enforceable != kubepox.ClassifyPod(b).Enforceable() {
+		return enforceable
+	}
+	if ra, rb := s.podRevision(a), s.podRevision(b); ra != rb {
+		return ra > rb
+	}
+	return b.CreationTimestamp.Before(&a.CreationTimestamp)
+}
+
+// podRevision returns the revision of the ReplicaSet owning the pod, 0 if it is unknown.
+func (s *State) podRevision(pod *api.Pod) int64 {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil || owner.Kind != KindReplicaSet {
+		return 0
+	}
+	for i := range s.ReplicaSets.Items {
+		replicaSet := &s.ReplicaSets.Items[i]
+		if replicaSet.Namespace == pod.Namespace && replicaSet.Name == owner.Name {
+			revision, _ := strconv.ParseInt(replicaSet.Annotations[revisionAnnotation], 10, 64)
+			return revision
+		}
+	}
+	return 0
+}
+
+// WorkloadGroup is a workload and its pods out of a list.
+type WorkloadGroup struct {
+	Workload Workload `json:"workload"`
+	Pods     []string `json:"pods"`
+}
+
+// GroupByWorkload groups the pods of the list by workload, in the order of their first pod.
+func (s *State) GroupByWorkload(pods *api.PodList) []WorkloadGroup {
+	groups := []WorkloadGroup{}
+	index := map[Workload]int{}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		workload := s.WorkloadOf(pod)
+		j, ok := index[workload]
+		if !ok {
+			j = len(groups)
+			index[workload] = j
+			groups = append(groups, WorkloadGroup{Workload: workload, Pods: []string{}})
+		}
+		groups[j].Pods = append(groups[j].Pods, pod.Name)
+	}
+	return groups
+}
@@ -0,0 +1,179 @@
+package cluster
+
+import (
+	"testing"
+
+	apps "k8s.io/api/apps/v1"
+	batch "k8s.io/api/batch/v1"
+	api "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func ownedPod(name, kind, owner string, labels map[string]string) api.Pod {
+	controller := true
+	return api.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       "web",
+			Labels:          labels,
+			OwnerReferences: []metav1.OwnerReference{{Kind: kind, Name: owner, Controller: &controller}},
+		},
+	}
+}
+
+func TestWorkloads(t *testing.T) {
+	controller := true
+	state := &State{}
+	state.Pods.Items = []api.Pod{
+		ownedPod("frontend-7d4b9-abcde", KindReplicaSet, "frontend-7d4b9", map[string]string{"pod-template-hash": "7d4b9"}),
+		ownedPod("frontend-7d4b9-fghij", KindReplicaSet, "frontend-7d4b9", map[string]string{"pod-template-hash": "7d4b9"}),
+		ownedPod("api-5f6c7-abcde", KindReplicaSet, "api-5f6c7", map[string]string{"pod-template-hash": "5f6c7"}),
+		ownedPod("db-0", KindStatefulSet, "db", nil),
+		ownedPod("backup-1600000000-abcde", KindJob, "backup-1600000000", nil),
+		{ObjectMeta: metav1.ObjectMeta{Name: "debug", Namespace: "web"}},
+	}
+	state.ReplicaSets.Items = []apps.ReplicaSet{{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "api-5f6c7",
+			Namespace:       "web",
+			OwnerReferences: []metav1.OwnerReference{{Kind: KindDeployment, Name: "api-server", Controller: &controller}},
+		},
+	}}
+	state.Jobs.Items = []batch.Job{{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "backup-1600000000",
+			Namespace:       "web",
+			OwnerReferences: []metav1.OwnerReference{{Kind: KindCronJob, Name: "backup", Controller: &controller}},
+		},
+	}}
+
+	type testStruct struct {
+		Pod      string
+		Workload string
+	}
+
+	tests := []testStruct{
+		testStruct{Pod: "frontend-7d4b9-abcde", Workload: "deployment/frontend"},
+		testStruct{Pod: "api-5f6c7-abcde", Workload: "deployment/api-server"},
+		testStruct{Pod: "db-0", Workload: "statefulset/db"},
+		testStruct{Pod: "backup-1600000000-abcde", Workload: "cronjob/backup"},
+		testStruct{Pod: "debug", Workload: "pod/debug"},
+	}
+
+	for i, test := range tests {
+		t.Log("Testing WorkloadOf ", i)
+		if workload := state.WorkloadOf(state.Pod("web", test.Pod)); workload.String() != test.Workload {
+			t.Errorf("Got workload %s for pod %s expected %s", workload, test.Pod, test.Workload)
+		}
+	}
+
+	groups := state.GroupByWorkload(&state.Pods)
+	if len(groups) != 5 || len(groups[0].Pods) != 2 {
+		t.Errorf("Got groups %+v expected 5 with 2 pods for the frontend", groups)
+	}
+
+	type refStruct struct {
+		Ref  string
+		Pods int
+	}
+
+	refs := []refStruct{
+		refStruct{Ref: "deploy/frontend", Pods: 2},
+		refStruct{Ref: "rs/frontend-7d4b9", Pods: 2},
+		refStruct{Ref: "cj/backup", Pods: 1},
+		refStruct{Ref: "job/backup-1600000000", Pods: 1},
+		refStruct{Ref: "db-0", Pods: 1},
+		refStruct{Ref: "sts/unknown", Pods: 0},
+	}
+
+	for i, test := range refs {
+		t.Log("Testing WorkloadPods ", i)
+		workload, err := ParseWorkload(test.Ref, "web")
+		if err != nil {
+			t.Errorf("Error parsing %s: %s", test.Ref, err)
+			continue
+		}
+		if pods := state.WorkloadPods(workload); len(pods.Items) != test.Pods {
+			t.Errorf("Got %d pods for %s expected %d", len(pods.Items), test.Ref, test.Pods)
+		}
+	}
+
+	type qualifiedStruct struct {
+		Ref       string
+		Namespace string
+		Workload  string
+	}
+
+	qualified := []qualifiedStruct{
+		qualifiedStruct{Ref: "db-0", Namespace: "web", Workload: "pod/db-0"},
+		qualifiedStruct{Ref: "deploy/frontend", Namespace: "web", Workload: "deployment/frontend"},
+		qualifiedStruct{Ref: "prod/db-0", Namespace: "prod", Workload: "pod/db-0"},
+		qualifiedStruct{Ref: "prod/sts/db", Namespace: "prod", Workload: "statefulset/db"},
+	}
+
+	for i, test := range qualified {
+		t.Log("Testing ParseQualifiedWorkload ", i)
+		workload, err := ParseQualifiedWorkload(test.Ref, "web")
+		if err != nil || workload.Namespace != test.Namespace || workload.String() != test.Workload {
+			t.Errorf("Got workload %+v error %v for %s expected %s in %s", workload, err, test.Ref, test.Workload, test.Namespace)
+		}
+	}
+
+	if _, err := ParseWorkload("svc/api", "web"); err == nil {
+		t.Errorf("Parsed a reference to a service as a workload")
+	}
+}
+
+func TestWorkloadPod(t *testing.T) {
+	controller := true
+	replicaSet := func(name, revision string) apps.ReplicaSet {
+		return apps.ReplicaSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            name,
+				Namespace:       "web",
+				Annotations:     map[string]string{revisionAnnotation: revision},
+				OwnerReferences: []metav1.OwnerReference{{Kind: KindDeployment, Name: "api", Controller: &controller}},
+			},
+		}
+	}
+	running := func(pod api.Pod, created int64) api.Pod {
+		pod.CreationTimestamp = metav1.Unix(created, 0)
+		pod.Status = api.PodStatus{Phase: api.PodRunning, PodIP: "10.0.0.1"}
+		return pod
+	}
+
+	state := &State{}
+	state.ReplicaSets.Items = []apps.ReplicaSet{replicaSet("api-9", "9"), replicaSet("api-10", "10")}
+	state.Pods.Items = []api.Pod{
+		running(ownedPod("api-10-a", KindReplicaSet, "api-10", nil), 100),
+		running(ownedPod("api-9-a", KindReplicaSet, "api-9", nil), 200),
+		// The pod of the newest revision that is not scheduled yet.
+		ownedPod("api-10-b", KindReplicaSet, "api-10", nil),
+		running(ownedPod("worker-a", KindStatefulSet, "worker", nil), 100),
+		running(ownedPod("worker-b", KindStatefulSet, "worker", nil), 200),
+	}
+
+	type testStruct struct {
+		Ref string
+		Pod string
+	}
+
+	tests := []testStruct{
+		testStruct{Ref: "deploy/api", Pod: "api-10-a"},
+		testStruct{Ref: "rs/api-9", Pod: "api-9-a"},
+		testStruct{Ref: "sts/worker", Pod: "worker-b"},
+		testStruct{Ref: "sts/unknown", Pod: ""},
+	}
+
+	for i, test := range tests {
+		t.Log("Testing WorkloadPod ", i)
+		workload, _ := ParseWorkload(test.Ref, "web")
+		pod := state.WorkloadPod(workload)
+		switch {
+		case pod == nil && test.Pod != "":
+			t.Errorf("Got no pod for %s expected %s", test.Ref, test.Pod)
+		case pod != nil && pod.Name != test.Pod:
+			t.Errorf("Got pod %s for %s expected %q", pod.Name, test.Ref, test.Pod)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/aporeto-inc/kubepox"
+	"github.com/aporeto-inc/kubepox/graph"
+	"github.com/spf13/cobra"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// newBlastRadiusCommand reports the pods reachable from a compromised pod.
+func newBlastRadiusCommand(o *rootOptions) *cobra.Command {
+	var (
+		flags     stateFlags
+		maxHops   int
+		sensitive string
+		output    string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "blast-radius <pod> [--hops N] [--sensitive <selector>]",
+		Short: "Report the pods reachable from a compromised pod by hopping from pod to pod",
+		Long: `Compute the blast radius of a compromised pod: the pods it can connect to, then the pods those can
+connect to, and so on within the given number of hops, following the connections the policies allow.
+Every pod is reported with one of the shortest paths to it and the ports allowed on each hop.
+
+Pods matching the --sensitive label selector, such as databases, are flagged. The pod is given as name in
+the namespace of the query, or as namespace/name; a workload, such as deploy/web, stands for one of its pods.
+
+The objects of all the namespaces are evaluated.`,
+		Example: `  kubepox -n web blast-radius frontend --sensitive tier=data
+  kubepox blast-radius web/deploy/api --hops 2 -f manifests/`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if output != "table" && output != "json" {
+				return fmt.Errorf("unknown output format %q", output)
+			}
+			if maxHops < 0 {
+				return fmt.Errorf("invalid number of hops %d", maxHops)
+			}
+			var selector labels.Selector
+			if sensitive != "" {
+				var err error
+				selector, err = labels.Parse(sensitive)
+				if err != nil {
+					return fmt.Errorf("invalid selector %q: %v", sensitive, err)
+				}
+			}
+
+			namespace, err := o.namespace()
+			if err != nil {
+				return err
+			}
+			flags.allNamespaces = true
+			state, err := o.loadState(&flags)
+			if err != nil {
+				return err
+			}
+
+			source, err := podRef(state, args[0], namespace)
+			if err != nil {
+				return fmt.Errorf("Couldn't find source pod: %v", err)
+			}
+
+			g := graph.New(state)
+			radius, err := g.BlastRadius(kubepox.PodEndpoint(source).String(), maxHops, selector)
+			if err != nil {
+				return fmt.Errorf("Error evaluating connectivity: %v", err)
+			}
+
+			if output == "json" {
+				pp, _ := json.MarshalIndent(radius, "", "   ")
+				fmt.Println(string(pp))
+				return nil
+			}
+			return renderBlastRadius(radius)
+		},
+	}
+	cmd.Flags().StringSliceVarP(&flags.manifests, "manifests", "f", nil, "Evaluate the objects of manifest files or directories instead of a live cluster")
+	cmd.Flags().IntVar(&maxHops, "hops", 0, "Maximum number of hops, 0 for no limit")
+	cmd.Flags().StringVar(&sensitive, "sensitive", "", "Label selector of the sensitive pods, such as tier=data")
+	cmd.Flags().StringVarP(&output, "output", "o", "table", "Output format: table or json")
+
+	return cmd
+}
+
+func renderBlastRadius(radius *graph.BlastRadius) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "POD\tHOPS\tSENSITIVE\tPATH")
+	for _, reach := range radius.Reachable {
+		sensitive := ""
+		if reach.Sensitive {
+			sensitive = "yes"
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", reach.Pod, reach.Hops, sensitive, renderPath(reach.Path))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Println()
+	fmt.Printf("%d pods reachable from %s, %d sensitive\n", len(radius.Reachable), radius.Source, len(radius.Sensitive()))
+	return nil
+}
+
+// renderPath renders the hops of a path as pod -(ports)-> pod -(ports)-> pod.
+func renderPath(path []graph.Hop) string {
+	if len(path) == 0 {
+		return ""
+	}
+	parts := []string{path[0].From}
+	for _, hop := range path {
+		ports := []string{}
+		for _, port := range hop.Ports {
+			ports = append(ports, port.String())
+		}
+		parts = append(parts, fmt.Sprintf("-(%s)-> %s", strings.Join(ports, ","), hop.To))
+	}
+	return strings.Join(parts, " ")
+}
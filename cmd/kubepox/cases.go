@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/aporeto-inc/kubepox/casegen"
+	"github.com/spf13/cobra"
+
+	"sigs.k8s.io/yaml"
+)
+
+// newGenerateCasesCommand generates the connectivity test cases of the policies, and the manifests probing them.
+func newGenerateCasesCommand(o *rootOptions) *cobra.Command {
+	var (
+		flags  stateFlags
+		dns    dnsFlags
+		output string
+		image  string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "generate-cases",
+		Short: "Generate the connectivity test cases exercising every rule of the policies",
+		Long: `Generate the connectivity test cases exercising every rule and every negative path of the policies,
+with the verdict expected by kubepox.
+
+With -o probes, the manifests of the synthesized namespaces and pods are generated along with a Job
+per case, connecting from the source to the destination of the case. The Job of a case expected to be
+allowed must succeed, the Job of a case expected to be denied must fail. The expected verdict is in
+the kubepox.io/expect annotation of the Job.
+
+The probes resolve their destination through DNS: the Jobs whose source is isolated for egress are
+labeled kubepox.io/probe-dns=true, and a kubepox-probe-dns policy allowing them, and only them, to reach
+the DNS pods is generated in their namespace. The DNS pods and their namespace are found as by
+scaffold default-deny.
+
+The probes can be applied along with the tested policies, in any order: a probe waits for its destination
+to resolve, gives the network plugin time to program the policies, then connects. Every probe fails after
+a deadline.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if output != "json" && output != "yaml" && output != "probes" {
+				return fmt.Errorf("unknown output format %q", output)
+			}
+
+			state, err := o.loadState(&flags)
+			if err != nil {
+				return err
+			}
+
+			list, err := casegen.Generate(&state.Policies, &state.Namespaces)
+			if err != nil {
+				return fmt.Errorf("Error generating cases: %v", err)
+			}
+
+			switch output {
+			case "probes":
+				options := casegen.ProbeOptions{Image: image}
+				options.DNSNamespaceSelector, options.DNSPodSelector, err = o.dnsSelectors(&dns, state, &flags)
+				if err != nil {
+					return err
+				}
+				manifests, err := casegen.ProbeManifests(list, &state.Policies, options)
+				if err != nil {
+					return fmt.Errorf("Error generating probes: %v", err)
+				}
+				objects := []interface{}{}
+				for _, object := range manifests {
+					objects = append(objects, object)
+				}
+				return renderManifests(objects...)
+			case "yaml":
+				out, err := yaml.Marshal(list)
+				if err != nil {
+					return err
+				}
+				fmt.Print(string(out))
+			default:
+				pp, _ := json.MarshalIndent(list, "", "   ")
+				fmt.Println(string(pp))
+			}
+			return nil
+		},
+	}
+	flags.addFlags(cmd.Flags())
+	cmd.Flags().StringVarP(&output, "output", "o", "json", "Output format: json, yaml or probes")
+	cmd.Flags().StringVar(&image, "image", casegen.DefaultProbeImage, "Image of the probe pods, providing the agnhost porter and connect commands")
+	dns.addFlags(cmd.Flags())
+
+	return cmd
+}
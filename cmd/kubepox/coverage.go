@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/aporeto-inc/kubepox/coverage"
+	"github.com/spf13/cobra"
+)
+
+// newCoverageCommand reports, per namespace, the pods that are not isolated by any policy.
+func newCoverageCommand(o *rootOptions) *cobra.Command {
+	var (
+		flags      stateFlags
+		output     string
+		byWorkload bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "coverage",
+		Short: "Report, per namespace, the pods not isolated for ingress or egress",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if output != "table" && output != "json" {
+				return fmt.Errorf("unknown output format %q", output)
+			}
+
+			state, err := o.loadState(&flags)
+			if err != nil {
+				return err
+			}
+
+			namespaces, err := coverage.Compute(state, flags.allNamespaces || len(flags.manifests) > 0, byWorkload)
+			if err != nil {
+				return fmt.Errorf("Error computing coverage: %v", err)
+			}
+
+			if output == "json" {
+				pp, _ := json.MarshalIndent(namespaces, "", "   ")
+				fmt.Println(string(pp))
+				return nil
+			}
+			return renderCoverage(namespaces)
+		},
+	}
+	flags.addFlags(cmd.Flags())
+	cmd.Flags().StringVarP(&output, "output", "o", "table", "Output format: table or json")
+	addByWorkloadFlag(cmd, &byWorkload)
+
+	return cmd
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+func renderCoverage(namespaces []*coverage.Namespace) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "NAMESPACE\tPODS\tINGRESS\tEGRESS\tDEFAULT-DENY INGRESS\tDEFAULT-DENY EGRESS")
+	for _, c := range namespaces {
+		fmt.Fprintf(w, "%s\t%d\t%.0f%%\t%.0f%%\t%s\t%s\n", c.Namespace, c.Pods, c.IngressCoverage, c.EgressCoverage, yesNo(c.IngressDefaultDeny), yesNo(c.EgressDefaultDeny))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	for _, c := range namespaces {
+		if len(c.PodsNotIngressIsolated) == 0 && len(c.PodsNotEgressIsolated) == 0 && len(c.PodsUnenforceable) == 0 {
+			continue
+		}
+		fmt.Printf("\nNamespace %s:\n", c.Namespace)
+		if len(c.PodsNotIngressIsolated) > 0 {
+			fmt.Printf("  not isolated for ingress: %s\n", strings.Join(c.PodsNotIngressIsolated, ", "))
+		}
+		if len(c.PodsNotEgressIsolated) > 0 {
+			fmt.Printf("  not isolated for egress: %s\n", strings.Join(c.PodsNotEgressIsolated, ", "))
+		}
+		if len(c.PodsUnenforceable) > 0 {
+			fmt.Printf("  not governed by policies: %s\n", strings.Join(c.PodsUnenforceable, ", "))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/aporeto-inc/kubepox/cluster"
+	"github.com/aporeto-inc/kubepox/diff"
+	"github.com/spf13/cobra"
+)
+
+// newDiffCommand compares the policies and connectivity of two states.
+func newDiffCommand(o *rootOptions) *cobra.Command {
+	var (
+		output   string
+		exitCode bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "diff <before> <after>",
+		Short: "Compare the policies and connectivity of two snapshots or manifest directories",
+		Long: `Compare two states, each a snapshot saved by snapshot save or manifest files or directories, and report
+the policies added, removed or changed, the pods whose set of selecting policies changed, and the flows
+between pods that became allowed or denied.
+
+Flows are evaluated between the pods existing in both states, and the allowed flows from or to the pods
+added in the second state are reported as now allowed. They are evaluated on the ports declared by the containers
+of the destination and the numeric ports of the policies, any port standing for the rule ports with a
+protocol but no number. The markdown output is suitable for a pull request comment.`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if output != "text" && output != "json" && output != "markdown" {
+				return fmt.Errorf("unknown output format %q", output)
+			}
+
+			before, err := cluster.LoadPath(args[0])
+			if err != nil {
+				return fmt.Errorf("Couldn't load %s: %v", args[0], err)
+			}
+			after, err := cluster.LoadPath(args[1])
+			if err != nil {
+				return fmt.Errorf("Couldn't load %s: %v", args[1], err)
+			}
+
+			report, err := diff.Compare(before, after)
+			if err != nil {
+				return fmt.Errorf("Error comparing states: %v", err)
+			}
+
+			switch output {
+			case "json":
+				pp, _ := json.MarshalIndent(report, "", "   ")
+				fmt.Println(string(pp))
+			case "markdown":
+				renderDiffMarkdown(report)
+			default:
+				if err := renderDiff(report); err != nil {
+					return err
+				}
+			}
+
+			if exitCode && !report.Empty() {
+				return fmt.Errorf("the states differ")
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&output, "output", "o", "text", "Output format: text, json or markdown")
+	cmd.Flags().BoolVar(&exitCode, "exit-code", false, "Fail if the states differ")
+
+	return cmd
+}
+
+func renderDiff(report *diff.Report) error {
+	if report.Empty() {
+		fmt.Println("No change")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	if len(report.Policies) > 0 {
+		fmt.Fprintln(w, "POLICY\tCHANGE")
+		for _, p := range report.Policies {
+			fmt.Fprintf(w, "%s/%s\t%s\n", p.Namespace, p.Name, p.Kind)
+		}
+		fmt.Fprintln(w)
+	}
+	if len(report.Pods) > 0 {
+		fmt.Fprintln(w, "POD\tPOLICIES BEFORE\tPOLICIES AFTER")
+		for _, p := range report.Pods {
+			fmt.Fprintf(w, "%s/%s\t%s\t%s\n", p.Namespace, p.Name, policyList(p.Before), policyList(p.After))
+		}
+		fmt.Fprintln(w)
+	}
+	if len(report.Peers) > 0 {
+		fmt.Fprintln(w, "PEERS\tRULE\tPOD")
+		for _, p := range report.Peers {
+			fmt.Fprintf(w, "%s\t%s/%s %s rule %d\t%s\n", p.Kind, p.Namespace, p.Name, p.Direction, p.Rule, p.Pod)
+		}
+		fmt.Fprintln(w)
+	}
+	if len(report.Flows) > 0 {
+		fmt.Fprintln(w, "FLOW\tSOURCE\tDESTINATION\tPORT\tVERDICT")
+		for _, f := range report.Flows {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", f.Kind, f.Source, f.Destination, flowPort(f), explainVerdict(f.Verdict))
+		}
+	}
+	return w.Flush()
+}
+
+func renderDiffMarkdown(report *diff.Report) {
+	fmt.Println("### NetworkPolicy diff")
+	fmt.Println()
+	if report.Empty() {
+		fmt.Println("No change to the policies or the connectivity.")
+		return
+	}
+
+	allowed, denied := 0, 0
+	for _, f := range report.Flows {
+		if f.Kind == diff.NowAllowed {
+			allowed++
+		} else {
+			denied++
+		}
+	}
+	fmt.Printf("%d policies changed, %d pods selected differently, %d flows now allowed, %d flows now denied.\n", len(report.Policies), len(report.Pods), allowed, denied)
+
+	if len(report.Policies) > 0 {
+		fmt.Println()
+		fmt.Println("| Policy | Change |")
+		fmt.Println("| --- | --- |")
+		for _, p := range report.Policies {
+			fmt.Printf("| `%s/%s` | %s |\n", p.Namespace, p.Name, p.Kind)
+		}
+	}
+	if len(report.Pods) > 0 {
+		fmt.Println()
+		fmt.Println("| Pod | Policies before | Policies after |")
+		fmt.Println("| --- | --- | --- |")
+		for _, p := range report.Pods {
+			fmt.Printf("| `%s/%s` | %s | %s |\n", p.Namespace, p.Name, policyList(p.Before), policyList(p.After))
+		}
+	}
+	if len(report.Flows) > 0 {
+		fmt.Println()
+		fmt.Println("| Flow | Source | Destination | Port | Verdict |")
+		fmt.Println("| --- | --- | --- | --- | --- |")
+		for _, f := range report.Flows {
+			icon := ":white_check_mark:"
+			if f.Kind == diff.NowDenied {
+				icon = ":no_entry:"
+			}
+			fmt.Printf("| %s %s | `%s` | `%s` | %s | %s |\n", icon, f.Kind, f.Source, f.Destination, flowPort(f), explainVerdict(f.Verdict))
+		}
+	}
+}
+
+func policyList(policies []string) string {
+	if len(policies) == 0 {
+		return "none"
+	}
+	return strings.Join(policies, ", ")
+}
+
+// flowPort returns protocol/port, port 0 standing for any port.
+func flowPort(f diff.FlowChange) string {
+	if f.Port == 0 {
+		return f.Protocol + "/any"
+	}
+	return fmt.Sprintf("%s/%d", f.Protocol, f.Port)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aporeto-inc/kubepox"
+	"github.com/aporeto-inc/kubepox/cluster"
+	"github.com/spf13/pflag"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// dnsFlags select the DNS pods that generated policies allow to reach.
+type dnsFlags struct {
+	namespaceSelector string
+	podSelector       string
+}
+
+func (f *dnsFlags) addFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&f.namespaceSelector, "dns-namespace-selector", "", "Label selector of the namespace of the DNS pods. Found from the namespace of the DNS pods by default")
+	flags.StringVar(&f.podSelector, "dns-pod-selector", "k8s-app=kube-dns", "Label selector of the DNS pods")
+}
+
+// dnsSelectors returns the namespace and pod selectors of the DNS pods. Without --dns-namespace-selector, the
+// namespace is the one of the DNS pods, looked up in the State, or in the cluster when the State is not
+// loaded from manifests and doesn't hold them.
+func (o *rootOptions) dnsSelectors(f *dnsFlags, state *cluster.State, sf *stateFlags) (*metav1.LabelSelector, *metav1.LabelSelector, error) {
+	pods, err := metav1.ParseToLabelSelector(f.podSelector)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid DNS pod selector: %v", err)
+	}
+	if f.namespaceSelector != "" {
+		namespaces, err := metav1.ParseToLabelSelector(f.namespaceSelector)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid DNS namespace selector: %v", err)
+		}
+		return namespaces, pods, nil
+	}
+
+	namespaces, err := kubepox.DNSNamespaceSelector(pods, &state.Pods, &state.Namespaces)
+	if err != nil && len(sf.manifests) == 0 {
+		// The State may be restricted to a namespace other than the one of the DNS pods.
+		client, clientErr := o.clientset()
+		if clientErr != nil {
+			return nil, nil, fmt.Errorf("Error creating REST Kube Client: %v", clientErr)
+		}
+		dnsPods, listErr := client.CoreV1().Pods("").List(context.Background(), metav1.ListOptions{LabelSelector: f.podSelector})
+		if listErr == nil {
+			namespaces, err = kubepox.DNSNamespaceSelector(pods, dnsPods, &state.Namespaces)
+		}
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("Couldn't find the namespace of the DNS pods: %v. Set --dns-namespace-selector", err)
+	}
+	return namespaces, pods, nil
+}
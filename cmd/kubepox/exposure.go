@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/aporeto-inc/kubepox/exposure"
+	"github.com/spf13/cobra"
+)
+
+// newExposureCommand reports the pods exposed to the internet.
+func newExposureCommand(o *rootOptions) *cobra.Command {
+	var (
+		flags      stateFlags
+		private    []string
+		directions []string
+		output     string
+		exitCode   bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "exposure",
+		Short: "Report the pods accepting connections from, or allowed to connect to, the internet",
+		Long: `Report the pods exposed to the internet: for ingress, the pods accepting connections from the internet,
+and for egress, the pods allowed to connect to it.
+
+A pod is exposed when it is not isolated in the direction, when a rule of a policy selecting it has no
+peer, or when a rule has an ipBlock covering public addresses once its except ranges and the private
+ranges are left out. The private ranges default to the private, shared, loopback and link-local ranges
+and can be replaced, for example to add the ranges of a corporate network.`,
+		Example: `  kubepox exposure -A
+  kubepox exposure -f manifests/ --direction ingress --exit-code
+  kubepox exposure -n web --private 10.0.0.0/8,192.168.0.0/16,198.51.100.0/24`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if output != "table" && output != "json" {
+				return fmt.Errorf("unknown output format %q", output)
+			}
+			ingress, egress := false, false
+			for _, direction := range directions {
+				switch direction {
+				case exposure.Ingress:
+					ingress = true
+				case exposure.Egress:
+					egress = true
+				default:
+					return fmt.Errorf("unknown direction %q", direction)
+				}
+			}
+			ranges, err := exposure.ParseRanges(private)
+			if err != nil {
+				return err
+			}
+
+			state, err := o.loadState(&flags)
+			if err != nil {
+				return err
+			}
+
+			report, err := exposure.Analyze(state, exposure.Options{PrivateRanges: ranges})
+			if err != nil {
+				return fmt.Errorf("Error analyzing exposure: %v", err)
+			}
+			if !ingress {
+				report.Ingress = []exposure.Finding{}
+			}
+			if !egress {
+				report.Egress = []exposure.Finding{}
+			}
+
+			if output == "json" {
+				pp, _ := json.MarshalIndent(report, "", "   ")
+				fmt.Println(string(pp))
+			} else if err := renderExposure(report); err != nil {
+				return err
+			}
+
+			if exitCode && len(report.Ingress)+len(report.Egress) > 0 {
+				return fmt.Errorf("pods are exposed to the internet")
+			}
+			return nil
+		},
+	}
+	flags.addFlags(cmd.Flags())
+	cmd.Flags().StringSliceVar(&private, "private", exposure.DefaultPrivateRanges, "Ranges that are not part of the internet")
+	cmd.Flags().StringSliceVar(&directions, "direction", []string{exposure.Ingress, exposure.Egress}, "Directions to report: ingress, egress or both")
+	cmd.Flags().StringVarP(&output, "output", "o", "table", "Output format: table or json")
+	cmd.Flags().BoolVar(&exitCode, "exit-code", false, "Fail if a pod is exposed")
+
+	return cmd
+}
+
+func renderExposure(report *exposure.Report) error {
+	findings := append(append([]exposure.Finding{}, report.Ingress...), report.Egress...)
+	if len(findings) == 0 {
+		fmt.Println("No pod exposed to the internet")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "DIRECTION\tPOD\tREASON\tRULE\tCIDR\tPORTS")
+	for _, f := range findings {
+		rule := ""
+		if f.Policy != "" {
+			rule = fmt.Sprintf("%s %s rule %d", f.Policy, f.Direction, f.Rule)
+		}
+		ports := "all"
+		if len(f.Ports) > 0 {
+			ports = strings.Join(f.Ports, ",")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", f.Direction, f.Pod, f.Reason, rule, f.CIDR, ports)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/aporeto-inc/kubepox"
+	"github.com/aporeto-inc/kubepox/flows"
+	"github.com/spf13/cobra"
+)
+
+// newCheckFlowsCommand checks observed flow records against the verdicts of the policies.
+func newCheckFlowsCommand(o *rootOptions) *cobra.Command {
+	var (
+		flags  stateFlags
+		format string
+		output string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "check-flows <file>...",
+		Short: "Check observed flows against the verdicts of the policies",
+		Long: `Check the flows observed on the cluster against the verdicts of the policies, for the pods owning
+the source and destination addresses, and report the flows the CNI allowed while the policies deny them
+and the flows the CNI denied while the policies allow them.
+
+Flows are read from the files given as arguments, - reading the standard input. The jsonl format has
+one flow per line:
+
+  {"time":"2020-09-01T10:00:00Z","src":"10.0.0.1","dst":"10.0.0.2","port":5432,"protocol":"TCP","verdict":"allowed"}
+
+The hubble format reads the output of hubble observe -o json.
+
+The command fails if any flow doesn't match the policies.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if output != "table" && output != "json" {
+				return fmt.Errorf("unknown output format %q", output)
+			}
+
+			observed := []flows.Flow{}
+			for _, file := range args {
+				read, err := readFlows(file, format)
+				if err != nil {
+					return fmt.Errorf("Couldn't read flows from %s: %v", file, err)
+				}
+				observed = append(observed, read...)
+			}
+
+			state, err := o.loadState(&flags)
+			if err != nil {
+				return err
+			}
+
+			report, err := flows.Check(observed, state)
+			if err != nil {
+				return fmt.Errorf("Error checking flows: %v", err)
+			}
+
+			if output == "json" {
+				pp, _ := json.MarshalIndent(report, "", "   ")
+				fmt.Println(string(pp))
+			} else if err := renderFlowReport(report); err != nil {
+				return err
+			}
+
+			if len(report.Mismatches) > 0 {
+				return fmt.Errorf("%d mismatches between the flows and the policies", len(report.Mismatches))
+			}
+			return nil
+		},
+	}
+	flags.addFlags(cmd.Flags())
+	cmd.Flags().StringVar(&format, "format", flows.FormatJSONLines, "Format of the flow records: jsonl or hubble")
+	cmd.Flags().StringVarP(&output, "output", "o", "table", "Output format: table or json")
+
+	return cmd
+}
+
+// readFlows reads the flows of a file, - being the standard input.
+func readFlows(file, format string) ([]flows.Flow, error) {
+	var r io.Reader = os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	return flows.Read(r, format)
+}
+
+func renderFlowReport(report *flows.Report) error {
+	fmt.Printf("%d flows read, %d checked, %d between unknown addresses, %d mismatches\n", report.Flows, report.Checked, report.Unresolved, len(report.Mismatches))
+	if len(report.Mismatches) == 0 {
+		return nil
+	}
+
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "MISMATCH\tSOURCE\tDESTINATION\tPORT\tCOUNT\tLAST SEEN\tPOLICY VERDICT")
+	for _, m := range report.Mismatches {
+		lastSeen := "-"
+		if m.LastSeen != nil {
+			lastSeen = m.LastSeen.Format("2006-01-02T15:04:05Z07:00")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s/%d\t%d\t%s\t%s\n", m.Kind, m.Source, m.Destination, m.Protocol, m.Port, m.Count, lastSeen, explainVerdict(m.Verdict))
+	}
+	return w.Flush()
+}
+
+// explainVerdict describes why the policies allow or deny a flow.
+func explainVerdict(verdict *kubepox.Verdict) string {
+	if verdict.Allowed {
+		policies := append(append([]string{}, verdict.EgressPolicies...), verdict.IngressPolicies...)
+		if len(policies) == 0 {
+			return "not isolated"
+		}
+		return "allowed by " + strings.Join(policies, ", ")
+	}
+	switch {
+	case !verdict.EgressAllowed && !verdict.IngressAllowed:
+		return "denied for egress and ingress"
+	case !verdict.EgressAllowed:
+		return "denied for egress"
+	default:
+		return "denied for ingress"
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aporeto-inc/kubepox"
+	"github.com/aporeto-inc/kubepox/cluster"
+	"github.com/spf13/cobra"
+
+	api "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// newGetAllCommand displays all policies or all pods. Similar to kubectl describe in json.
+func newGetAllCommand(o *rootOptions) *cobra.Command {
+	var (
+		exclude    []string
+		byWorkload bool
+	)
+
+	cmd := &cobra.Command{
+		Use:       "get-all (policies|pods)",
+		Short:     "Retrieve all the NetworkPolicies or Pods of the namespace",
+		Args:      cobra.ExactValidArgs(1),
+		ValidArgs: []string{"policies", "pods"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := o.clientset()
+			if err != nil {
+				return fmt.Errorf("Error creating REST Kube Client: %v", err)
+			}
+			namespace, err := o.namespace()
+			if err != nil {
+				return err
+			}
+			ctx := context.Background()
+
+			if args[0] == "policies" {
+				policies, err := client.NetworkingV1().NetworkPolicies(namespace).List(ctx, metav1.ListOptions{})
+				if err != nil {
+					return fmt.Errorf("Couldn't get Network Policy: %v", err)
+				}
+				renderPolicies(policies)
+				return nil
+			}
+
+			filter, err := podFilter(exclude)
+			if err != nil {
+				return err
+			}
+			if byWorkload {
+				state, err := cluster.Load(ctx, client, namespace)
+				if err != nil {
+					return fmt.Errorf("Couldn't get all the pods %v", err)
+				}
+				return renderWorkloads(state.GroupByWorkload(kubepox.FilterPods(&state.Pods, filter)))
+			}
+			pods, err := client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+			if err != nil {
+				return fmt.Errorf("Couldn't get all the pods %v", err)
+			}
+			renderPods(kubepox.FilterPods(pods, filter))
+			return nil
+		},
+	}
+	addExcludeFlag(cmd, &exclude)
+	addByWorkloadFlag(cmd, &byWorkload)
+
+	return cmd
+}
+
+// newGetPodsCommand displays all the pods that get affected by a policy.
+func newGetPodsCommand(o *rootOptions) *cobra.Command {
+	var (
+		exclude    []string
+		byWorkload bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "get-pods <policy>",
+		Short: "Retrieve the pods affected by a NetworkPolicy",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := o.clientset()
+			if err != nil {
+				return fmt.Errorf("Error creating REST Kube Client: %v", err)
+			}
+			namespace, err := o.namespace()
+			if err != nil {
+				return err
+			}
+			ctx := context.Background()
+
+			filter, err := podFilter(exclude)
+			if err != nil {
+				return err
+			}
+			np, err := client.NetworkingV1().NetworkPolicies(namespace).Get(ctx, args[0], metav1.GetOptions{})
+			if err != nil {
+				return fmt.Errorf("Couldn't get Network Policy: %v", err)
+			}
+			state, err := cluster.Load(ctx, client, namespace)
+			if err != nil {
+				return fmt.Errorf("Couldn't get all the pods %v", err)
+			}
+			matchedPods, err := kubepox.ListPodsPerPolicy(np, kubepox.FilterPods(&state.Pods, filter))
+			if err != nil {
+				return fmt.Errorf("Error getting matching pods: %v", err)
+			}
+			fmt.Printf("Matched pods for policy %s :\n", np.Name)
+			if byWorkload {
+				return renderWorkloads(state.GroupByWorkload(matchedPods))
+			}
+			renderPods(matchedPods)
+			return nil
+		},
+	}
+	addExcludeFlag(cmd, &exclude)
+	addByWorkloadFlag(cmd, &byWorkload)
+
+	return cmd
+}
+
+// newGetPoliciesCommand displays all the policies that get applied to a pod.
+func newGetPoliciesCommand(o *rootOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "get-policies (<pod>|<kind>/<workload>)",
+		Short: "Retrieve the NetworkPolicies that apply to a pod or a workload, such as deploy/web",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := o.clientset()
+			if err != nil {
+				return fmt.Errorf("Error creating REST Kube Client: %v", err)
+			}
+			namespace, err := o.namespace()
+			if err != nil {
+				return err
+			}
+			ctx := context.Background()
+
+			pod, err := getPod(ctx, client, namespace, args[0])
+			if err != nil {
+				return fmt.Errorf("Couldn't get target pod %v", err)
+			}
+			allPolicies, err := client.NetworkingV1().NetworkPolicies(namespace).List(ctx, metav1.ListOptions{})
+			if err != nil {
+				return fmt.Errorf("Couldn't get all Network Policies: %v", err)
+			}
+			matchedPolicies, err := kubepox.ListPoliciesPerPod(pod, allPolicies)
+			if err != nil {
+				return fmt.Errorf("Error getting matching policies: %v", err)
+			}
+			fmt.Printf("Applied policies for pod %s :\n", pod.Name)
+			if class := kubepox.ClassifyPod(pod); !class.Enforceable() && len(matchedPolicies.Items) > 0 {
+				fmt.Printf("WARNING: pod %s %s\n", pod.Name, class.Describe())
+			}
+			renderPolicies(matchedPolicies)
+			return nil
+		},
+	}
+}
+
+// newGetRulesCommand displays all the IngressRules that get applied to a pod.
+func newGetRulesCommand(o *rootOptions) *cobra.Command {
+	var normalize bool
+
+	cmd := &cobra.Command{
+		Use:       "get-rules (<pod>|<kind>/<workload>) [human]",
+		Short:     "Retrieve the union of the ingress rules that apply to a pod or a workload, such as deploy/web",
+		Args:      cobra.RangeArgs(1, 2),
+		ValidArgs: []string{"human"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			human := len(args) == 2
+			if human && args[1] != "human" {
+				return fmt.Errorf("unknown argument %q", args[1])
+			}
+
+			client, err := o.clientset()
+			if err != nil {
+				return fmt.Errorf("Error creating REST Kube Client: %v", err)
+			}
+			namespace, err := o.namespace()
+			if err != nil {
+				return err
+			}
+			ctx := context.Background()
+
+			pod, err := getPod(ctx, client, namespace, args[0])
+			if err != nil {
+				return fmt.Errorf("Couldn't get target pod %v", err)
+			}
+			allPolicies, err := client.NetworkingV1().NetworkPolicies(namespace).List(ctx, metav1.ListOptions{})
+			if err != nil {
+				return fmt.Errorf("Couldn't get all Network Policies: %v", err)
+			}
+			if normalize {
+				normalizedRules, err := kubepox.ListNormalizedIngressRulesPerPod(pod, allPolicies)
+				if err != nil {
+					return fmt.Errorf("Couldn't get all the rules: %v", err)
+				}
+				fmt.Printf("WhiteList for pod %s :\n\n", pod.Name)
+				if human {
+					return renderNormalizedIngressRulesHuman(normalizedRules)
+				}
+				renderNormalizedIngressRules(normalizedRules)
+				return nil
+			}
+
+			matchedRules, err := kubepox.ListIngressRulesPerPod(pod, allPolicies)
+			if err != nil {
+				return fmt.Errorf("Couldn't get all the rules: %v", err)
+			}
+			fmt.Printf("WhiteList for pod %s :\n\n", pod.Name)
+			if human {
+				return renderIngressRulesHuman(matchedRules)
+			}
+			renderIngressRules(matchedRules)
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&normalize, "normalize", false, "Merge duplicate and overlapping rules, and show the policies each rule comes from")
+
+	return cmd
+}
+
+// addExcludeFlag adds the flag excluding classes of pods from the results.
+func addExcludeFlag(cmd *cobra.Command, exclude *[]string) {
+	cmd.Flags().StringSliceVar(exclude, "exclude", nil, "Exclude pods of the given classes: host-network, terminated, no-ip, or unenforceable for the first two")
+}
+
+// podFilter builds the PodFilter excluding the given classes of pods.
+func podFilter(exclude []string) (kubepox.PodFilter, error) {
+	filter := kubepox.PodFilter{}
+	for _, class := range exclude {
+		switch class {
+		case string(kubepox.PodHostNetwork):
+			filter.ExcludeHostNetwork = true
+		case string(kubepox.PodTerminated):
+			filter.ExcludeTerminated = true
+		case string(kubepox.PodWithoutIP):
+			filter.ExcludeWithoutIP = true
+		case "unenforceable":
+			filter.ExcludeHostNetwork = true
+			filter.ExcludeTerminated = true
+		default:
+			return filter, fmt.Errorf("unknown pod class %q", class)
+		}
+	}
+	return filter, nil
+}
+
+// addByWorkloadFlag adds the flag grouping the pods of the results by workload.
+func addByWorkloadFlag(cmd *cobra.Command, byWorkload *bool) {
+	cmd.Flags().BoolVarP(byWorkload, "by-workload", "w", false, "Group the pods by workload (Deployment, StatefulSet, DaemonSet, CronJob, ...)")
+}
+
+// getPod returns the pod named ref, or a pod of the workload if ref is kind/name, such as deploy/web.
+func getPod(ctx context.Context, client kubernetes.Interface, namespace, ref string) (*api.Pod, error) {
+	if !strings.Contains(ref, "/") {
+		return client.CoreV1().Pods(namespace).Get(ctx, ref, metav1.GetOptions{})
+	}
+	state, err := cluster.Load(ctx, client, namespace)
+	if err != nil {
+		return nil, err
+	}
+	return workloadPod(state, ref, namespace)
+}
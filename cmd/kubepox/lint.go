@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/aporeto-inc/kubepox/lint"
+	"github.com/spf13/cobra"
+)
+
+// newLintCommand checks the NetworkPolicies for common mistakes.
+func newLintCommand(o *rootOptions) *cobra.Command {
+	var (
+		flags     stateFlags
+		rulesFile string
+		output    string
+		exitCode  bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "lint",
+		Short: "Check NetworkPolicies for common mistakes",
+		Long: `Check the NetworkPolicies for common mistakes: invalid selectors, policies selecting no pod and rules
+allowing every pod of every namespace.
+
+Custom rules are loaded from a file with --rules. Each rule is a CEL expression that must be true for
+every policy, evaluated with the variables policy, the NetworkPolicy as written in JSON, ns, the name and
+labels of its namespace, and pods, the name, namespace and labels of the pods it selects:
+
+  rules:
+  - id: team-label
+    description: Every policy must have a team label
+    severity: error
+    expression: has(policy.metadata.labels) && 'team' in policy.metadata.labels
+
+With -o sarif, the findings are written as SARIF 2.1.0 for code scanning services. When the policies are
+loaded from manifests, each finding points to the file and line of its policy, so that it shows up
+inline in pull requests.`,
+		Example: `  kubepox lint -A
+  kubepox lint -f manifests/ -o sarif > kubepox.sarif
+  kubepox lint -A --rules rules.yaml --exit-code`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if output != "table" && output != "json" && output != "sarif" {
+				return fmt.Errorf("unknown output format %q", output)
+			}
+
+			rules := lint.Rules()
+			if rulesFile != "" {
+				custom, err := lint.LoadConfig(rulesFile)
+				if err != nil {
+					return fmt.Errorf("Couldn't load rules: %v", err)
+				}
+				rules = append(rules, custom...)
+			}
+
+			state, err := o.loadState(&flags)
+			if err != nil {
+				return err
+			}
+
+			findings := lint.LintAll(state, rules)
+
+			switch output {
+			case "json":
+				pp, _ := json.MarshalIndent(findings, "", "   ")
+				fmt.Println(string(pp))
+			case "sarif":
+				err = lint.WriteSARIF(os.Stdout, findings, rules)
+			default:
+				err = renderFindings(findings)
+			}
+			if err != nil {
+				return err
+			}
+
+			if exitCode && len(findings) > 0 {
+				return fmt.Errorf("policies have lint findings")
+			}
+			return nil
+		},
+	}
+	flags.addFlags(cmd.Flags())
+	cmd.Flags().StringVar(&rulesFile, "rules", "", "File of custom rules written as CEL expressions")
+	cmd.Flags().StringVarP(&output, "output", "o", "table", "Output format: table, json or sarif")
+	cmd.Flags().BoolVar(&exitCode, "exit-code", false, "Fail if a policy has a finding")
+
+	return cmd
+}
+
+func renderFindings(findings []lint.Finding) error {
+	if len(findings) == 0 {
+		fmt.Println("No lint finding")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "SEVERITY\tPOLICY\tRULE\tLOCATION\tMESSAGE")
+	for _, f := range findings {
+		location := ""
+		if f.Location != nil {
+			location = fmt.Sprintf("%s:%d", f.Location.File, f.Location.Line)
+		}
+		fmt.Fprintf(w, "%s\t%s/%s\t%s\t%s\t%s\n", f.Severity, f.Namespace, f.Policy, f.Rule, location, f.Message)
+	}
+	return w.Flush()
+}
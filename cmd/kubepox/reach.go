@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/aporeto-inc/kubepox"
+	"github.com/aporeto-inc/kubepox/cluster"
+	"github.com/spf13/cobra"
+
+	api "k8s.io/api/core/v1"
+)
+
+// newCanReachCommand evaluates the traffic from a pod to a pod or the backends of a Service.
+func newCanReachCommand(o *rootOptions) *cobra.Command {
+	var (
+		flags        stateFlags
+		protocolName string
+		output       string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "can-reach <pod> (<pod>|svc/<service>):<port>",
+		Short: "Evaluate whether a pod can reach a pod or a Service on a port",
+		Long: `Evaluate whether the policies allow a pod to connect to a pod, or to a Service on one of its ports.
+Pods and Services are given as name in the namespace of the query, or as namespace/name. A workload,
+such as deploy/web or web/sts/db with its namespace, stands for one of its pods.
+
+A Service is resolved to its backends: the ready addresses of its EndpointSlices, or the pods matching its
+selector when it has no EndpointSlice, on the targetPort of the Service port, named targetPorts being
+resolved against the containers of each backend. The port of a Service can also be given by name.
+
+The objects of all the namespaces are evaluated. The command fails unless the connection is allowed to
+every backend.`,
+		Example: `  kubepox -n web can-reach deploy/frontend svc/api:443
+  kubepox can-reach web/frontend svc/billing/api:https
+  kubepox -n web can-reach frontend db:5432`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if output != "table" && output != "json" {
+				return fmt.Errorf("unknown output format %q", output)
+			}
+			protocol := api.Protocol(strings.ToUpper(protocolName))
+
+			namespace, err := o.namespace()
+			if err != nil {
+				return err
+			}
+			flags.allNamespaces = true
+			state, err := o.loadState(&flags)
+			if err != nil {
+				return err
+			}
+
+			src, err := podRef(state, args[0], namespace)
+			if err != nil {
+				return fmt.Errorf("Couldn't find source pod: %v", err)
+			}
+
+			i := strings.LastIndex(args[1], ":")
+			if i < 0 {
+				return fmt.Errorf("invalid target %q, expected (<pod>|svc/<service>):<port>", args[1])
+			}
+			target, port := args[1][:i], args[1][i+1:]
+
+			if strings.HasPrefix(target, "svc/") {
+				svcNamespace, svcName := splitRef(strings.TrimPrefix(target, "svc/"), namespace)
+				svc := state.Service(svcNamespace, svcName)
+				if svc == nil {
+					return fmt.Errorf("Couldn't find service %s/%s", svcNamespace, svcName)
+				}
+				number, err := servicePortNumber(svc, port, protocol)
+				if err != nil {
+					return err
+				}
+				verdict, err := kubepox.EvaluateServiceTraffic(kubepox.PodEndpoint(src), svc, number, protocol, &state.Pods, state.EndpointSlices.Items, &state.Namespaces, &state.Policies)
+				if err != nil {
+					return fmt.Errorf("Error evaluating traffic: %v", err)
+				}
+				if err := renderServiceVerdict(output, verdict); err != nil {
+					return err
+				}
+				switch {
+				case len(verdict.Backends) == 0:
+					return fmt.Errorf("service %s/%s has no backend for port %s", svc.Namespace, svc.Name, port)
+				case !verdict.Allowed:
+					return fmt.Errorf("%s/%s can't reach every backend of service %s/%s", src.Namespace, src.Name, svc.Namespace, svc.Name)
+				}
+				return nil
+			}
+
+			dst, err := podRef(state, target, namespace)
+			if err != nil {
+				return fmt.Errorf("Couldn't find destination pod: %v", err)
+			}
+			number, err := strconv.ParseInt(port, 10, 32)
+			if err != nil {
+				resolved, ok := kubepox.ResolveNamedPort(dst, port, protocol)
+				if !ok {
+					return fmt.Errorf("pod %s/%s has no port named %s", dst.Namespace, dst.Name, port)
+				}
+				number = int64(resolved)
+			}
+			verdict, err := kubepox.EvaluateTraffic(kubepox.PodEndpoint(src), kubepox.PodEndpoint(dst), int32(number), protocol, &state.Namespaces, &state.Policies)
+			if err != nil {
+				return fmt.Errorf("Error evaluating traffic: %v", err)
+			}
+			if output == "json" {
+				pp, _ := json.MarshalIndent(verdict, "", "   ")
+				fmt.Println(string(pp))
+			} else {
+				fmt.Println(explainVerdict(verdict))
+			}
+			if !verdict.Allowed {
+				return fmt.Errorf("%s/%s can't reach %s/%s", src.Namespace, src.Name, dst.Namespace, dst.Name)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringSliceVarP(&flags.manifests, "manifests", "f", nil, "Evaluate the objects of manifest files or directories instead of a live cluster")
+	cmd.Flags().StringVar(&protocolName, "protocol", string(api.ProtocolTCP), "Protocol of the connection: TCP, UDP or SCTP")
+	cmd.Flags().StringVarP(&output, "output", "o", "table", "Output format: table or json")
+
+	return cmd
+}
+
+// podRef returns the pod of a reference: [<namespace>/]<pod> or [<namespace>/]<kind>/<workload>.
+func podRef(state *cluster.State, ref, namespace string) (*api.Pod, error) {
+	workload, err := cluster.ParseQualifiedWorkload(ref, namespace)
+	if err != nil {
+		return nil, err
+	}
+	return resolvePod(state, workload)
+}
+
+// splitRef splits namespace/name, name alone being in the given namespace.
+func splitRef(ref, namespace string) (string, string) {
+	if i := strings.Index(ref, "/"); i >= 0 {
+		return ref[:i], ref[i+1:]
+	}
+	return namespace, ref
+}
+
+// servicePortNumber returns the number of a port of the Service given by number or by name.
+func servicePortNumber(svc *api.Service, port string, protocol api.Protocol) (int32, error) {
+	if number, err := strconv.ParseInt(port, 10, 32); err == nil {
+		return int32(number), nil
+	}
+	for _, servicePort := range svc.Spec.Ports {
+		servicePortProtocol := servicePort.Protocol
+		if servicePortProtocol == "" {
+			servicePortProtocol = api.ProtocolTCP
+		}
+		if servicePort.Name == port && servicePortProtocol == protocol {
+			return servicePort.Port, nil
+		}
+	}
+	return 0, fmt.Errorf("service %s/%s has no port named %s", svc.Namespace, svc.Name, port)
+}
+
+func renderServiceVerdict(output string, verdict *kubepox.ServiceVerdict) error {
+	if output == "json" {
+		pp, _ := json.MarshalIndent(verdict, "", "   ")
+		fmt.Println(string(pp))
+		return nil
+	}
+
+	allowed := 0
+	for _, backend := range verdict.Backends {
+		if backend.Verdict.Allowed {
+			allowed++
+		}
+	}
+	fmt.Printf("%d of %d backends reachable\n", allowed, len(verdict.Backends))
+	if len(verdict.Backends) == 0 {
+		return nil
+	}
+
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "BACKEND\tPORT\tVERDICT")
+	for _, backend := range verdict.Backends {
+		fmt.Fprintf(w, "%s\t%d\t%s\n", backend.Backend, backend.Port, explainVerdict(backend.Verdict))
+	}
+	return w.Flush()
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/aporeto-inc/kubepox/flows"
+	"github.com/aporeto-inc/kubepox/recommend"
+	"github.com/spf13/cobra"
+)
+
+// newRecommendCommand generates least-privilege policies out of observed flows.
+func newRecommendCommand(o *rootOptions) *cobra.Command {
+	var (
+		flags      stateFlags
+		format     string
+		directions []string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "recommend <file>...",
+		Short: "Generate least-privilege policies allowing exactly the observed flows",
+		Long: `Generate, for every workload owning an allowed flow, a NetworkPolicy selecting it by its stable labels
+and allowing exactly the observed traffic, as YAML ready to be applied. The policies are verified with
+the kubepox evaluation before being printed: every observed flow must be allowed, and every policy must
+isolate the pods of its workload, and only them, in the chosen directions. Peers in other namespaces are
+selected by the kubernetes.io/metadata.name label, set by Kubernetes 1.21 and later: namespaces without
+it are reported, and the flows to them fail the verification.
+
+Flows are read as by check-flows, - reading the standard input.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			options := recommend.Options{}
+			for _, direction := range directions {
+				switch direction {
+				case "ingress":
+					options.Ingress = true
+				case "egress":
+					options.Egress = true
+				default:
+					return fmt.Errorf("unknown direction %q", direction)
+				}
+			}
+
+			observed := []flows.Flow{}
+			for _, file := range args {
+				read, err := readFlows(file, format)
+				if err != nil {
+					return fmt.Errorf("Couldn't read flows from %s: %v", file, err)
+				}
+				observed = append(observed, read...)
+			}
+
+			state, err := o.loadState(&flags)
+			if err != nil {
+				return err
+			}
+
+			result, err := recommend.Recommend(observed, state, options)
+			if result != nil {
+				for _, warning := range result.Warnings {
+					fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+				}
+			}
+			if err != nil {
+				return fmt.Errorf("Error recommending policies: %v", err)
+			}
+			for _, pod := range result.Skipped {
+				fmt.Fprintf(os.Stderr, "Skipped pod %s: it has no stable label to be selected with\n", pod)
+			}
+
+			policies := []interface{}{}
+			for i := range result.Policies {
+				policies = append(policies, &result.Policies[i])
+			}
+			if len(policies) == 0 {
+				fmt.Println("# No allowed flow between known pods")
+				return nil
+			}
+			return renderManifests(policies...)
+		},
+	}
+	flags.addFlags(cmd.Flags())
+	cmd.Flags().StringVar(&format, "format", flows.FormatJSONLines, "Format of the flow records: jsonl or hubble")
+	cmd.Flags().StringSliceVar(&directions, "direction", []string{"ingress", "egress"}, "Directions of the generated policies: ingress, egress or both")
+
+	return cmd
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/aporeto-inc/kubepox"
+	"github.com/aporeto-inc/kubepox/cluster"
+
+	api "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+func renderPolicies(policies *networking.NetworkPolicyList) {
+	for count, policy := range policies.Items {
+		fmt.Printf("POLICY %d\n", count+1)
+		pp, _ := json.MarshalIndent(&policy, "", "   ")
+		fmt.Println(string(pp))
+	}
+}
+
+func renderPods(pods *api.PodList) {
+	for count, pod := range pods.Items {
+		if class := kubepox.ClassifyPod(&pod); class != kubepox.PodEnforced {
+			fmt.Printf("POD %d (%s: %s)\n", count+1, class, class.Describe())
+		} else {
+			fmt.Printf("POD %d\n", count+1)
+		}
+		pp, _ := json.MarshalIndent(&pod, "", "   ")
+		fmt.Println(string(pp))
+	}
+}
+
+func renderWorkloads(groups []cluster.WorkloadGroup) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "WORKLOAD\tPODS")
+	for _, group := range groups {
+		fmt.Fprintf(w, "%s\t%d\n", group.Workload, len(group.Pods))
+	}
+	return w.Flush()
+}
+
+func renderIngressRules(ingressRules *[]networking.NetworkPolicyIngressRule) {
+	if ingressRules == nil {
+		fmt.Println("Pod is not isolated for Ingress")
+		return
+	}
+	for count, rule := range *ingressRules {
+		fmt.Printf("RULE %d\n", count)
+		pp, _ := json.MarshalIndent(&rule, "", "   ")
+		fmt.Println(string(pp))
+	}
+}
+
+func renderNormalizedIngressRules(ingressRules *[]kubepox.IngressRule) {
+	if ingressRules == nil {
+		fmt.Println("Pod is not isolated for Ingress")
+		return
+	}
+	for count, rule := range *ingressRules {
+		fmt.Printf("RULE %d\n", count)
+		pp, _ := json.MarshalIndent(&rule, "", "   ")
+		fmt.Println(string(pp))
+	}
+}
+
+// renderNormalizedIngressRulesHuman renders the rules as renderIngressRulesHuman, followed by the policies of each rule.
+func renderNormalizedIngressRulesHuman(ingressRules *[]kubepox.IngressRule) error {
+	if ingressRules == nil {
+		fmt.Println("Pod is not isolated for Ingress")
+		return nil
+	}
+	rules := []networking.NetworkPolicyIngressRule{}
+	for _, rule := range *ingressRules {
+		rules = append(rules, rule.NetworkPolicyIngressRule)
+	}
+	if err := renderIngressRulesHuman(&rules); err != nil {
+		return err
+	}
+	fmt.Println()
+	for count, rule := range *ingressRules {
+		fmt.Printf("RULE %d from policies: %s\n", count+1, strings.Join(rule.Policies, ", "))
+	}
+	return nil
+}
+
+func portsRepresentation(rule *networking.NetworkPolicyIngressRule) string {
+	if len(rule.Ports) == 0 {
+		return "ALL"
+	}
+	entryString := ""
+	for count, port := range rule.Ports {
+		entryString += string(*port.Protocol)
+		entryString += ":"
+		entryString += port.Port.String()
+		if count == len(rule.Ports)-1 {
+			break
+		}
+		entryString += ", "
+	}
+	return entryString
+}
+
+func entryFromRule(rule *networking.NetworkPolicyIngressRule, ruleCount, entryCount int) (string, error) {
+	entryString := ""
+	entryString += strconv.Itoa(ruleCount+1) + "\t" + strconv.Itoa(entryCount+1) + "\t"
+
+	selector, err := metav1.LabelSelectorAsSelector(rule.From[entryCount].PodSelector)
+	if err != nil {
+		return "", err
+	}
+	entryString += selector.String()
+	entryString += "\t"
+	entryString += portsRepresentation(rule)
+	entryString += "\t\n"
+	return entryString, nil
+}
+
+func renderIngressRulesHuman(ingressRules *[]networking.NetworkPolicyIngressRule) error {
+	if ingressRules == nil {
+		fmt.Println("Pod is not isolated for Ingress")
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 10, 0, 3, '-', tabwriter.AlignRight|tabwriter.Debug)
+	fmt.Fprintln(w, "RULE\tSELECTOR\tFROM PODS\tALLOWED TRAFFIC\t")
+	for ruleCount, rule := range *ingressRules {
+		for entryCount := 0; entryCount < len(rule.From); entryCount++ {
+			entryString, err := entryFromRule(&rule, ruleCount, entryCount)
+			if err != nil {
+				return fmt.Errorf("error while trying to render: %v", err)
+			}
+			fmt.Fprint(w, entryString)
+		}
+	}
+	return w.Flush()
+}
+
+// renderManifests prints the objects as a multi-document YAML stream, ready to be applied.
+func renderManifests(objects ...interface{}) error {
+	for i, object := range objects {
+		data, err := json.Marshal(object)
+		if err != nil {
+			return err
+		}
+		manifest := map[string]interface{}{}
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			return err
+		}
+		// Objects built in memory have no creation timestamp, which is serialized as null.
+		if metadata, ok := manifest["metadata"].(map[string]interface{}); ok {
+			delete(metadata, "creationTimestamp")
+		}
+		if status, ok := manifest["status"].(map[string]interface{}); ok && len(status) == 0 {
+			delete(manifest, "status")
+		}
+		out, err := yaml.Marshal(manifest)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			fmt.Println("---")
+		}
+		fmt.Print(string(out))
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aporeto-inc/kubepox/cluster"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	api "k8s.io/api/core/v1"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/kubernetes"
+)
+
+// rootOptions holds the state shared by every kubepox subcommand.
+type rootOptions struct {
+	configFlags *genericclioptions.ConfigFlags
+	// snapshotFile replaces the live cluster when set.
+	snapshotFile string
+	snapshot     *cluster.Snapshot
+}
+
+// newRootCommand builds the kubepox command tree.
+// The standard kubectl flags (--kubeconfig, --context, -n, ...) are honored, as well as the KUBECONFIG environment variable.
+func newRootCommand() *cobra.Command {
+	o := &rootOptions{
+		configFlags: genericclioptions.NewConfigFlags(true),
+	}
+
+	cmd := &cobra.Command{
+		Use:          commandName(),
+		Short:        "Kubernetes network Policy eXploration tool",
+		SilenceUsage: true,
+	}
+	o.configFlags.AddFlags(cmd.PersistentFlags())
+	cmd.PersistentFlags().StringVar(&o.snapshotFile, "snapshot", "", "Evaluate the objects of a snapshot saved by snapshot save instead of a live cluster")
+
+	cmd.AddCommand(
+		newGetAllCommand(o),
+		newGetPodsCommand(o),
+		newGetPoliciesCommand(o),
+		newGetRulesCommand(o),
+		newWatchCommand(o),
+		newServeCommand(o),
+		newWebhookCommand(o),
+		newCoverageCommand(o),
+		newScaffoldCommand(o),
+		newGenerateCasesCommand(o),
+		newCheckFlowsCommand(o),
+		newRecommendCommand(o),
+		newSnapshotCommand(o),
+		newDiffCommand(o),
+		newCanReachCommand(o),
+		newSimulateLabelsCommand(o),
+		newBlastRadiusCommand(o),
+		newExposureCommand(o),
+		newSegmentsCommand(o),
+		newVerifyCommand(o),
+		newLintCommand(o),
+	)
+
+	return cmd
+}
+
+// commandName returns the name used in the usage message.
+// When installed as a kubectl plugin (kubectl-pox), the binary is invoked as `kubectl pox`.
+func commandName() string {
+	name := filepath.Base(os.Args[0])
+	if strings.HasPrefix(name, "kubectl-") {
+		return "kubectl " + strings.TrimPrefix(name, "kubectl-")
+	}
+	return "kubepox"
+}
+
+// clientset returns a Kubernetes client built from the standard kubectl flags,
+// or an in-memory client serving the objects of the snapshot if --snapshot is set.
+func (o *rootOptions) clientset() (kubernetes.Interface, error) {
+	if o.snapshotFile != "" {
+		snapshot, err := o.loadSnapshot()
+		if err != nil {
+			return nil, err
+		}
+		return snapshot.Clientset(), nil
+	}
+
+	config, err := o.configFlags.ToRESTConfig()
+	if err != nil {
+		return nil, err
+	}
+	return kubernetes.NewForConfig(config)
+}
+
+// stateFlags selects the objects a command evaluates.
+type stateFlags struct {
+	allNamespaces bool
+	manifests     []string
+}
+
+func (f *stateFlags) addFlags(flags *pflag.FlagSet) {
+	flags.BoolVarP(&f.allNamespaces, "all-namespaces", "A", false, "Evaluate the objects of all the namespaces")
+	flags.StringSliceVarP(&f.manifests, "manifests", "f", nil, "Evaluate the objects of manifest files or directories instead of a live cluster")
+}
+
+// loadState returns the objects to evaluate, from the manifests if any, from the Kubernetes API otherwise.
+func (o *rootOptions) loadState(f *stateFlags) (*cluster.State, error) {
+	if len(f.manifests) > 0 {
+		if o.snapshotFile != "" {
+			return nil, fmt.Errorf("--manifests and --snapshot are mutually exclusive")
+		}
+		state, err := cluster.LoadManifests(f.manifests...)
+		if err != nil {
+			return nil, fmt.Errorf("Couldn't load manifests: %v", err)
+		}
+		state.Sort()
+		return state, nil
+	}
+
+	client, err := o.clientset()
+	if err != nil {
+		return nil, fmt.Errorf("Error creating REST Kube Client: %v", err)
+	}
+	namespace := ""
+	if !f.allNamespaces {
+		if namespace, err = o.namespace(); err != nil {
+			return nil, err
+		}
+	}
+	state, err := cluster.Load(context.Background(), client, namespace)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't get cluster state: %v", err)
+	}
+	state.Sort()
+	return state, nil
+}
+
+// workloadPod returns the pod of the State named ref, or a pod of the workload if ref is kind/name, such as deploy/web.
+func workloadPod(state *cluster.State, ref, namespace string) (*api.Pod, error) {
+	workload, err := cluster.ParseWorkload(ref, namespace)
+	if err != nil {
+		return nil, err
+	}
+	return resolvePod(state, workload)
+}
+
+// resolvePod returns the pod evaluated for the workload: a pod of its newest revision during a rollout,
+// or a pod synthesized from its pod template if it has no pod.
+func resolvePod(state *cluster.State, workload cluster.Workload) (*api.Pod, error) {
+	pod := state.WorkloadPod(workload)
+	if pod == nil {
+		return nil, fmt.Errorf("no pod found for %s in namespace %s", workload, workload.Namespace)
+	}
+	return pod, nil
+}
+
+// namespace returns the namespace to run the query in.
+// It is the -n flag if set, the namespace of the current context otherwise, and "default" as a last resort.
+// With a snapshot restricted to a namespace, that namespace replaces the one of the current context.
+func (o *rootOptions) namespace() (string, error) {
+	if o.snapshotFile != "" && (o.configFlags.Namespace == nil || *o.configFlags.Namespace == "") {
+		snapshot, err := o.loadSnapshot()
+		if err != nil {
+			return "", err
+		}
+		if snapshot.Namespace != "" {
+			return snapshot.Namespace, nil
+		}
+	}
+	namespace, _, err := o.configFlags.ToRawKubeConfigLoader().Namespace()
+	return namespace, err
+}
+
+// loadSnapshot loads the snapshot of the --snapshot flag, once.
+func (o *rootOptions) loadSnapshot() (*cluster.Snapshot, error) {
+	if o.snapshot == nil {
+		snapshot, err := cluster.LoadSnapshot(o.snapshotFile)
+		if err != nil {
+			return nil, fmt.Errorf("Couldn't load snapshot: %v", err)
+		}
+		o.snapshot = snapshot
+	}
+	return o.snapshot, nil
+}
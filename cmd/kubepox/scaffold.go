@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/aporeto-inc/kubepox"
+	"github.com/spf13/cobra"
+
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// systemNamespaces are skipped by the scaffolding unless explicitly included:
+// denying their traffic by default breaks the cluster.
+var systemNamespaces = map[string]bool{
+	"kube-system":     true,
+	"kube-public":     true,
+	"kube-node-lease": true,
+}
+
+// newScaffoldCommand groups the commands generating policies.
+func newScaffoldCommand(o *rootOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "scaffold",
+		Short: "Generate NetworkPolicies",
+	}
+	cmd.AddCommand(newScaffoldDefaultDenyCommand(o))
+	return cmd
+}
+
+// newScaffoldDefaultDenyCommand generates the default deny policies missing in each namespace.
+func newScaffoldDefaultDenyCommand(o *rootOptions) *cobra.Command {
+	var (
+		flags         stateFlags
+		dns           dnsFlags
+		includeSystem bool
+		noDNS         bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "default-deny",
+		Short: "Generate the missing default deny policies, and the companion policies allowing DNS",
+		Long: `Generate the missing default deny policies of each namespace as YAML, ready to be applied.
+
+When a default deny egress policy is generated, a policy allowing DNS resolution
+(UDP and TCP port 53) towards the DNS pods is generated along with it. The DNS pods are selected by
+--dns-pod-selector, and their namespace by its kubernetes.io/metadata.name label, set by Kubernetes 1.21
+and later, or else by a label only it has. When the namespace can't be found or selected, such as with
+manifests without the DNS pods, --dns-namespace-selector must be set.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			state, err := o.loadState(&flags)
+			if err != nil {
+				return err
+			}
+
+			namespaces := map[string]bool{}
+			if flags.allNamespaces || len(flags.manifests) > 0 {
+				for _, namespace := range state.Namespaces.Items {
+					namespaces[namespace.Name] = true
+				}
+				for _, pod := range state.Pods.Items {
+					namespaces[pod.Namespace] = true
+				}
+				for _, policy := range state.Policies.Items {
+					namespaces[policy.Namespace] = true
+				}
+			} else {
+				namespace, err := o.namespace()
+				if err != nil {
+					return err
+				}
+				namespaces[namespace] = true
+			}
+
+			names := []string{}
+			for namespace := range namespaces {
+				if systemNamespaces[namespace] && !includeSystem {
+					continue
+				}
+				names = append(names, namespace)
+			}
+			sort.Strings(names)
+
+			// The DNS pods are only looked up when a policy allowing DNS is generated.
+			var dnsNamespaces, dnsPods *metav1.LabelSelector
+			policies := []interface{}{}
+			for _, namespace := range names {
+				ingress, egress := kubepox.HasDefaultDeny(namespace, &state.Policies)
+				if !ingress {
+					policies = append(policies, kubepox.NewDefaultDenyPolicy(namespace, networking.PolicyTypeIngress))
+				}
+				if !egress {
+					policies = append(policies, kubepox.NewDefaultDenyPolicy(namespace, networking.PolicyTypeEgress))
+					if !noDNS {
+						if dnsPods == nil {
+							if dnsNamespaces, dnsPods, err = o.dnsSelectors(&dns, state, &flags); err != nil {
+								return err
+							}
+						}
+						policies = append(policies, kubepox.NewAllowDNSPolicy(namespace, dnsNamespaces, dnsPods))
+					}
+				}
+			}
+
+			if len(policies) == 0 {
+				fmt.Println("# Every namespace already has default deny policies")
+				return nil
+			}
+			return renderManifests(policies...)
+		},
+	}
+	flags.addFlags(cmd.Flags())
+	cmd.Flags().BoolVar(&includeSystem, "include-system", false, "Also generate policies for kube-system, kube-public and kube-node-lease")
+	cmd.Flags().BoolVar(&noDNS, "no-dns", false, "Don't generate the policies allowing DNS egress")
+	dns.addFlags(cmd.Flags())
+
+	return cmd
+}
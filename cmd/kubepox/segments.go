@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/aporeto-inc/kubepox/graph"
+	"github.com/spf13/cobra"
+)
+
+// newSegmentsCommand partitions the pods in segments of pods reaching each other.
+func newSegmentsCommand(o *rootOptions) *cobra.Command {
+	var (
+		flags  stateFlags
+		output string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "segments",
+		Short: "Partition the pods in network segments and report the bridges between their parts",
+		Long: `Partition the pods in network segments: two pods are in the same segment if each can reach the other
+through a chain of allowed connections. Pods of different segments can't reach each other both ways, even
+through other pods: a pod may reach a pod of another segment, such as a shared DNS or proxy, but is never
+reached back from it. Tenants reaching the same shared pods stay in separate segments, which verifies
+their separation.
+
+Bridges are the weak points of a segment: the pods, and the connections between two pods, whose removal
+would split it. Every bridge connection is reported with the policies whose rules allow it, or as
+unisolated when a side of it is not isolated.`,
+		Example: `  kubepox segments -A
+  kubepox segments -f manifests/ -o json`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if output != "table" && output != "json" {
+				return fmt.Errorf("unknown output format %q", output)
+			}
+
+			state, err := o.loadState(&flags)
+			if err != nil {
+				return err
+			}
+
+			g, err := graph.Build(state)
+			if err != nil {
+				return fmt.Errorf("Error evaluating connectivity: %v", err)
+			}
+			segmentation := g.Segments()
+
+			if output == "json" {
+				pp, _ := json.MarshalIndent(segmentation, "", "   ")
+				fmt.Println(string(pp))
+				return nil
+			}
+			return renderSegments(segmentation)
+		},
+	}
+	flags.addFlags(cmd.Flags())
+	cmd.Flags().StringVarP(&output, "output", "o", "table", "Output format: table or json")
+
+	return cmd
+}
+
+func renderSegments(segmentation *graph.Segmentation) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "SEGMENT\tPODS")
+	for i, segment := range segmentation.Segments {
+		fmt.Fprintf(w, "%d\t%s\n", i+1, strings.Join(segment, ", "))
+	}
+	if len(segmentation.BridgePods) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "BRIDGE POD")
+		for _, pod := range segmentation.BridgePods {
+			fmt.Fprintln(w, pod)
+		}
+	}
+	if len(segmentation.Bridges) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "BRIDGE CONNECTION\tALLOWED BY")
+		for _, bridge := range segmentation.Bridges {
+			allowedBy := bridge.Policies
+			if bridge.Unisolated {
+				allowedBy = append(allowedBy, "(unisolated)")
+			}
+			fmt.Fprintf(w, "%s -> %s\t%s\n", bridge.From, bridge.To, strings.Join(allowedBy, ", "))
+		}
+	}
+	return w.Flush()
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/aporeto-inc/kubepox/cluster"
+	"github.com/aporeto-inc/kubepox/metrics"
+	"github.com/aporeto-inc/kubepox/server"
+	"github.com/spf13/cobra"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// newServeCommand exposes the kubepox queries over HTTP.
+func newServeCommand(o *rootOptions) *cobra.Command {
+	var (
+		listen        string
+		allNamespaces bool
+		manifests     []string
+		podMetrics    bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Serve the kubepox queries over a REST/JSON API",
+		Long: `Serve the kubepox queries over a REST/JSON API.
+
+The API is backed by an in-memory cache of the cluster state, or by the given manifests.
+
+  GET /v1/namespaces/{namespace}/pods/{pod}/policies
+  GET /v1/namespaces/{namespace}/pods/{pod}/rules
+  GET /v1/namespaces/{namespace}/policies/{policy}/pods
+  GET /v1/connectivity?from=ns/pod&to=ns/pod&port=80[&protocol=TCP]
+  GET /v1/connectivity/matrix?port=80[&protocol=TCP][&namespace=ns]
+
+Workloads can be queried in place of pods: deployments/{name} instead of pods/{pod} in the paths,
+and ns/kind/name, such as ns/deploy/web, in the connectivity queries. A workload is evaluated with
+one of its pods, of its newest revision during a rollout.
+
+The policy posture (pods not isolated per namespace, policies selecting no pods, evaluation latency)
+is exposed as Prometheus metrics on /metrics. The number of rules of every isolated pod is also exposed
+with --pod-metrics, as a series per pod.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var source cluster.Source
+
+			if len(manifests) > 0 {
+				if o.snapshotFile != "" {
+					return fmt.Errorf("--manifests and --snapshot are mutually exclusive")
+				}
+				state, err := cluster.LoadManifests(manifests...)
+				if err != nil {
+					return fmt.Errorf("Couldn't load manifests: %v", err)
+				}
+				state.Sort()
+				source = cluster.NewStaticSource(state)
+			} else {
+				client, err := o.clientset()
+				if err != nil {
+					return fmt.Errorf("Error creating REST Kube Client: %v", err)
+				}
+				namespace := ""
+				if !allNamespaces {
+					if namespace, err = o.namespace(); err != nil {
+						return err
+					}
+				}
+				cache := cluster.NewCache(client, namespace)
+				if err := cache.Start(make(chan struct{})); err != nil {
+					return err
+				}
+				source = cache
+			}
+
+			registry := prometheus.NewRegistry()
+			registry.MustRegister(metrics.NewCollector(source, podMetrics))
+
+			mux := http.NewServeMux()
+			mux.Handle("/", server.New(source))
+			mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+
+			fmt.Printf("Serving on %s\n", listen)
+			return http.ListenAndServe(listen, mux)
+		},
+	}
+	cmd.Flags().StringVar(&listen, "listen", ":8080", "Address to listen on")
+	cmd.Flags().BoolVarP(&allNamespaces, "all-namespaces", "A", false, "Serve the objects of all the namespaces")
+	cmd.Flags().StringSliceVarP(&manifests, "manifests", "f", nil, "Serve the objects of manifest files or directories instead of a live cluster")
+	cmd.Flags().BoolVar(&podMetrics, "pod-metrics", false, "Expose the number of rules of every isolated pod, as a metric series per pod")
+
+	return cmd
+}
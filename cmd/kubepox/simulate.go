@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/aporeto-inc/kubepox/cluster"
+	"github.com/aporeto-inc/kubepox/diff"
+	"github.com/spf13/cobra"
+)
+
+// newSimulateLabelsCommand reports the impact of a change of the labels of a pod, workload or namespace.
+func newSimulateLabelsCommand(o *rootOptions) *cobra.Command {
+	var (
+		flags  stateFlags
+		set    []string
+		remove []string
+		output string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "simulate-labels (<pod>|<kind>/<workload>|ns/<namespace>) [--set key=value] [--remove key]",
+		Short: "Simulate a change of the labels of a pod, workload or namespace",
+		Long: `Simulate a change of labels and report how it would alter the policies selecting the pods,
+the rules of policies whose peers include the pods, and the flows from or to the pods that would
+become allowed or denied. Nothing is changed in the cluster.
+
+Pods are given as name in the namespace of the query, or as namespace/name. The labels of a workload,
+such as deploy/web, change on all its pods, as a change of its pod template would. With ns/<namespace>,
+the labels of the namespace change, affecting all its pods.
+
+The objects of all the namespaces are evaluated.`,
+		Example: `  kubepox -n web simulate-labels db --set role=frontend
+  kubepox simulate-labels web/deploy/api --remove tier
+  kubepox simulate-labels ns/web --set team=payments -f manifests/`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if output != "text" && output != "json" {
+				return fmt.Errorf("unknown output format %q", output)
+			}
+			change, err := diff.ParseLabelChange(set, remove)
+			if err != nil {
+				return err
+			}
+			if len(change.Set) == 0 && len(change.Remove) == 0 {
+				return fmt.Errorf("no label change: use --set or --remove")
+			}
+
+			namespace, err := o.namespace()
+			if err != nil {
+				return err
+			}
+			flags.allNamespaces = true
+			state, err := o.loadState(&flags)
+			if err != nil {
+				return err
+			}
+
+			target, err := labelTarget(state, args[0], namespace)
+			if err != nil {
+				return err
+			}
+
+			report, err := diff.SimulateLabels(state, target, change)
+			if err != nil {
+				return fmt.Errorf("Error simulating labels: %v", err)
+			}
+
+			if output == "json" {
+				pp, _ := json.MarshalIndent(report, "", "   ")
+				fmt.Println(string(pp))
+				return nil
+			}
+			return renderDiff(report)
+		},
+	}
+	cmd.Flags().StringSliceVarP(&flags.manifests, "manifests", "f", nil, "Evaluate the objects of manifest files or directories instead of a live cluster")
+	cmd.Flags().StringArrayVar(&set, "set", nil, "Label to set, as key=value (repeatable)")
+	cmd.Flags().StringArrayVar(&remove, "remove", nil, "Key of a label to remove (repeatable)")
+	cmd.Flags().StringVarP(&output, "output", "o", "text", "Output format: text or json")
+
+	return cmd
+}
+
+// labelTarget returns the target of a reference: ns/<namespace> or namespace/<namespace>, or the pods of
+// [<namespace>/]<pod> or [<namespace>/]<kind>/<workload>. A workload without any pod is added to the State
+// as a pod synthesized from its pod template.
+func labelTarget(state *cluster.State, ref, namespace string) (diff.LabelTarget, error) {
+	for _, prefix := range []string{"ns/", "namespace/"} {
+		if strings.HasPrefix(ref, prefix) {
+			return diff.LabelTarget{Namespace: strings.TrimPrefix(ref, prefix)}, nil
+		}
+	}
+
+	workload, err := cluster.ParseQualifiedWorkload(ref, namespace)
+	if err != nil {
+		return diff.LabelTarget{}, err
+	}
+	pods := state.ResolveWorkload(workload)
+	if len(pods.Items) == 0 {
+		return diff.LabelTarget{}, fmt.Errorf("no pod found for %s in namespace %s", workload, workload.Namespace)
+	}
+	target := diff.LabelTarget{Namespace: workload.Namespace}
+	for _, pod := range pods.Items {
+		if cluster.IsTemplatePod(&pod) {
+			state.Pods.Items = append(state.Pods.Items, pod)
+		}
+		target.Pods = append(target.Pods, pod.Name)
+	}
+	return target, nil
+}
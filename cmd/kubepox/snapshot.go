@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/aporeto-inc/kubepox/cluster"
+	"github.com/spf13/cobra"
+)
+
+// newSnapshotCommand groups the commands handling snapshots of a cluster.
+func newSnapshotCommand(o *rootOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "snapshot",
+		Short: "Capture the state of a cluster to evaluate it offline",
+		Long: `Capture the namespaces, pods and NetworkPolicies of a cluster in a single file. Every command
+evaluates the snapshot instead of the live cluster when given --snapshot <file>, which allows to
+reproduce a problem away from the cluster, or to attach the snapshot to a bug report.`,
+	}
+	cmd.AddCommand(newSnapshotSaveCommand(o))
+	return cmd
+}
+
+// newSnapshotSaveCommand saves a snapshot of the cluster.
+func newSnapshotSaveCommand(o *rootOptions) *cobra.Command {
+	var flags stateFlags
+
+	cmd := &cobra.Command{
+		Use:   "save <file>",
+		Short: "Save the namespaces, pods and NetworkPolicies to a file",
+		Long: `Save the namespaces, pods and NetworkPolicies to a file, stripped of the fields irrelevant to
+the evaluation of policies: statuses other than the phase and addresses of pods, managed fields,
+and container specs other than ports, which keeps environment variables out of the snapshot.
+The file is compressed with gzip if its name ends with .gz.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			state, err := o.loadState(&flags)
+			if err != nil {
+				return err
+			}
+
+			snapshot := cluster.NewSnapshot(state)
+			if !flags.allNamespaces && len(flags.manifests) == 0 {
+				if snapshot.Namespace, err = o.namespace(); err != nil {
+					return err
+				}
+			}
+			if len(flags.manifests) == 0 && o.snapshotFile == "" {
+				snapshot.Context = o.context()
+			}
+
+			if err := cluster.SaveSnapshot(args[0], snapshot); err != nil {
+				return fmt.Errorf("Couldn't save snapshot: %v", err)
+			}
+			fmt.Printf("Saved %d namespaces, %d pods and %d policies to %s\n", len(snapshot.Namespaces), len(snapshot.Pods), len(snapshot.Policies), args[0])
+			return nil
+		},
+	}
+	flags.addFlags(cmd.Flags())
+
+	return cmd
+}
+
+// context returns the name of the kubeconfig context in use, empty if unknown.
+func (o *rootOptions) context() string {
+	if o.configFlags.Context != nil && *o.configFlags.Context != "" {
+		return *o.configFlags.Context
+	}
+	config, err := o.configFlags.ToRawKubeConfigLoader().RawConfig()
+	if err != nil {
+		return ""
+	}
+	return config.CurrentContext
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/aporeto-inc/kubepox/expect"
+	"github.com/spf13/cobra"
+)
+
+// newVerifyCommand checks connectivity expectations against the state of the cluster.
+func newVerifyCommand(o *rootOptions) *cobra.Command {
+	var (
+		flags  stateFlags
+		output string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "verify <expectations.yaml>",
+		Short: "Verify connectivity expectations against the cluster or manifests",
+		Long: `Verify the expectations of a file: connections between pods, workloads, pods selected by labels or
+addresses, each expected to be allowed or denied. The command fails if any expectation is not met or
+can't be evaluated, so that the intended connectivity can be pinned as tests in CI.
+
+	namespace: web
+	expectations:
+	- name: the frontend reaches the api
+	  from: deploy/frontend
+	  to: deploy/api
+	  port: 8080
+	  expect: allow
+	- from: {selector: role=frontend}
+	  to: {namespace: data, selector: tier=db}
+	  port: 5432
+	  expect: deny
+
+The results are written as a table, as JSON, as JUnit XML or in the Test Anything Protocol (TAP).
+The objects of all the namespaces are evaluated.`,
+		Example: `  kubepox verify expectations.yaml
+  kubepox verify expectations.yaml -f manifests/ -o junit > report.xml`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if output != "table" && output != "json" && output != "junit" && output != "tap" {
+				return fmt.Errorf("unknown output format %q", output)
+			}
+
+			file, err := expect.Load(args[0])
+			if err != nil {
+				return fmt.Errorf("Couldn't load expectations: %v", err)
+			}
+
+			flags.allNamespaces = true
+			state, err := o.loadState(&flags)
+			if err != nil {
+				return err
+			}
+
+			results := file.Verify(state)
+
+			switch output {
+			case "json":
+				pp, _ := json.MarshalIndent(results, "", "   ")
+				fmt.Println(string(pp))
+			case "junit":
+				err = expect.WriteJUnit(os.Stdout, filepath.Base(args[0]), results)
+			case "tap":
+				err = expect.WriteTAP(os.Stdout, results)
+			default:
+				err = renderExpectations(results)
+			}
+			if err != nil {
+				return err
+			}
+
+			failed := 0
+			for i := range results {
+				if !results[i].Passed() {
+					failed++
+				}
+			}
+			if failed > 0 {
+				return fmt.Errorf("%d of %d expectations failed", failed, len(results))
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringSliceVarP(&flags.manifests, "manifests", "f", nil, "Evaluate the objects of manifest files or directories instead of a live cluster")
+	cmd.Flags().StringVarP(&output, "output", "o", "table", "Output format: table, json, junit or tap")
+
+	return cmd
+}
+
+func renderExpectations(results []expect.Result) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "RESULT\tEXPECTATION\tDETAILS")
+	for _, r := range results {
+		status, details := "PASS", ""
+		switch {
+		case r.Error != "":
+			status, details = "ERROR", r.Error
+		case !r.Passed():
+			mismatches := []string{}
+			for _, m := range r.Mismatches {
+				mismatches = append(mismatches, fmt.Sprintf("%s -> %s %s", m.From, m.To, m.Got))
+			}
+			status, details = "FAIL", strings.Join(mismatches, ", ")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", status, r.Expectation.String(), details)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/aporeto-inc/kubepox/cluster"
+	"github.com/aporeto-inc/kubepox/isolation"
+	"github.com/spf13/cobra"
+)
+
+// newWatchCommand keeps a live view of the cluster and prints a line whenever the isolation of a pod changes.
+func newWatchCommand(o *rootOptions) *cobra.Command {
+	var allNamespaces bool
+
+	cmd := &cobra.Command{
+		Use:   "watch",
+		Short: "Stream the changes of pod isolation, policy selection and effective rules",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := o.clientset()
+			if err != nil {
+				return fmt.Errorf("Error creating REST Kube Client: %v", err)
+			}
+
+			namespace := ""
+			if !allNamespaces {
+				if namespace, err = o.namespace(); err != nil {
+					return err
+				}
+			}
+
+			stop := make(chan struct{})
+			defer close(stop)
+			cache := cluster.NewCache(client, namespace)
+			if err := cache.Start(stop); err != nil {
+				return err
+			}
+
+			signals := make(chan os.Signal, 1)
+			signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+			var previous *isolation.State
+			for {
+				state, err := cache.State()
+				if err != nil {
+					return err
+				}
+				current, err := isolation.Compute(state)
+				if err != nil {
+					return fmt.Errorf("Error computing isolation: %v", err)
+				}
+				if previous == nil {
+					fmt.Printf("%s watching %d pods and %d policies\n", timestamp(), len(current.Pods), len(current.Policies))
+				} else {
+					for _, line := range isolation.Diff(previous, current) {
+						fmt.Printf("%s %s\n", timestamp(), line)
+					}
+				}
+				previous = current
+
+				select {
+				case <-cache.Changes():
+				case <-signals:
+					return nil
+				}
+			}
+		},
+	}
+	cmd.Flags().BoolVarP(&allNamespaces, "all-namespaces", "A", false, "Watch all the namespaces")
+
+	return cmd
+}
+
+func timestamp() string {
+	return time.Now().UTC().Format(time.RFC3339)
+}
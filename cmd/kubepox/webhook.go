@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/aporeto-inc/kubepox/cluster"
+	"github.com/aporeto-inc/kubepox/webhook"
+	"github.com/spf13/cobra"
+
+	"sigs.k8s.io/yaml"
+)
+
+// newWebhookCommand runs the validating admission webhook for NetworkPolicies.
+func newWebhookCommand(o *rootOptions) *cobra.Command {
+	var (
+		listen     string
+		certFile   string
+		keyFile    string
+		configFile string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "webhook",
+		Short: "Run a validating admission webhook for NetworkPolicies",
+		Long: `Run a validating admission webhook for NetworkPolicies.
+
+NetworkPolicies with invalid selectors, and changes cutting off the protected flows of the
+configuration file are rejected. Other lint findings are returned as warnings.
+
+Example of configuration file:
+
+  protectedFlows:
+  - name: frontend-to-db
+    from: {namespace: web, selector: role=frontend}
+    to: {namespace: web, selector: role=db}
+    port: 5432
+  reject:
+  - allow-all-namespaces`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			config := webhook.Config{}
+			if configFile != "" {
+				data, err := ioutil.ReadFile(configFile)
+				if err != nil {
+					return fmt.Errorf("Couldn't read configuration: %v", err)
+				}
+				if err := yaml.UnmarshalStrict(data, &config); err != nil {
+					return fmt.Errorf("Couldn't parse configuration: %v", err)
+				}
+			}
+
+			client, err := o.clientset()
+			if err != nil {
+				return fmt.Errorf("Error creating REST Kube Client: %v", err)
+			}
+			// Policies can select peers from any namespace: the webhook always watches the whole cluster.
+			cache := cluster.NewCache(client, "")
+			if err := cache.Start(make(chan struct{})); err != nil {
+				return err
+			}
+
+			mux := http.NewServeMux()
+			mux.Handle("/validate", webhook.New(cache, config))
+			mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+
+			fmt.Printf("Serving on %s\n", listen)
+			if certFile == "" {
+				return http.ListenAndServe(listen, mux)
+			}
+			return http.ListenAndServeTLS(listen, certFile, keyFile, mux)
+		},
+	}
+	cmd.Flags().StringVar(&listen, "listen", ":8443", "Address to listen on")
+	cmd.Flags().StringVar(&certFile, "tls-cert-file", "", "TLS certificate. The API server requires webhooks to be served over TLS")
+	cmd.Flags().StringVar(&keyFile, "tls-private-key-file", "", "TLS private key")
+	cmd.Flags().StringVar(&configFile, "config", "", "Configuration file with the protected flows")
+
+	return cmd
+}
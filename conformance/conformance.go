@@ -0,0 +1,248 @@
+// Package conformance runs scenarios checking the kubepox verdicts against the expected NetworkPolicy semantics.
+//
+// A scenario is a YAML file describing namespaces, pods and NetworkPolicies, and the connections to evaluate
+// with their expected verdict:
+//
+//	name: egress-only policy
+//	namespaces:
+//	- {name: x, labels: {ns: x}}
+//	pods:
+//	- {name: a, namespace: x, labels: {pod: a}, ip: 10.0.0.1}
+//	- {name: b, namespace: x, labels: {pod: b}, ip: 10.0.0.2}
+//	policies:
+//	- metadata: {name: egress, namespace: x}
+//	  spec:
+//	    podSelector: {matchLabels: {pod: a}}
+//	    policyTypes: [Egress]
+//	cases:
+//	- {from: x/a, to: x/b, port: 80, expect: deny}
+//
+// The ends of a case are either namespace/pod or an address outside of the cluster. The protocol defaults to TCP.
+// As in any YAML 1.1 file, names such as y or n must be quoted, or they are read as booleans.
+package conformance
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/aporeto-inc/kubepox"
+	"github.com/aporeto-inc/kubepox/cluster"
+
+	api "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// Expected verdicts of a Case.
+const (
+	Allow = "allow"
+	Deny  = "deny"
+)
+
+// Scenario is a cluster state and the connections to evaluate on it.
+type Scenario struct {
+	Name        string                     `json:"name"`
+	Description string                     `json:"description,omitempty"`
+	Namespaces  []Namespace                `json:"namespaces,omitempty"`
+	Pods        []Pod                      `json:"pods,omitempty"`
+	Policies    []networking.NetworkPolicy `json:"policies,omitempty"`
+	Cases       []Case                     `json:"cases"`
+
+	// File is the file the scenario was loaded from.
+	File string `json:"-"`
+}
+
+// Namespace is a namespace of a Scenario.
+type Namespace struct {
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// Pod is a running pod of a Scenario.
+type Pod struct {
+	Name      string              `json:"name"`
+	Namespace string              `json:"namespace,omitempty"`
+	Labels    map[string]string   `json:"labels,omitempty"`
+	IP        string              `json:"ip,omitempty"`
+	Ports     []api.ContainerPort `json:"ports,omitempty"`
+}
+
+// Case is a connection and its expected verdict.
+type Case struct {
+	Description string       `json:"description,omitempty"`
+	From        string       `json:"from"`
+	To          string       `json:"to"`
+	Port        int32        `json:"port"`
+	Protocol    api.Protocol `json:"protocol,omitempty"`
+	Expect      string       `json:"expect"`
+}
+
+// String describes the connection of the case.
+func (c *Case) String() string {
+	s := fmt.Sprintf("%s -> %s %s/%d", c.From, c.To, c.Protocol, c.Port)
+	if c.Description != "" {
+		s += " (" + c.Description + ")"
+	}
+	return s
+}
+
+// Result is the outcome of a Case.
+type Result struct {
+	Case    Case
+	Got     string
+	Verdict *kubepox.Verdict
+}
+
+// Passed returns true if the verdict is the expected one.
+func (r *Result) Passed() bool {
+	return r.Got == r.Case.Expect
+}
+
+// LoadScenario loads and validates a scenario file.
+func LoadScenario(file string) (*Scenario, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	scenario := &Scenario{}
+	if err := yaml.UnmarshalStrict(data, scenario); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	scenario.File = file
+	if scenario.Name == "" {
+		scenario.Name = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	}
+
+	for i := range scenario.Pods {
+		if scenario.Pods[i].Namespace == "" {
+			scenario.Pods[i].Namespace = metav1.NamespaceDefault
+		}
+	}
+	for i := range scenario.Policies {
+		if scenario.Policies[i].Namespace == "" {
+			scenario.Policies[i].Namespace = metav1.NamespaceDefault
+		}
+	}
+	for i := range scenario.Cases {
+		c := &scenario.Cases[i]
+		if c.Protocol == "" {
+			c.Protocol = api.ProtocolTCP
+		}
+		if c.Expect != Allow && c.Expect != Deny {
+			return nil, fmt.Errorf("%s: case %s: invalid expected verdict %q", file, c, c.Expect)
+		}
+	}
+	return scenario, nil
+}
+
+// LoadScenarios loads every scenario of a directory, in the order of the file names.
+func LoadScenarios(dir string) ([]*Scenario, error) {
+	files := []string{}
+	for _, pattern := range []string{"*.yaml", "*.yml"} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	sort.Strings(files)
+
+	scenarios := []*Scenario{}
+	for _, file := range files {
+		scenario, err := LoadScenario(file)
+		if err != nil {
+			return nil, err
+		}
+		scenarios = append(scenarios, scenario)
+	}
+	return scenarios, nil
+}
+
+// State returns the cluster state described by the scenario.
+func (s *Scenario) State() *cluster.State {
+	state := &cluster.State{}
+	for _, namespace := range s.Namespaces {
+		state.Namespaces.Items = append(state.Namespaces.Items, api.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   namespace.Name,
+				Labels: namespace.Labels,
+			},
+		})
+	}
+	for _, pod := range s.Pods {
+		state.Pods.Items = append(state.Pods.Items, api.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      pod.Name,
+				Namespace: pod.Namespace,
+				Labels:    pod.Labels,
+			},
+			Spec: api.PodSpec{
+				Containers: []api.Container{
+					api.Container{
+						Name:  "server",
+						Ports: pod.Ports,
+					},
+				},
+			},
+			Status: api.PodStatus{
+				Phase: api.PodRunning,
+				PodIP: pod.IP,
+			},
+		})
+	}
+	state.Policies.Items = append(state.Policies.Items, s.Policies...)
+	return state
+}
+
+// Run evaluates every case of the scenario.
+func (s *Scenario) Run() ([]Result, error) {
+	state := s.State()
+
+	results := []Result{}
+	for _, c := range s.Cases {
+		src, err := endpoint(state, c.From)
+		if err != nil {
+			return nil, fmt.Errorf("case %s: %v", &c, err)
+		}
+		dst, err := endpoint(state, c.To)
+		if err != nil {
+			return nil, fmt.Errorf("case %s: %v", &c, err)
+		}
+
+		verdict, err := kubepox.EvaluateTraffic(src, dst, c.Port, c.Protocol, &state.Namespaces, &state.Policies)
+		if err != nil {
+			return nil, fmt.Errorf("case %s: %v", &c, err)
+		}
+		got := Deny
+		if verdict.Allowed {
+			got = Allow
+		}
+		results = append(results, Result{
+			Case:    c,
+			Got:     got,
+			Verdict: verdict,
+		})
+	}
+	return results, nil
+}
+
+// endpoint resolves namespace/pod to a pod of the state, and anything else to an address.
+func endpoint(state *cluster.State, ref string) (*kubepox.Endpoint, error) {
+	if parts := strings.SplitN(ref, "/", 2); len(parts) == 2 {
+		pod := state.Pod(parts[0], parts[1])
+		if pod == nil {
+			return nil, fmt.Errorf("pod %s not found", ref)
+		}
+		return kubepox.PodEndpoint(pod), nil
+	}
+	ip := net.ParseIP(ref)
+	if ip == nil {
+		return nil, fmt.Errorf("%s is neither namespace/pod nor an address", ref)
+	}
+	return kubepox.IPEndpoint(ip), nil
+}
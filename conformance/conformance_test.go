@@ -0,0 +1,43 @@
+package conformance
+
+import (
+	"testing"
+)
+
+func TestScenarios(t *testing.T) {
+	scenarios, err := LoadScenarios("testdata")
+	if err != nil {
+		t.Fatalf("Error loading scenarios: %s", err)
+	}
+	if len(scenarios) == 0 {
+		t.Fatalf("No scenario in testdata")
+	}
+
+	for _, scenario := range scenarios {
+		t.Log("Testing scenario ", scenario.Name)
+		results, err := scenario.Run()
+		if err != nil {
+			t.Errorf("%s: %s", scenario.File, err)
+			continue
+		}
+		for _, result := range results {
+			if !result.Passed() {
+				t.Errorf("%s: %s: got %s expected %s (%+v)", scenario.File, &result.Case, result.Got, result.Case.Expect, result.Verdict)
+			}
+		}
+	}
+}
+
+func TestLoadScenario(t *testing.T) {
+	scenario, err := LoadScenario("testdata/named-ports.yaml")
+	if err != nil {
+		t.Fatalf("Error loading scenario: %s", err)
+	}
+	if scenario.Cases[0].Protocol != "TCP" {
+		t.Errorf("Got protocol %s expected TCP by default", scenario.Cases[0].Protocol)
+	}
+
+	if _, err := LoadScenario("testdata/missing.yaml"); err == nil {
+		t.Errorf("Expected an error loading a missing scenario")
+	}
+}
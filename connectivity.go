@@ -0,0 +1,307 @@
+package kubepox
+
+import (
+	"fmt"
+	"net"
+
+	api "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// Endpoint is one side of a connection: a pod of the cluster or an address outside of the cluster.
+type Endpoint struct {
+	// Pod is the pod behind the endpoint. It is nil for an address outside of the cluster.
+	Pod *api.Pod
+	// IP is the address of the endpoint. It is only used to match ipBlock peers.
+	IP net.IP
+}
+
+// PodEndpoint returns the Endpoint of a pod, using its PodIP as address.
+func PodEndpoint(pod *api.Pod) *Endpoint {
+	return &Endpoint{
+		Pod: pod,
+		IP:  net.ParseIP(pod.Status.PodIP),
+	}
+}
+
+// IPEndpoint returns the Endpoint of an address outside of the cluster.
+func IPEndpoint(ip net.IP) *Endpoint {
+	return &Endpoint{
+		IP: ip,
+	}
+}
+
+// String returns namespace/name for a pod and the address otherwise.
+func (e *Endpoint) String() string {
+	if e.Pod != nil {
+		return e.Pod.Namespace + "/" + e.Pod.Name
+	}
+	return e.IP.String()
+}
+
+// Verdict is the result of the evaluation of a connection against a set of policies.
+type Verdict struct {
+	// Allowed is true if the connection is allowed on both the egress of the source and the ingress of the destination.
+	Allowed bool `json:"allowed"`
+	// EgressIsolated is true if the source is selected by at least one policy applicable to Egress.
+	EgressIsolated bool `json:"egressIsolated"`
+	// EgressAllowed is true if the source is not egress isolated or if one of its egress rules allows the connection.
+	EgressAllowed bool `json:"egressAllowed"`
+	// EgressPolicies are the names of the policies with an egress rule allowing the connection.
+	EgressPolicies []string `json:"egressPolicies,omitempty"`
+	// IngressIsolated is true if the destination is selected by at least one policy applicable to Ingress.
+	IngressIsolated bool `json:"ingressIsolated"`
+	// IngressAllowed is true if the destination is not ingress isolated or if one of its ingress rules allows the connection.
+	IngressAllowed bool `json:"ingressAllowed"`
+	// IngressPolicies are the names of the policies with an ingress rule allowing the connection.
+	IngressPolicies []string `json:"ingressPolicies,omitempty"`
+}
+
+// IsTrafficAllowed returns true if the policies allow the source pod to connect to the destination pod on the given port.
+// namespaces is used to resolve namespaceSelectors and can be nil if no policy uses them.
+func IsTrafficAllowed(src, dst *api.Pod, port int32, protocol api.Protocol, namespaces *api.NamespaceList, allPolicies *networking.NetworkPolicyList) (bool, error) {
+	verdict, err := EvaluateTraffic(PodEndpoint(src), PodEndpoint(dst), port, protocol, namespaces, allPolicies)
+	if err != nil {
+		return false, err
+	}
+	return verdict.Allowed, nil
+}
+
+// EvaluateTraffic evaluates a connection from src to dst on the given port against all the policies.
+// An empty protocol is considered as TCP. Pods using the host network are evaluated as their address only.
+func EvaluateTraffic(src, dst *Endpoint, port int32, protocol api.Protocol, namespaces *api.NamespaceList, allPolicies *networking.NetworkPolicyList) (*Verdict, error) {
+	if protocol == "" {
+		protocol = api.ProtocolTCP
+	}
+	src, dst = networkEndpoint(src), networkEndpoint(dst)
+	verdict := &Verdict{
+		EgressAllowed:  true,
+		IngressAllowed: true,
+	}
+
+	// Egress is evaluated on the policies selecting the source.
+	if src.Pod != nil {
+		policies, err := ListPoliciesPerPod(src.Pod, allPolicies)
+		if err != nil {
+			return nil, err
+		}
+		for _, policy := range policies.Items {
+			if !IsPolicyApplicableToEgress(&policy) {
+				continue
+			}
+			verdict.EgressIsolated = true
+			for _, rule := range policy.Spec.Egress {
+				peerMatch, err := peersMatch(rule.To, &policy, dst, namespaces)
+				if err != nil {
+					return nil, err
+				}
+				if peerMatch && portsMatch(rule.Ports, dst, port, protocol) {
+					verdict.EgressPolicies = append(verdict.EgressPolicies, policy.Name)
+					break
+				}
+			}
+		}
+		verdict.EgressAllowed = !verdict.EgressIsolated || len(verdict.EgressPolicies) > 0
+	}
+
+	// Ingress is evaluated on the policies selecting the destination.
+	if dst.Pod != nil {
+		policies, err := ListPoliciesPerPod(dst.Pod, allPolicies)
+		if err != nil {
+			return nil, err
+		}
+		for _, policy := range policies.Items {
+			if !IsPolicyApplicableToIngress(&policy) {
+				continue
+			}
+			verdict.IngressIsolated = true
+			for _, rule := range policy.Spec.Ingress {
+				peerMatch, err := peersMatch(rule.From, &policy, src, namespaces)
+				if err != nil {
+					return nil, err
+				}
+				if peerMatch && portsMatch(rule.Ports, dst, port, protocol) {
+					verdict.IngressPolicies = append(verdict.IngressPolicies, policy.Name)
+					break
+				}
+			}
+		}
+		verdict.IngressAllowed = !verdict.IngressIsolated || len(verdict.IngressPolicies) > 0
+	}
+
+	verdict.Allowed = verdict.EgressAllowed && verdict.IngressAllowed
+	return verdict, nil
+}
+
+// peersMatch returns true if the endpoint is one of the peers of a rule of the policy.
+// An empty list of peers matches every endpoint.
+func peersMatch(peers []networking.NetworkPolicyPeer, policy *networking.NetworkPolicy, endpoint *Endpoint, namespaces *api.NamespaceList) (bool, error) {
+	if len(peers) == 0 {
+		return true, nil
+	}
+	for i := range peers {
+		match, err := PeerMatches(&peers[i], policy.Namespace, endpoint, namespaces)
+		if err != nil {
+			return false, err
+		}
+		if match {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// PeerMatches returns true if the endpoint is selected by the peer of a rule from a policy of the given namespace.
+func PeerMatches(peer *networking.NetworkPolicyPeer, policyNamespace string, endpoint *Endpoint, namespaces *api.NamespaceList) (bool, error) {
+	if peer.IPBlock != nil {
+		return ipBlockMatches(peer.IPBlock, endpoint.IP)
+	}
+
+	// Pod and Namespace selectors only select pods of the cluster.
+	if endpoint.Pod == nil {
+		return false, nil
+	}
+
+	if peer.NamespaceSelector == nil {
+		if endpoint.Pod.Namespace != policyNamespace {
+			return false, nil
+		}
+	} else {
+		selector, err := metav1.LabelSelectorAsSelector(peer.NamespaceSelector)
+		if err != nil {
+			return false, err
+		}
+		if !selector.Matches(labels.Set(namespaceLabels(endpoint.Pod.Namespace, namespaces))) {
+			return false, nil
+		}
+	}
+
+	if peer.PodSelector == nil {
+		return true, nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(peer.PodSelector)
+	if err != nil {
+		return false, err
+	}
+	return selector.Matches(labels.Set(endpoint.Pod.GetLabels())), nil
+}
+
+// namespaceLabels returns the labels of a namespace out of the list, nil if it is not part of the list.
+func namespaceLabels(name string, namespaces *api.NamespaceList) map[string]string {
+	if namespaces == nil {
+		return nil
+	}
+	for _, namespace := range namespaces.Items {
+		if namespace.Name == name {
+			return namespace.GetLabels()
+		}
+	}
+	return nil
+}
+
+// ipBlockMatches returns true if the ip is part of the CIDR and not part of any of the exceptions.
+func ipBlockMatches(block *networking.IPBlock, ip net.IP) (bool, error) {
+	if ip == nil {
+		return false, nil
+	}
+	_, cidr, err := net.ParseCIDR(block.CIDR)
+	if err != nil {
+		return false, fmt.Errorf("invalid ipBlock cidr %s: %v", block.CIDR, err)
+	}
+	if !cidr.Contains(ip) {
+		return false, nil
+	}
+	for _, except := range block.Except {
+		_, exceptCIDR, err := net.ParseCIDR(except)
+		if err != nil {
+			return false, fmt.Errorf("invalid ipBlock except %s: %v", except, err)
+		}
+		if exceptCIDR.Contains(ip) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// portsMatch returns true if the port and protocol are part of the ports of a rule.
+// An empty list of ports matches every port. Named ports are resolved against the containers of the destination.
+func portsMatch(ports []networking.NetworkPolicyPort, dst *Endpoint, port int32, protocol api.Protocol) bool {
+	if len(ports) == 0 {
+		return true
+	}
+	for _, rulePort := range ports {
+		ruleProtocol := api.ProtocolTCP
+		if rulePort.Protocol != nil {
+			ruleProtocol = *rulePort.Protocol
+		}
+		if ruleProtocol != protocol {
+			continue
+		}
+		if rulePort.Port == nil {
+			return true
+		}
+		if rulePort.Port.Type == intstr.Int {
+			if rulePort.Port.IntVal == port {
+				return true
+			}
+			continue
+		}
+		if resolved, ok := ResolveNamedPort(dst.Pod, rulePort.Port.StrVal, protocol); ok && resolved == port {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolveNamedPort returns the number of the container port with the given name and protocol in the pod.
+func ResolveNamedPort(pod *api.Pod, name string, protocol api.Protocol) (int32, bool) {
+	if pod == nil {
+		return 0, false
+	}
+	for _, container := range pod.Spec.Containers {
+		for _, containerPort := range container.Ports {
+			containerProtocol := containerPort.Protocol
+			if containerProtocol == "" {
+				containerProtocol = api.ProtocolTCP
+			}
+			if containerPort.Name == name && containerProtocol == protocol {
+				return containerPort.ContainerPort, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// ConnectivityMatrix holds the verdicts between every pair of pods for a given port.
+type ConnectivityMatrix struct {
+	// Pods are the namespace/name of the pods, in the order of the rows and columns of Allowed.
+	Pods []string `json:"pods"`
+	// Allowed is true in [i][j] if Pods[i] can connect to Pods[j].
+	Allowed [][]bool `json:"allowed"`
+}
+
+// BuildConnectivityMatrix evaluates the connectivity between every pair of pods of the list on the given port.
+func BuildConnectivityMatrix(allPods *api.PodList, port int32, protocol api.Protocol, namespaces *api.NamespaceList, allPolicies *networking.NetworkPolicyList) (*ConnectivityMatrix, error) {
+	matrix := &ConnectivityMatrix{
+		Pods:    make([]string, len(allPods.Items)),
+		Allowed: make([][]bool, len(allPods.Items)),
+	}
+
+	for i := range allPods.Items {
+		src := PodEndpoint(&allPods.Items[i])
+		matrix.Pods[i] = src.String()
+		matrix.Allowed[i] = make([]bool, len(allPods.Items))
+		for j := range allPods.Items {
+			verdict, err := EvaluateTraffic(src, PodEndpoint(&allPods.Items[j]), port, protocol, namespaces, allPolicies)
+			if err != nil {
+				return nil, err
+			}
+			matrix.Allowed[i][j] = verdict.Allowed
+		}
+	}
+
+	return matrix, nil
+}
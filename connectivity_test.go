@@ -0,0 +1,301 @@
+package kubepox
+
+import (
+	"net"
+	"testing"
+
+	api "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+var protocolTCP = api.ProtocolTCP
+
+var namedPort = intstr.FromString("http")
+
+var port80 = intstr.FromInt(80)
+
+// npnamedport allows ingress to role=frontend from role=backend on the http named port
+var npnamedport = networking.NetworkPolicy{
+	ObjectMeta: metav1.ObjectMeta{
+		Name: "npnamedport",
+	},
+	Spec: networking.NetworkPolicySpec{
+		PodSelector: metav1.LabelSelector{
+			MatchLabels: map[string]string{
+				"role": "frontend",
+			},
+		},
+		Ingress: []networking.NetworkPolicyIngressRule{
+			networking.NetworkPolicyIngressRule{
+				From: []networking.NetworkPolicyPeer{
+					networking.NetworkPolicyPeer{
+						PodSelector: &metav1.LabelSelector{
+							MatchLabels: map[string]string{
+								"role": "backend",
+							},
+						},
+					},
+				},
+				Ports: []networking.NetworkPolicyPort{
+					networking.NetworkPolicyPort{
+						Protocol: &protocolTCP,
+						Port:     &namedPort,
+					},
+				},
+			},
+		},
+	},
+}
+
+// npnamespace allows ingress to role=frontend from any pod of the namespaces with team=x on port 80
+var npnamespace = networking.NetworkPolicy{
+	ObjectMeta: metav1.ObjectMeta{
+		Name: "npnamespace",
+	},
+	Spec: networking.NetworkPolicySpec{
+		PodSelector: metav1.LabelSelector{
+			MatchLabels: map[string]string{
+				"role": "frontend",
+			},
+		},
+		Ingress: []networking.NetworkPolicyIngressRule{
+			networking.NetworkPolicyIngressRule{
+				From: []networking.NetworkPolicyPeer{
+					networking.NetworkPolicyPeer{
+						NamespaceSelector: &metav1.LabelSelector{
+							MatchLabels: map[string]string{
+								"team": "x",
+							},
+						},
+					},
+				},
+				Ports: []networking.NetworkPolicyPort{
+					networking.NetworkPolicyPort{
+						Port: &port80,
+					},
+				},
+			},
+		},
+	},
+}
+
+// npipblock allows ingress to role=frontend from 10.0.0.0/8 except 10.1.0.0/16
+var npipblock = networking.NetworkPolicy{
+	ObjectMeta: metav1.ObjectMeta{
+		Name: "npipblock",
+	},
+	Spec: networking.NetworkPolicySpec{
+		PodSelector: metav1.LabelSelector{
+			MatchLabels: map[string]string{
+				"role": "frontend",
+			},
+		},
+		Ingress: []networking.NetworkPolicyIngressRule{
+			networking.NetworkPolicyIngressRule{
+				From: []networking.NetworkPolicyPeer{
+					networking.NetworkPolicyPeer{
+						IPBlock: &networking.IPBlock{
+							CIDR:   "10.0.0.0/8",
+							Except: []string{"10.1.0.0/16"},
+						},
+					},
+				},
+			},
+		},
+	},
+}
+
+// pod1withport is pod1 with a container port named http
+var pod1withport = api.Pod{
+	ObjectMeta: pod1.ObjectMeta,
+	Spec: api.PodSpec{
+		Containers: []api.Container{
+			api.Container{
+				Ports: []api.ContainerPort{
+					api.ContainerPort{
+						Name:          "http",
+						ContainerPort: 8080,
+					},
+				},
+			},
+		},
+	},
+}
+
+// pod2namespacex is a pod with role=backend in namespace x
+var pod2namespacex = api.Pod{
+	ObjectMeta: metav1.ObjectMeta{
+		Name:      "pod2",
+		Namespace: "x",
+		Labels: map[string]string{
+			"role": "backend",
+		},
+	},
+}
+
+var namespaces = api.NamespaceList{
+	Items: []api.Namespace{
+		api.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "x",
+				Labels: map[string]string{
+					"team": "x",
+				},
+			},
+		},
+	},
+}
+
+func TestEvaluateTraffic(t *testing.T) {
+	type testStruct struct {
+		Policies networking.NetworkPolicyList
+		Src      *Endpoint
+		Dst      *Endpoint
+		Port     int32
+		Allowed  bool
+	}
+
+	tests := []testStruct{
+		testStruct{
+			Policies: buildNetworkPolicyList(),
+			Src:      PodEndpoint(&pod2),
+			Dst:      PodEndpoint(&pod1),
+			Port:     80,
+			Allowed:  true,
+		},
+		testStruct{
+			Policies: buildNetworkPolicyList(np1),
+			Src:      PodEndpoint(&pod2),
+			Dst:      PodEndpoint(&pod1),
+			Port:     80,
+			Allowed:  true,
+		},
+		testStruct{
+			Policies: buildNetworkPolicyList(np1),
+			Src:      PodEndpoint(&pod1),
+			Dst:      PodEndpoint(&pod1),
+			Port:     80,
+			Allowed:  false,
+		},
+		testStruct{
+			Policies: buildNetworkPolicyList(np2),
+			Src:      PodEndpoint(&pod1),
+			Dst:      PodEndpoint(&pod2),
+			Port:     80,
+			Allowed:  true,
+		},
+		testStruct{
+			Policies: buildNetworkPolicyList(np2),
+			Src:      PodEndpoint(&pod1),
+			Dst:      PodEndpoint(&pod1),
+			Port:     80,
+			Allowed:  false,
+		},
+		testStruct{
+			Policies: buildNetworkPolicyList(defaultdenyingress, defaultallowingress),
+			Src:      PodEndpoint(&pod1),
+			Dst:      PodEndpoint(&pod2),
+			Port:     80,
+			Allowed:  true,
+		},
+		testStruct{
+			Policies: buildNetworkPolicyList(defaultdenyegress),
+			Src:      PodEndpoint(&pod1),
+			Dst:      PodEndpoint(&pod2),
+			Port:     80,
+			Allowed:  false,
+		},
+		testStruct{
+			Policies: buildNetworkPolicyList(npnamedport),
+			Src:      PodEndpoint(&pod2),
+			Dst:      PodEndpoint(&pod1withport),
+			Port:     8080,
+			Allowed:  true,
+		},
+		testStruct{
+			Policies: buildNetworkPolicyList(npnamedport),
+			Src:      PodEndpoint(&pod2),
+			Dst:      PodEndpoint(&pod1withport),
+			Port:     80,
+			Allowed:  false,
+		},
+		testStruct{
+			Policies: buildNetworkPolicyList(npnamespace),
+			Src:      PodEndpoint(&pod2namespacex),
+			Dst:      PodEndpoint(&pod1),
+			Port:     80,
+			Allowed:  true,
+		},
+		testStruct{
+			Policies: buildNetworkPolicyList(npnamespace),
+			Src:      PodEndpoint(&pod2),
+			Dst:      PodEndpoint(&pod1),
+			Port:     80,
+			Allowed:  false,
+		},
+		testStruct{
+			Policies: buildNetworkPolicyList(np1),
+			Src:      PodEndpoint(&pod2namespacex),
+			Dst:      PodEndpoint(&pod1),
+			Port:     80,
+			Allowed:  false,
+		},
+		testStruct{
+			Policies: buildNetworkPolicyList(npipblock),
+			Src:      IPEndpoint(net.ParseIP("10.2.0.1")),
+			Dst:      PodEndpoint(&pod1),
+			Port:     80,
+			Allowed:  true,
+		},
+		testStruct{
+			Policies: buildNetworkPolicyList(npipblock),
+			Src:      IPEndpoint(net.ParseIP("10.1.0.1")),
+			Dst:      PodEndpoint(&pod1),
+			Port:     80,
+			Allowed:  false,
+		},
+		testStruct{
+			Policies: buildNetworkPolicyList(npipblock),
+			Src:      PodEndpoint(&pod2),
+			Dst:      PodEndpoint(&pod1),
+			Port:     80,
+			Allowed:  false,
+		},
+	}
+
+	for i, test := range tests {
+		t.Log("Testing EvaluateTraffic ", i)
+		verdict, err := EvaluateTraffic(test.Src, test.Dst, test.Port, api.ProtocolTCP, &namespaces, &test.Policies)
+		if err != nil {
+			t.Errorf("Error on EvaluateTraffic for test %d : %s", i, err)
+			continue
+		}
+		if verdict.Allowed != test.Allowed {
+			t.Errorf("Verdict error. Test %d Got %t expected %t (%+v)", i, verdict.Allowed, test.Allowed, verdict)
+		}
+	}
+}
+
+func TestBuildConnectivityMatrix(t *testing.T) {
+	pods := buildPodList(pod1, pod2)
+	policies := buildNetworkPolicyList(np1)
+
+	matrix, err := BuildConnectivityMatrix(&pods, 80, api.ProtocolTCP, nil, &policies)
+	if err != nil {
+		t.Fatalf("Error on BuildConnectivityMatrix: %s", err)
+	}
+
+	expected := [][]bool{
+		{false, true},
+		{true, true},
+	}
+	for i := range expected {
+		for j := range expected[i] {
+			if matrix.Allowed[i][j] != expected[i][j] {
+				t.Errorf("Matrix error for %s -> %s. Got %t expected %t", matrix.Pods[i], matrix.Pods[j], matrix.Allowed[i][j], expected[i][j])
+			}
+		}
+	}
+}
@@ -0,0 +1,130 @@
+// Package coverage reports, per namespace, the pods isolated for ingress and egress by the NetworkPolicies.
+//
+// Pods that NetworkPolicies don't govern, on the host network or terminated, are listed apart and left out of
+// the coverage. Workloads without any pod yet, such as in manifests, are covered by their pod template.
+package coverage
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/aporeto-inc/kubepox"
+	"github.com/aporeto-inc/kubepox/cluster"
+
+	api "k8s.io/api/core/v1"
+)
+
+// Namespace is the isolation coverage of the pods of a namespace.
+type Namespace struct {
+	Namespace              string   `json:"namespace"`
+	Pods                   int      `json:"pods"`
+	IngressDefaultDeny     bool     `json:"ingressDefaultDeny"`
+	EgressDefaultDeny      bool     `json:"egressDefaultDeny"`
+	IngressCoverage        float64  `json:"ingressCoverage"`
+	EgressCoverage         float64  `json:"egressCoverage"`
+	PodsNotIngressIsolated []string `json:"podsNotIngressIsolated"`
+	PodsNotEgressIsolated  []string `json:"podsNotEgressIsolated"`
+	// PodsUnenforceable are the pods NetworkPolicies don't govern, left out of the coverage.
+	PodsUnenforceable []string `json:"podsUnenforceable"`
+
+	notIngressIsolated int
+	notEgressIsolated  int
+}
+
+// Compute computes the coverage of every namespace with pods or policies.
+// Namespaces without any pod or policy are also reported if allNamespaces is set.
+// With byWorkload, pods are listed by workload, and the pods still counted one by one.
+func Compute(state *cluster.State, allNamespaces, byWorkload bool) ([]*Namespace, error) {
+	byNamespace := map[string]*Namespace{}
+	coverageOf := func(namespace string) *Namespace {
+		if byNamespace[namespace] == nil {
+			byNamespace[namespace] = &Namespace{
+				Namespace:              namespace,
+				PodsNotIngressIsolated: []string{},
+				PodsNotEgressIsolated:  []string{},
+				PodsUnenforceable:      []string{},
+			}
+		}
+		return byNamespace[namespace]
+	}
+
+	if allNamespaces {
+		for _, namespace := range state.Namespaces.Items {
+			coverageOf(namespace.Name)
+		}
+	}
+
+	for i := range state.Policies.Items {
+		policy := &state.Policies.Items[i]
+		coverage := coverageOf(policy.Namespace)
+		if kubepox.IsDefaultDenyIngress(policy) {
+			coverage.IngressDefaultDeny = true
+		}
+		if kubepox.IsDefaultDenyEgress(policy) {
+			coverage.EgressDefaultDeny = true
+		}
+	}
+
+	// Workloads without any pod yet, such as in manifests, are covered by their pod template.
+	pods := append(append([]api.Pod{}, state.Pods.Items...), state.PendingPods().Items...)
+	for i := range pods {
+		pod := &pods[i]
+		coverage := coverageOf(pod.Namespace)
+		name := pod.Name
+		if byWorkload || cluster.IsTemplatePod(pod) {
+			name = state.WorkloadOf(pod).String()
+		}
+		if kubepox.UnenforceablePods.Excludes(pod) {
+			coverage.PodsUnenforceable = appendUnique(coverage.PodsUnenforceable, fmt.Sprintf("%s (%s)", name, kubepox.ClassifyPod(pod)))
+			continue
+		}
+		coverage.Pods++
+
+		ingress, err := kubepox.IsPodSelectedIngress(pod, &state.Policies)
+		if err != nil {
+			return nil, err
+		}
+		if !ingress {
+			coverage.notIngressIsolated++
+			coverage.PodsNotIngressIsolated = appendUnique(coverage.PodsNotIngressIsolated, name)
+		}
+		egress, err := kubepox.IsPodSelectedEgress(pod, &state.Policies)
+		if err != nil {
+			return nil, err
+		}
+		if !egress {
+			coverage.notEgressIsolated++
+			coverage.PodsNotEgressIsolated = appendUnique(coverage.PodsNotEgressIsolated, name)
+		}
+	}
+
+	result := make([]*Namespace, 0, len(byNamespace))
+	for _, coverage := range byNamespace {
+		coverage.IngressCoverage = percentage(coverage.Pods-coverage.notIngressIsolated, coverage.Pods)
+		coverage.EgressCoverage = percentage(coverage.Pods-coverage.notEgressIsolated, coverage.Pods)
+		result = append(result, coverage)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Namespace < result[j].Namespace
+	})
+
+	return result, nil
+}
+
+// appendUnique appends the name to the list if it is not part of it yet.
+func appendUnique(names []string, name string) []string {
+	for _, n := range names {
+		if n == name {
+			return names
+		}
+	}
+	return append(names, name)
+}
+
+// percentage returns the percentage of part in total. An empty namespace is fully covered.
+func percentage(part, total int) float64 {
+	if total == 0 {
+		return 100
+	}
+	return float64(part) * 100 / float64(total)
+}
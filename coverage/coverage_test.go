@@ -0,0 +1,140 @@
+package coverage
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aporeto-inc/kubepox/cluster"
+
+	apps "k8s.io/api/apps/v1"
+	api "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func buildPod(name string, labels map[string]string, owner string) api.Pod {
+	pod := api.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "web", Labels: labels},
+		Status:     api.PodStatus{Phase: api.PodRunning, PodIP: "10.0.0.1"},
+	}
+	if owner != "" {
+		controller := true
+		pod.OwnerReferences = []metav1.OwnerReference{{Kind: cluster.KindReplicaSet, Name: owner, Controller: &controller}}
+	}
+	return pod
+}
+
+// buildState returns the web namespace with two pods of the frontend Deployment, an api pod isolated for
+// ingress, a pod on the host network and the worker Deployment without any pod, every pod being isolated
+// for egress, and the empty namespace.
+func buildState() *cluster.State {
+	state := &cluster.State{}
+	state.Namespaces.Items = []api.Namespace{
+		{ObjectMeta: metav1.ObjectMeta{Name: "empty"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "web"}},
+	}
+
+	frontend := map[string]string{"app": "frontend", "pod-template-hash": "7d4b9"}
+	agent := buildPod("node-agent", map[string]string{"app": "agent"}, "")
+	agent.Spec.HostNetwork = true
+	state.Pods.Items = []api.Pod{
+		buildPod("frontend-7d4b9-a", frontend, "frontend-7d4b9"),
+		buildPod("frontend-7d4b9-b", frontend, "frontend-7d4b9"),
+		buildPod("api", map[string]string{"app": "api"}, ""),
+		agent,
+	}
+
+	state.Deployments.Items = []apps.Deployment{{
+		ObjectMeta: metav1.ObjectMeta{Name: "worker", Namespace: "web"},
+		Spec: apps.DeploymentSpec{
+			Template: api.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "worker"}}},
+		},
+	}}
+
+	state.Policies.Items = []networking.NetworkPolicy{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "web"},
+			Spec: networking.NetworkPolicySpec{
+				PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "api"}},
+				PolicyTypes: []networking.PolicyType{networking.PolicyTypeIngress},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "default-deny-egress", Namespace: "web"},
+			Spec: networking.NetworkPolicySpec{
+				PolicyTypes: []networking.PolicyType{networking.PolicyTypeEgress},
+			},
+		},
+	}
+	return state
+}
+
+func TestCompute(t *testing.T) {
+	type testStruct struct {
+		AllNamespaces bool
+		ByWorkload    bool
+		Expected      []Namespace
+	}
+
+	tests := []testStruct{
+		testStruct{
+			Expected: []Namespace{
+				Namespace{
+					Namespace:              "web",
+					Pods:                   4,
+					EgressDefaultDeny:      true,
+					IngressCoverage:        25,
+					EgressCoverage:         100,
+					PodsNotIngressIsolated: []string{"frontend-7d4b9-a", "frontend-7d4b9-b", "deployment/worker"},
+					PodsNotEgressIsolated:  []string{},
+					PodsUnenforceable:      []string{"node-agent (host-network)"},
+				},
+			},
+		},
+		testStruct{
+			AllNamespaces: true,
+			ByWorkload:    true,
+			Expected: []Namespace{
+				Namespace{
+					Namespace:              "empty",
+					IngressCoverage:        100,
+					EgressCoverage:         100,
+					PodsNotIngressIsolated: []string{},
+					PodsNotEgressIsolated:  []string{},
+					PodsUnenforceable:      []string{},
+				},
+				Namespace{
+					Namespace:              "web",
+					Pods:                   4,
+					EgressDefaultDeny:      true,
+					IngressCoverage:        25,
+					EgressCoverage:         100,
+					PodsNotIngressIsolated: []string{"deployment/frontend", "deployment/worker"},
+					PodsNotEgressIsolated:  []string{},
+					PodsUnenforceable:      []string{"pod/node-agent (host-network)"},
+				},
+			},
+		},
+	}
+
+	for i, test := range tests {
+		t.Log("Testing Compute ", i)
+		result, err := Compute(buildState(), test.AllNamespaces, test.ByWorkload)
+		if err != nil {
+			t.Errorf("Test %d Got error %s", i, err)
+			continue
+		}
+		if len(result) != len(test.Expected) {
+			t.Errorf("Test %d Got %d namespaces expected %d", i, len(result), len(test.Expected))
+			continue
+		}
+		for j, coverage := range result {
+			// The counters are not part of the expected coverage.
+			got := *coverage
+			got.notIngressIsolated, got.notEgressIsolated = 0, 0
+			if !reflect.DeepEqual(got, test.Expected[j]) {
+				t.Errorf("Test %d Got coverage %+v expected %+v", i, got, test.Expected[j])
+			}
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package kubepox
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	api "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// NamespaceNameLabel is set by Kubernetes 1.21 and later on every namespace, to the name of the namespace.
+const NamespaceNameLabel = "kubernetes.io/metadata.name"
+
+// IsDefaultDenyIngress returns true if the policy selects every pod of its namespace for Ingress without allowing any traffic.
+func IsDefaultDenyIngress(policy *networking.NetworkPolicy) bool {
+	return selectsAllPods(policy) && IsPolicyApplicableToIngress(policy) && len(policy.Spec.Ingress) == 0
+}
+
+// IsDefaultDenyEgress returns true if the policy selects every pod of its namespace for Egress without allowing any traffic.
+func IsDefaultDenyEgress(policy *networking.NetworkPolicy) bool {
+	return selectsAllPods(policy) && IsPolicyApplicableToEgress(policy) && len(policy.Spec.Egress) == 0
+}
+
+// selectsAllPods returns true if the podSelector of the policy is empty.
+func selectsAllPods(policy *networking.NetworkPolicy) bool {
+	return len(policy.Spec.PodSelector.MatchLabels) == 0 && len(policy.Spec.PodSelector.MatchExpressions) == 0
+}
+
+// HasDefaultDeny returns the presence of a default deny policy for Ingress and for Egress in the namespace given as parameter.
+func HasDefaultDeny(namespace string, allPolicies *networking.NetworkPolicyList) (bool, bool) {
+	ingress := false
+	egress := false
+
+	for _, policy := range allPolicies.Items {
+		if policy.Namespace != namespace {
+			continue
+		}
+		if IsDefaultDenyIngress(&policy) {
+			ingress = true
+		}
+		if IsDefaultDenyEgress(&policy) {
+			egress = true
+		}
+	}
+
+	return ingress, egress
+}
+
+// NewDefaultDenyPolicy generates a policy denying all the traffic of the given type to or from the pods of the namespace.
+func NewDefaultDenyPolicy(namespace string, policyType networking.PolicyType) *networking.NetworkPolicy {
+	name := "default-deny-ingress"
+	if policyType == networking.PolicyTypeEgress {
+		name = "default-deny-egress"
+	}
+
+	return &networking.NetworkPolicy{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: networking.SchemeGroupVersion.String(),
+			Kind:       "NetworkPolicy",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Spec: networking.NetworkPolicySpec{
+			PolicyTypes: []networking.PolicyType{
+				policyType,
+			},
+		},
+	}
+}
+
+// NewAllowDNSPolicy generates a policy allowing every pod of the namespace to resolve names with the DNS pods
+// selected by the namespace and pod selectors (typically kube-dns in kube-system), on UDP and TCP port 53.
+// It is the companion of a default deny egress policy.
+func NewAllowDNSPolicy(namespace string, dnsNamespaceSelector, dnsPodSelector *metav1.LabelSelector) *networking.NetworkPolicy {
+	udp := api.ProtocolUDP
+	tcp := api.ProtocolTCP
+	port := intstr.FromInt(53)
+
+	return &networking.NetworkPolicy{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: networking.SchemeGroupVersion.String(),
+			Kind:       "NetworkPolicy",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "allow-dns-egress",
+			Namespace: namespace,
+		},
+		Spec: networking.NetworkPolicySpec{
+			PolicyTypes: []networking.PolicyType{
+				networking.PolicyTypeEgress,
+			},
+			Egress: []networking.NetworkPolicyEgressRule{
+				networking.NetworkPolicyEgressRule{
+					To: []networking.NetworkPolicyPeer{
+						networking.NetworkPolicyPeer{
+							NamespaceSelector: dnsNamespaceSelector,
+							PodSelector:       dnsPodSelector,
+						},
+					},
+					Ports: []networking.NetworkPolicyPort{
+						networking.NetworkPolicyPort{
+							Protocol: &udp,
+							Port:     &port,
+						},
+						networking.NetworkPolicyPort{
+							Protocol: &tcp,
+							Port:     &port,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// DNSNamespaceSelector returns a selector of the namespace of the DNS pods, the pods matching dnsPodSelector.
+// The namespace is selected by its NamespaceNameLabel when it has one, or else by one of its labels that no
+// other namespace has, as clusters older than Kubernetes 1.21 don't set NamespaceNameLabel.
+// An error is returned if the DNS pods are not found, are in several namespaces, or if no label selects their
+// namespace alone.
+func DNSNamespaceSelector(dnsPodSelector *metav1.LabelSelector, pods *api.PodList, namespaces *api.NamespaceList) (*metav1.LabelSelector, error) {
+	selector, err := metav1.LabelSelectorAsSelector(dnsPodSelector)
+	if err != nil {
+		return nil, err
+	}
+	found := map[string]bool{}
+	for _, pod := range pods.Items {
+		if selector.Matches(labels.Set(pod.Labels)) {
+			found[pod.Namespace] = true
+		}
+	}
+	names := []string{}
+	for name := range found {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	switch len(names) {
+	case 0:
+		return nil, fmt.Errorf("no pod matches the DNS pod selector %s", selector)
+	case 1:
+	default:
+		return nil, fmt.Errorf("the DNS pods are in several namespaces: %s", strings.Join(names, ", "))
+	}
+
+	var namespace *api.Namespace
+	for i := range namespaces.Items {
+		if namespaces.Items[i].Name == names[0] {
+			namespace = &namespaces.Items[i]
+		}
+	}
+	if namespace == nil {
+		return nil, fmt.Errorf("namespace %s of the DNS pods is unknown", names[0])
+	}
+	if namespace.Labels[NamespaceNameLabel] == namespace.Name {
+		return &metav1.LabelSelector{MatchLabels: map[string]string{NamespaceNameLabel: namespace.Name}}, nil
+	}
+
+	keys := []string{}
+	for key := range namespace.Labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		unique := true
+		for _, other := range namespaces.Items {
+			if value, ok := other.Labels[key]; ok && other.Name != namespace.Name && value == namespace.Labels[key] {
+				unique = false
+				break
+			}
+		}
+		if unique {
+			return &metav1.LabelSelector{MatchLabels: map[string]string{key: namespace.Labels[key]}}, nil
+		}
+	}
+	return nil, fmt.Errorf("no label selects namespace %s of the DNS pods alone", namespace.Name)
+}
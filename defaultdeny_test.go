@@ -0,0 +1,171 @@
+package kubepox
+
+import (
+	"reflect"
+	"testing"
+
+	api "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// defaultdenynotypes has no policyTypes and no rules: it only applies to ingress
+var defaultdenynotypes = networking.NetworkPolicy{
+	ObjectMeta: metav1.ObjectMeta{
+		Name: "defaultdenynotypes",
+	},
+}
+
+func TestIsDefaultDeny(t *testing.T) {
+	type testStruct struct {
+		Policy        networking.NetworkPolicy
+		ResultIngress bool
+		ResultEgress  bool
+	}
+
+	tests := []testStruct{
+		testStruct{
+			Policy:        defaultdenyingress,
+			ResultIngress: true,
+			ResultEgress:  false,
+		},
+		testStruct{
+			Policy:        defaultdenyegress,
+			ResultIngress: false,
+			ResultEgress:  true,
+		},
+		testStruct{
+			Policy:        defaultdenyall,
+			ResultIngress: true,
+			ResultEgress:  true,
+		},
+		testStruct{
+			Policy:        defaultdenynotypes,
+			ResultIngress: true,
+			ResultEgress:  false,
+		},
+		testStruct{
+			Policy:        defaultallowingress,
+			ResultIngress: false,
+			ResultEgress:  false,
+		},
+		testStruct{
+			Policy:        defaultallowegress,
+			ResultIngress: false,
+			ResultEgress:  false,
+		},
+		testStruct{
+			Policy:        np3,
+			ResultIngress: false,
+			ResultEgress:  false,
+		},
+	}
+
+	for i, test := range tests {
+		t.Log("Testing DefaultDeny ", i)
+		if result := IsDefaultDenyIngress(&test.Policy); result != test.ResultIngress {
+			t.Errorf("Ingress DefaultDeny error. Test %d Got %t expected %t ", i, result, test.ResultIngress)
+		}
+		if result := IsDefaultDenyEgress(&test.Policy); result != test.ResultEgress {
+			t.Errorf("Egress DefaultDeny error. Test %d Got %t expected %t ", i, result, test.ResultEgress)
+		}
+	}
+}
+
+func TestHasDefaultDeny(t *testing.T) {
+	policies := buildNetworkPolicyList(defaultdenyingress, np1namespacex)
+
+	ingress, egress := HasDefaultDeny("", &policies)
+	if !ingress || egress {
+		t.Errorf("Got ingress %t egress %t expected ingress only", ingress, egress)
+	}
+
+	ingress, egress = HasDefaultDeny("x", &policies)
+	if ingress || egress {
+		t.Errorf("Got ingress %t egress %t for namespace x expected none", ingress, egress)
+	}
+}
+
+func TestNewDefaultDenyPolicy(t *testing.T) {
+	ingress := NewDefaultDenyPolicy("x", networking.PolicyTypeIngress)
+	if !IsDefaultDenyIngress(ingress) || IsDefaultDenyEgress(ingress) {
+		t.Errorf("Generated ingress policy is not a default deny ingress: %+v", ingress)
+	}
+
+	egress := NewDefaultDenyPolicy("x", networking.PolicyTypeEgress)
+	if IsDefaultDenyIngress(egress) || !IsDefaultDenyEgress(egress) {
+		t.Errorf("Generated egress policy is not a default deny egress: %+v", egress)
+	}
+
+	dns := NewAllowDNSPolicy("x", &metav1.LabelSelector{}, nil)
+	if IsPolicyApplicableToIngress(dns) || !IsPolicyApplicableToEgress(dns) || IsDefaultDenyEgress(dns) {
+		t.Errorf("Generated DNS policy is not an egress allow policy: %+v", dns)
+	}
+}
+
+func TestDNSNamespaceSelector(t *testing.T) {
+	dnsPod := func(namespace string) api.Pod {
+		return api.Pod{ObjectMeta: metav1.ObjectMeta{Name: "coredns", Namespace: namespace, Labels: map[string]string{"k8s-app": "kube-dns"}}}
+	}
+	namespace := func(name string, labels map[string]string) api.Namespace {
+		return api.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+	}
+
+	type testStruct struct {
+		Pods       []api.Pod
+		Namespaces []api.Namespace
+		Result     map[string]string
+		IsError    bool
+	}
+
+	tests := []testStruct{
+		// Kubernetes 1.21 and later.
+		testStruct{
+			Pods:       []api.Pod{dnsPod("kube-system")},
+			Namespaces: []api.Namespace{namespace("kube-system", map[string]string{NamespaceNameLabel: "kube-system"})},
+			Result:     map[string]string{NamespaceNameLabel: "kube-system"},
+		},
+		// Older clusters, with a label set by the administrator.
+		testStruct{
+			Pods: []api.Pod{dnsPod("kube-system")},
+			Namespaces: []api.Namespace{
+				namespace("default", map[string]string{"team": "platform"}),
+				namespace("kube-system", map[string]string{"name": "kube-system", "team": "platform"}),
+			},
+			Result: map[string]string{"name": "kube-system"},
+		},
+		// No label selects the namespace alone.
+		testStruct{
+			Pods: []api.Pod{dnsPod("kube-system")},
+			Namespaces: []api.Namespace{
+				namespace("default", map[string]string{"team": "platform"}),
+				namespace("kube-system", map[string]string{"team": "platform"}),
+			},
+			IsError: true,
+		},
+		// No DNS pod.
+		testStruct{
+			Namespaces: []api.Namespace{namespace("kube-system", map[string]string{NamespaceNameLabel: "kube-system"})},
+			IsError:    true,
+		},
+		// DNS pods in several namespaces.
+		testStruct{
+			Pods:       []api.Pod{dnsPod("kube-system"), dnsPod("dns")},
+			Namespaces: []api.Namespace{namespace("kube-system", nil), namespace("dns", nil)},
+			IsError:    true,
+		},
+	}
+
+	dnsPods := &metav1.LabelSelector{MatchLabels: map[string]string{"k8s-app": "kube-dns"}}
+	for i, test := range tests {
+		t.Log("Testing DNSNamespaceSelector ", i)
+		selector, err := DNSNamespaceSelector(dnsPods, &api.PodList{Items: test.Pods}, &api.NamespaceList{Items: test.Namespaces})
+		if (err != nil) != test.IsError {
+			t.Errorf("Test %d Got error %v expected error %t", i, err, test.IsError)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(selector.MatchLabels, test.Result) {
+			t.Errorf("Test %d Got selector %v expected %v", i, selector.MatchLabels, test.Result)
+		}
+	}
+}
@@ -0,0 +1,267 @@
+// Package diff compares the connectivity of two states of a cluster, typically before and after a change of policies.
+//
+// The flows are evaluated between every pair of pods existing in both states, each state evaluating its own
+// version of the pods, on the ports declared by the containers of the destination and the numeric ports of
+// the policies of both states. When there is no such port, the verdicts don't depend on the port and a pair
+// is evaluated once, reported with port 0 standing for any port. The flows from or to the pods added in the
+// after state are evaluated against the after state only, and reported as now-allowed when allowed.
+//
+// SimulateLabels compares a state to a copy of itself where the labels of pods or of a namespace changed,
+// restricted to the pods whose labels changed and the flows from or to them.
+package diff
+
+import (
+	"sort"
+
+	"github.com/aporeto-inc/kubepox"
+	"github.com/aporeto-inc/kubepox/cluster"
+
+	api "k8s.io/api/core/v1"
+	discovery "k8s.io/api/discovery/v1beta1"
+	networking "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+)
+
+// Kinds of PolicyChange.
+const (
+	Added   = "added"
+	Removed = "removed"
+	Changed = "changed"
+)
+
+// Kinds of FlowChange.
+const (
+	// NowAllowed is a flow denied before and allowed after.
+	NowAllowed = "now-allowed"
+	// NowDenied is a flow allowed before and denied after.
+	NowDenied = "now-denied"
+)
+
+// Report lists the differences between two states.
+type Report struct {
+	Policies []PolicyChange `json:"policies"`
+	Pods     []PodChange    `json:"pods"`
+	Flows    []FlowChange   `json:"flows"`
+	// Peers are only reported by SimulateLabels.
+	Peers []PeerChange `json:"peers,omitempty"`
+}
+
+// PolicyChange is a policy added, removed or whose spec changed.
+type PolicyChange struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+}
+
+// PodChange is a pod whose set of selecting policies changed.
+type PodChange struct {
+	Namespace string   `json:"namespace"`
+	Name      string   `json:"name"`
+	Before    []string `json:"before"`
+	After     []string `json:"after"`
+}
+
+// FlowChange is a flow between two pods whose verdict changed.
+type FlowChange struct {
+	Kind        string           `json:"kind"`
+	Source      string           `json:"src"`
+	Destination string           `json:"dst"`
+	Port        int32            `json:"port"`
+	Protocol    string           `json:"protocol"`
+	Verdict     *kubepox.Verdict `json:"verdict"`
+}
+
+// Empty returns true if the states have the same policies and connectivity.
+func (r *Report) Empty() bool {
+	return len(r.Policies) == 0 && len(r.Pods) == 0 && len(r.Flows) == 0 && len(r.Peers) == 0
+}
+
+// Compare reports the differences of policies, selected pods and connectivity from before to after.
+func Compare(before, after *cluster.State) (*Report, error) {
+	return compare(before, after, nil)
+}
+
+// podPair is a pod of the after state, with its version in the before state, nil if it was added.
+type podPair struct {
+	before, after *api.Pod
+}
+
+// key returns namespace/name.
+func (p podPair) key() string {
+	return p.after.Namespace + "/" + p.after.Name
+}
+
+// compare reports the differences from before to after, leaving them unchanged. When affected is not nil,
+// only the pods it holds, by namespace/name, and the flows from or to them are compared.
+func compare(before, after *cluster.State, affected map[string]bool) (*Report, error) {
+	before = copyState(before)
+	after = copyState(after)
+	before.Sort()
+	after.Sort()
+
+	report := &Report{
+		Policies: comparePolicies(before, after),
+		Pods:     []PodChange{},
+		Flows:    []FlowChange{},
+	}
+
+	// Pods of the after state, in its order. Terminated pods have no traffic.
+	pods := []podPair{}
+	for i := range after.Pods.Items {
+		pod := &after.Pods.Items[i]
+		if kubepox.ClassifyPod(pod) == kubepox.PodTerminated {
+			continue
+		}
+		old := before.Pod(pod.Namespace, pod.Name)
+		if old != nil && kubepox.ClassifyPod(old) == kubepox.PodTerminated {
+			old = nil
+		}
+		pods = append(pods, podPair{before: old, after: pod})
+	}
+	isAffected := func(pod podPair) bool {
+		return affected == nil || affected[pod.key()]
+	}
+
+	for _, pod := range pods {
+		if !isAffected(pod) || pod.before == nil {
+			continue
+		}
+		oldPolicies, err := policyNames(pod.before, &before.Policies)
+		if err != nil {
+			return nil, err
+		}
+		newPolicies, err := policyNames(pod.after, &after.Policies)
+		if err != nil {
+			return nil, err
+		}
+		if !equalStrings(oldPolicies, newPolicies) {
+			report.Pods = append(report.Pods, PodChange{
+				Namespace: pod.after.Namespace,
+				Name:      pod.after.Name,
+				Before:    oldPolicies,
+				After:     newPolicies,
+			})
+		}
+	}
+
+	policyPorts := kubepox.MergePorts(kubepox.PolicyPorts(&before.Policies), kubepox.PolicyPorts(&after.Policies))
+	for _, dst := range pods {
+		ports := kubepox.MergePorts(kubepox.ContainerPorts(dst.after), policyPorts)
+		if dst.before != nil {
+			ports = kubepox.MergePorts(kubepox.ContainerPorts(dst.before), ports)
+		}
+		if len(ports) == 0 {
+			ports = []kubepox.Port{{Protocol: api.ProtocolTCP}}
+		}
+		for _, src := range pods {
+			if src == dst || !isAffected(src) && !isAffected(dst) {
+				continue
+			}
+			for _, p := range ports {
+				// A flow from or to an added pod didn't exist, as if it was denied.
+				wasAllowed := false
+				if src.before != nil && dst.before != nil {
+					oldVerdict, err := kubepox.EvaluateTraffic(kubepox.PodEndpoint(src.before), kubepox.PodEndpoint(dst.before), p.Number, p.Protocol, &before.Namespaces, &before.Policies)
+					if err != nil {
+						return nil, err
+					}
+					wasAllowed = oldVerdict.Allowed
+				}
+				newVerdict, err := kubepox.EvaluateTraffic(kubepox.PodEndpoint(src.after), kubepox.PodEndpoint(dst.after), p.Number, p.Protocol, &after.Namespaces, &after.Policies)
+				if err != nil {
+					return nil, err
+				}
+				if wasAllowed == newVerdict.Allowed {
+					continue
+				}
+				kind := NowDenied
+				if newVerdict.Allowed {
+					kind = NowAllowed
+				}
+				report.Flows = append(report.Flows, FlowChange{
+					Kind:        kind,
+					Source:      kubepox.PodEndpoint(src.after).String(),
+					Destination: kubepox.PodEndpoint(dst.after).String(),
+					Port:        p.Number,
+					Protocol:    string(p.Protocol),
+					Verdict:     newVerdict,
+				})
+			}
+		}
+	}
+	sort.SliceStable(report.Flows, func(i, j int) bool {
+		a, b := report.Flows[i], report.Flows[j]
+		if a.Source != b.Source {
+			return a.Source < b.Source
+		}
+		return a.Destination < b.Destination
+	})
+
+	return report, nil
+}
+
+// copyState returns a copy of the state whose lists can be sorted, and whose namespaces and pods can be
+// changed, without altering the state.
+func copyState(state *cluster.State) *cluster.State {
+	c := *state
+	c.Namespaces = *state.Namespaces.DeepCopy()
+	c.Pods = *state.Pods.DeepCopy()
+	c.Policies.Items = append([]networking.NetworkPolicy{}, state.Policies.Items...)
+	c.Services.Items = append([]api.Service{}, state.Services.Items...)
+	c.EndpointSlices.Items = append([]discovery.EndpointSlice{}, state.EndpointSlices.Items...)
+	return &c
+}
+
+// comparePolicies reports the policies added, removed or whose spec changed.
+func comparePolicies(before, after *cluster.State) []PolicyChange {
+	changes := []PolicyChange{}
+	for i := range before.Policies.Items {
+		policy := &before.Policies.Items[i]
+		if after.Policy(policy.Namespace, policy.Name) == nil {
+			changes = append(changes, PolicyChange{Kind: Removed, Namespace: policy.Namespace, Name: policy.Name})
+		}
+	}
+	for i := range after.Policies.Items {
+		policy := &after.Policies.Items[i]
+		old := before.Policy(policy.Namespace, policy.Name)
+		switch {
+		case old == nil:
+			changes = append(changes, PolicyChange{Kind: Added, Namespace: policy.Namespace, Name: policy.Name})
+		case !equality.Semantic.DeepEqual(old.Spec, policy.Spec):
+			changes = append(changes, PolicyChange{Kind: Changed, Namespace: policy.Namespace, Name: policy.Name})
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		if changes[i].Namespace != changes[j].Namespace {
+			return changes[i].Namespace < changes[j].Namespace
+		}
+		return changes[i].Name < changes[j].Name
+	})
+	return changes
+}
+
+// policyNames returns the sorted names of the policies selecting the pod.
+func policyNames(pod *api.Pod, allPolicies *networking.NetworkPolicyList) ([]string, error) {
+	policies, err := kubepox.ListPoliciesPerPod(pod, allPolicies)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, policy := range policies.Items {
+		names = append(names, policy.Name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,130 @@
+package diff
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aporeto-inc/kubepox/cluster"
+)
+
+func TestCompare(t *testing.T) {
+	before, err := cluster.LoadPath("testdata/before")
+	if err != nil {
+		t.Fatalf("Error loading state: %s", err)
+	}
+	after, err := cluster.LoadPath("testdata/after")
+	if err != nil {
+		t.Fatalf("Error loading state: %s", err)
+	}
+
+	report, err := Compare(before, after)
+	if err != nil {
+		t.Fatalf("Error comparing states: %s", err)
+	}
+
+	policies := []PolicyChange{
+		PolicyChange{Kind: Changed, Namespace: "web", Name: "allow-db"},
+		PolicyChange{Kind: Added, Namespace: "web", Name: "allow-frontend"},
+		PolicyChange{Kind: Removed, Namespace: "web", Name: "legacy"},
+	}
+	if !reflect.DeepEqual(report.Policies, policies) {
+		t.Errorf("Got policy changes %+v expected %+v", report.Policies, policies)
+	}
+
+	pods := []PodChange{
+		PodChange{Namespace: "web", Name: "frontend", Before: []string{"default-deny"}, After: []string{"allow-frontend", "default-deny"}},
+	}
+	if !reflect.DeepEqual(report.Pods, pods) {
+		t.Errorf("Got pod changes %+v expected %+v", report.Pods, pods)
+	}
+
+	type testStruct struct {
+		kind        string
+		source      string
+		destination string
+		port        int32
+	}
+	tests := []testStruct{
+		testStruct{kind: NowAllowed, source: "web/db", destination: "web/frontend", port: 80},
+		testStruct{kind: NowDenied, source: "web/frontend", destination: "web/db", port: 5432},
+		testStruct{kind: NowAllowed, source: "web/frontend", destination: "web/db", port: 5433},
+	}
+	if len(report.Flows) != len(tests) {
+		t.Fatalf("Got flow changes %+v expected %d", report.Flows, len(tests))
+	}
+	for i, test := range tests {
+		t.Log("Testing flow ", i)
+		flow := report.Flows[i]
+		if flow.Kind != test.kind || flow.Source != test.source || flow.Destination != test.destination || flow.Port != test.port || flow.Protocol != "TCP" {
+			t.Errorf("Got flow change %+v expected %+v", flow, test)
+		}
+	}
+
+	report, err = Compare(after, after)
+	if err != nil {
+		t.Fatalf("Error comparing states: %s", err)
+	}
+	if !report.Empty() {
+		t.Errorf("Got changes %+v comparing a state to itself", report)
+	}
+}
+
+func TestCompareAddedPod(t *testing.T) {
+	before, err := cluster.LoadPath("testdata/before")
+	if err != nil {
+		t.Fatalf("Error loading state: %s", err)
+	}
+	after, err := cluster.LoadPath("testdata/after")
+	if err != nil {
+		t.Fatalf("Error loading state: %s", err)
+	}
+	added := *after.Pod("web", "frontend").DeepCopy()
+	added.Name = "frontend-2"
+	after.Pods.Items = append(after.Pods.Items, added)
+	order := []string{}
+	for _, pod := range after.Pods.Items {
+		order = append(order, pod.Name)
+	}
+
+	report, err := Compare(before, after)
+	if err != nil {
+		t.Fatalf("Error comparing states: %s", err)
+	}
+
+	type testStruct struct {
+		kind        string
+		source      string
+		destination string
+		port        int32
+	}
+	tests := []testStruct{
+		testStruct{kind: NowAllowed, source: "web/db", destination: "web/frontend", port: 80},
+		testStruct{kind: NowAllowed, source: "web/db", destination: "web/frontend-2", port: 80},
+		testStruct{kind: NowDenied, source: "web/frontend", destination: "web/db", port: 5432},
+		testStruct{kind: NowAllowed, source: "web/frontend", destination: "web/db", port: 5433},
+		testStruct{kind: NowAllowed, source: "web/frontend", destination: "web/frontend-2", port: 80},
+		testStruct{kind: NowAllowed, source: "web/frontend-2", destination: "web/db", port: 5433},
+		testStruct{kind: NowAllowed, source: "web/frontend-2", destination: "web/frontend", port: 80},
+	}
+	if len(report.Flows) != len(tests) {
+		t.Fatalf("Got flow changes %+v expected %d", report.Flows, len(tests))
+	}
+	for i, test := range tests {
+		t.Log("Testing flow ", i)
+		flow := report.Flows[i]
+		if flow.Kind != test.kind || flow.Source != test.source || flow.Destination != test.destination || flow.Port != test.port {
+			t.Errorf("Test %d Got flow change %+v expected %+v", i, flow, test)
+		}
+	}
+
+	if len(report.Pods) != 1 || report.Pods[0].Name != "frontend" {
+		t.Errorf("Got pod changes %+v expected frontend only", report.Pods)
+	}
+
+	// The states of the caller are left unsorted.
+	for i, pod := range after.Pods.Items {
+		if pod.Name != order[i] {
+			t.Errorf("Got pod %s at %d expected %s: the after state was sorted", pod.Name, i, order[i])
+		}
+	}
+}
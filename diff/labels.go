@@ -0,0 +1,209 @@
+package diff
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aporeto-inc/kubepox"
+	"github.com/aporeto-inc/kubepox/cluster"
+
+	api "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// Kinds of PeerChange.
+const (
+	// NowIncluded is a rule whose peers include a pod after the change only.
+	NowIncluded = "now-included"
+	// NoLongerIncluded is a rule whose peers include a pod before the change only.
+	NoLongerIncluded = "no-longer-included"
+)
+
+// Directions of the rules of a PeerChange.
+const (
+	Ingress = "ingress"
+	Egress  = "egress"
+)
+
+// LabelChange is a change of labels: the labels of Set are set, then the labels of Remove are removed.
+type LabelChange struct {
+	Set    map[string]string `json:"set,omitempty"`
+	Remove []string          `json:"remove,omitempty"`
+}
+
+// ParseLabelChange parses labels to set, as key=value, and keys of labels to remove.
+func ParseLabelChange(set, remove []string) (*LabelChange, error) {
+	change := &LabelChange{
+		Set: map[string]string{},
+	}
+	for _, label := range set {
+		i := strings.Index(label, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid label %q: expected key=value", label)
+		}
+		key, value := label[:i], label[i+1:]
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid label key %q: %s", key, strings.Join(errs, ", "))
+		}
+		if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid label value %q: %s", value, strings.Join(errs, ", "))
+		}
+		change.Set[key] = value
+	}
+	for _, key := range remove {
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid label key %q: %s", key, strings.Join(errs, ", "))
+		}
+		change.Remove = append(change.Remove, key)
+	}
+	return change, nil
+}
+
+// Apply returns a copy of the labels with the change applied.
+func (c *LabelChange) Apply(labels map[string]string) map[string]string {
+	changed := map[string]string{}
+	for k, v := range labels {
+		changed[k] = v
+	}
+	for k, v := range c.Set {
+		changed[k] = v
+	}
+	for _, k := range c.Remove {
+		delete(changed, k)
+	}
+	return changed
+}
+
+// LabelTarget is the object whose labels change: pods of a namespace, or the namespace itself.
+type LabelTarget struct {
+	Namespace string
+	// Pods are the names of the pods whose labels change. The labels of the namespace change when it is empty.
+	Pods []string
+}
+
+// PeerChange is a rule of a policy whose peers include a pod before or after a change only.
+type PeerChange struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Direction string `json:"direction"`
+	// Rule is the index of the rule in the ingress or egress rules of the policy.
+	Rule int    `json:"rule"`
+	Pod  string `json:"pod"`
+}
+
+// SimulateLabels reports how a change of the labels of the target would alter the policies selecting its pods,
+// the rules of policies whose peers include them, and the flows from or to them.
+// The state is left unchanged, the report comparing it to a copy with the change applied.
+func SimulateLabels(state *cluster.State, target LabelTarget, change *LabelChange) (*Report, error) {
+	before := state
+	after := copyState(state)
+
+	affected := map[string]bool{}
+	if len(target.Pods) == 0 {
+		namespace := after.Namespace(target.Namespace)
+		if namespace == nil {
+			after.Namespaces.Items = append(after.Namespaces.Items, api.Namespace{})
+			namespace = &after.Namespaces.Items[len(after.Namespaces.Items)-1]
+			namespace.Name = target.Namespace
+		}
+		namespace.Labels = change.Apply(namespace.Labels)
+		for _, pod := range after.PodsInNamespace(target.Namespace).Items {
+			affected[pod.Namespace+"/"+pod.Name] = true
+		}
+	}
+	for _, name := range target.Pods {
+		pod := after.Pod(target.Namespace, name)
+		if pod == nil {
+			return nil, fmt.Errorf("pod %s/%s not found", target.Namespace, name)
+		}
+		pod.Labels = change.Apply(pod.Labels)
+		affected[pod.Namespace+"/"+pod.Name] = true
+	}
+
+	report, err := compare(before, after, affected)
+	if err != nil {
+		return nil, err
+	}
+	report.Peers, err = comparePeers(before, after, affected)
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// comparePeers reports the rules of the policies whose peers include an affected pod before or after only.
+func comparePeers(before, after *cluster.State, affected map[string]bool) ([]PeerChange, error) {
+	changes := []PeerChange{}
+	for i := range after.Pods.Items {
+		pod := &after.Pods.Items[i]
+		key := pod.Namespace + "/" + pod.Name
+		old := before.Pod(pod.Namespace, pod.Name)
+		if !affected[key] || old == nil || kubepox.ClassifyPod(pod) == kubepox.PodTerminated {
+			continue
+		}
+		oldEndpoint, newEndpoint := kubepox.PodEndpoint(old), kubepox.PodEndpoint(pod)
+
+		for j := range after.Policies.Items {
+			policy := &after.Policies.Items[j]
+			rules := map[string][][]networking.NetworkPolicyPeer{}
+			for _, rule := range policy.Spec.Ingress {
+				rules[Ingress] = append(rules[Ingress], rule.From)
+			}
+			for _, rule := range policy.Spec.Egress {
+				rules[Egress] = append(rules[Egress], rule.To)
+			}
+			for _, direction := range []string{Ingress, Egress} {
+				for k, peers := range rules[direction] {
+					wasIncluded, err := includes(peers, policy.Namespace, oldEndpoint, &before.Namespaces)
+					if err != nil {
+						return nil, err
+					}
+					isIncluded, err := includes(peers, policy.Namespace, newEndpoint, &after.Namespaces)
+					if err != nil {
+						return nil, err
+					}
+					if wasIncluded == isIncluded {
+						continue
+					}
+					kind := NoLongerIncluded
+					if isIncluded {
+						kind = NowIncluded
+					}
+					changes = append(changes, PeerChange{
+						Kind:      kind,
+						Namespace: policy.Namespace,
+						Name:      policy.Name,
+						Direction: direction,
+						Rule:      k,
+						Pod:       key,
+					})
+				}
+			}
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		if changes[i].Namespace != changes[j].Namespace {
+			return changes[i].Namespace < changes[j].Namespace
+		}
+		return changes[i].Name < changes[j].Name
+	})
+	return changes, nil
+}
+
+// includes returns true if one of the peers matches the endpoint. Unlike for traffic, an empty list of peers
+// includes no pod in particular, and is never reported.
+func includes(peers []networking.NetworkPolicyPeer, policyNamespace string, endpoint *kubepox.Endpoint, namespaces *api.NamespaceList) (bool, error) {
+	for i := range peers {
+		match, err := kubepox.PeerMatches(&peers[i], policyNamespace, endpoint, namespaces)
+		if err != nil {
+			return false, err
+		}
+		if match {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,136 @@
+package diff
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aporeto-inc/kubepox/cluster"
+)
+
+func TestParseLabelChange(t *testing.T) {
+	type testStruct struct {
+		Set     []string
+		Remove  []string
+		Labels  map[string]string
+		Result  map[string]string
+		IsError bool
+	}
+
+	tests := []testStruct{
+		testStruct{
+			Set:    []string{"role=db", "tier="},
+			Remove: []string{"app"},
+			Labels: map[string]string{"app": "web", "role": "frontend"},
+			Result: map[string]string{"role": "db", "tier": ""},
+		},
+		testStruct{
+			Remove: []string{"missing"},
+			Labels: nil,
+			Result: map[string]string{},
+		},
+		testStruct{
+			Set:     []string{"role"},
+			IsError: true,
+		},
+		testStruct{
+			Set:     []string{"role=not a value"},
+			IsError: true,
+		},
+		testStruct{
+			Remove:  []string{"-invalid"},
+			IsError: true,
+		},
+	}
+
+	for i, test := range tests {
+		t.Log("Testing ParseLabelChange ", i)
+		change, err := ParseLabelChange(test.Set, test.Remove)
+		if (err != nil) != test.IsError {
+			t.Errorf("Got error %v expected error %t", err, test.IsError)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if result := change.Apply(test.Labels); !reflect.DeepEqual(result, test.Result) {
+			t.Errorf("Got labels %v expected %v", result, test.Result)
+		}
+	}
+}
+
+func TestSimulateLabels(t *testing.T) {
+	state, err := cluster.LoadPath("testdata/before")
+	if err != nil {
+		t.Fatalf("Error loading state: %s", err)
+	}
+
+	change, _ := ParseLabelChange([]string{"role=legacy"}, nil)
+	report, err := SimulateLabels(state, LabelTarget{Namespace: "web", Pods: []string{"frontend"}}, change)
+	if err != nil {
+		t.Fatalf("Error simulating labels: %s", err)
+	}
+	if state.Pod("web", "frontend").Labels["role"] != "frontend" {
+		t.Errorf("Simulating labels changed the labels of the state")
+	}
+
+	pods := []PodChange{
+		PodChange{Namespace: "web", Name: "frontend", Before: []string{"default-deny"}, After: []string{"default-deny", "legacy"}},
+	}
+	if !reflect.DeepEqual(report.Pods, pods) {
+		t.Errorf("Got pod changes %+v expected %+v", report.Pods, pods)
+	}
+	peers := []PeerChange{
+		PeerChange{Kind: NoLongerIncluded, Namespace: "web", Name: "allow-db", Direction: Ingress, Rule: 0, Pod: "web/frontend"},
+	}
+	if !reflect.DeepEqual(report.Peers, peers) {
+		t.Errorf("Got peer changes %+v expected %+v", report.Peers, peers)
+	}
+	if len(report.Flows) != 1 || report.Flows[0].Kind != NowDenied || report.Flows[0].Destination != "web/db" || report.Flows[0].Port != 5432 {
+		t.Errorf("Got flow changes %+v expected web/frontend now denied to web/db on port 5432", report.Flows)
+	}
+
+	change, _ = ParseLabelChange([]string{"team=web"}, nil)
+	report, err = SimulateLabels(state, LabelTarget{Namespace: "web"}, change)
+	if err != nil {
+		t.Fatalf("Error simulating labels: %s", err)
+	}
+	if !report.Empty() {
+		t.Errorf("Got changes %+v for a namespace label no policy selects", report)
+	}
+
+	if _, err := SimulateLabels(state, LabelTarget{Namespace: "web", Pods: []string{"unknown"}}, change); err == nil {
+		t.Errorf("Simulated the labels of a pod that doesn't exist")
+	}
+}
+
+func TestSimulateNamespaceLabels(t *testing.T) {
+	state, err := cluster.LoadPath("testdata/namespace")
+	if err != nil {
+		t.Fatalf("Error loading state: %s", err)
+	}
+	// Out of order, to check that the lists of the state are not sorted.
+	state.Pods.Items[0], state.Pods.Items[1] = state.Pods.Items[1], state.Pods.Items[0]
+	first := state.Pods.Items[0].Name
+
+	change, _ := ParseLabelChange([]string{"team=monitoring"}, nil)
+	report, err := SimulateLabels(state, LabelTarget{Namespace: "tools"}, change)
+	if err != nil {
+		t.Fatalf("Error simulating labels: %s", err)
+	}
+	if state.Namespace("tools").Labels["team"] != "" || state.Pods.Items[0].Name != first {
+		t.Errorf("Simulating labels changed the state")
+	}
+
+	peers := []PeerChange{
+		PeerChange{Kind: NowIncluded, Namespace: "web", Name: "allow-monitoring", Direction: Ingress, Rule: 0, Pod: "tools/debug"},
+	}
+	if !reflect.DeepEqual(report.Peers, peers) {
+		t.Errorf("Got peer changes %+v expected %+v", report.Peers, peers)
+	}
+	if len(report.Flows) != 1 || report.Flows[0].Kind != NowAllowed || report.Flows[0].Source != "tools/debug" || report.Flows[0].Destination != "web/api" || report.Flows[0].Port != 8080 {
+		t.Errorf("Got flow changes %+v expected tools/debug now allowed to web/api on port 8080", report.Flows)
+	}
+	if len(report.Pods) != 0 {
+		t.Errorf("Got pod changes %+v expected none", report.Pods)
+	}
+}
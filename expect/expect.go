@@ -0,0 +1,302 @@
+// Package expect verifies declarative connectivity expectations against the state of a cluster, so that teams
+// can pin their intended connectivity as tests run in CI.
+//
+// An expectations file lists connections and their expected verdict:
+//
+//	namespace: web
+//	expectations:
+//	- name: the frontend reaches the api
+//	  from: deploy/frontend
+//	  to: deploy/api
+//	  port: 8080
+//	  expect: allow
+//	- from: {selector: role=frontend}
+//	  to: {namespace: data, selector: tier=db}
+//	  port: 5432
+//	  expect: deny
+//	- from: web/frontend
+//	  to: 203.0.113.10
+//	  port: 443
+//	  expect: allow
+//
+// An end of a connection is written as a reference: a pod or a workload, such as deploy/api, optionally
+// prefixed by its namespace, or an address outside of the cluster. It can also be written as an object
+// selecting pods by label selector in a namespace. The namespace of the file, "default" if not set, applies to
+// the ends without namespace. A workload without any pod is evaluated with a pod synthesized from its pod
+// template.
+//
+// When an end stands for several pods, the expectation holds for every pair of pods: allow requires every
+// connection to be allowed, and deny every connection to be denied.
+// As in any YAML 1.1 file, names such as y or n must be quoted, or they are read as booleans.
+package expect
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+
+	"github.com/aporeto-inc/kubepox"
+	"github.com/aporeto-inc/kubepox/cluster"
+
+	api "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/yaml"
+)
+
+// Expected verdicts of an Expectation.
+const (
+	Allow = "allow"
+	Deny  = "deny"
+)
+
+// File is a list of expectations.
+type File struct {
+	// Namespace is the namespace of the ends without namespace.
+	Namespace    string        `json:"namespace,omitempty"`
+	Expectations []Expectation `json:"expectations"`
+}
+
+// Expectation is a connection and its expected verdict.
+type Expectation struct {
+	Name     string       `json:"name,omitempty"`
+	From     End          `json:"from"`
+	To       End          `json:"to"`
+	Port     int32        `json:"port"`
+	Protocol api.Protocol `json:"protocol,omitempty"`
+	Expect   string       `json:"expect"`
+}
+
+// String returns the name of the expectation, or a description of its connection if it has none.
+func (e *Expectation) String() string {
+	if e.Name != "" {
+		return e.Name
+	}
+	return fmt.Sprintf("%s -> %s %s/%d %s", &e.From, &e.To, e.Protocol, e.Port, e.Expect)
+}
+
+// End is one end of the connection of an Expectation. Exactly one of Ref, Selector and IP is set.
+type End struct {
+	Namespace string `json:"namespace,omitempty"`
+	// Ref is a pod or a workload, [namespace/]name or [namespace/]kind/name.
+	Ref string `json:"ref,omitempty"`
+	// Selector is a label selector of pods of the namespace.
+	Selector string `json:"selector,omitempty"`
+	// IP is an address outside of the cluster.
+	IP string `json:"ip,omitempty"`
+}
+
+// UnmarshalJSON reads an End from an object or from a string, which is an IP if it parses as one and a Ref otherwise.
+func (e *End) UnmarshalJSON(data []byte) error {
+	var ref string
+	if err := json.Unmarshal(data, &ref); err == nil {
+		if net.ParseIP(ref) != nil {
+			*e = End{IP: ref}
+		} else {
+			*e = End{Ref: ref}
+		}
+		return nil
+	}
+	type end End
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode((*end)(e))
+}
+
+// String describes the end.
+func (e *End) String() string {
+	switch {
+	case e.IP != "":
+		return e.IP
+	case e.Selector != "":
+		return e.Namespace + "/{" + e.Selector + "}"
+	}
+	workload, err := cluster.ParseQualifiedWorkload(e.Ref, e.Namespace)
+	if err != nil {
+		return e.Ref
+	}
+	if workload.Kind == cluster.KindPod {
+		return workload.Namespace + "/" + workload.Name
+	}
+	return workload.Namespace + "/" + workload.String()
+}
+
+// Load loads and validates an expectations file. Every expectation needs a port, and a protocol among TCP, UDP
+// and SCTP, TCP if not set.
+func Load(file string) (*File, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	f := &File{}
+	if err := yaml.UnmarshalStrict(data, f); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	if f.Namespace == "" {
+		f.Namespace = metav1.NamespaceDefault
+	}
+
+	for i := range f.Expectations {
+		e := &f.Expectations[i]
+		if e.Port < 1 || e.Port > 65535 {
+			return nil, fmt.Errorf("%s: expectation %d: invalid port %d, expected 1 to 65535", file, i+1, e.Port)
+		}
+		e.Protocol = api.Protocol(strings.ToUpper(string(e.Protocol)))
+		switch e.Protocol {
+		case "":
+			e.Protocol = api.ProtocolTCP
+		case api.ProtocolTCP, api.ProtocolUDP, api.ProtocolSCTP:
+		default:
+			return nil, fmt.Errorf("%s: expectation %d: invalid protocol %q, expected TCP, UDP or SCTP", file, i+1, e.Protocol)
+		}
+		for _, end := range []*End{&e.From, &e.To} {
+			set := 0
+			for _, field := range []string{end.Ref, end.Selector, end.IP} {
+				if field != "" {
+					set++
+				}
+			}
+			if set != 1 {
+				return nil, fmt.Errorf("%s: expectation %d: an end needs exactly one of ref, selector and ip", file, i+1)
+			}
+			if end.Selector != "" {
+				if _, err := labels.Parse(end.Selector); err != nil {
+					return nil, fmt.Errorf("%s: expectation %d: invalid selector %q: %v", file, i+1, end.Selector, err)
+				}
+			}
+			if end.Namespace == "" && end.IP == "" {
+				end.Namespace = f.Namespace
+			}
+		}
+		if e.Expect != Allow && e.Expect != Deny {
+			return nil, fmt.Errorf("%s: expectation %s: invalid expected verdict %q", file, e, e.Expect)
+		}
+	}
+	return f, nil
+}
+
+// Mismatch is a connection of an expectation whose verdict is not the expected one.
+type Mismatch struct {
+	From    string           `json:"from"`
+	To      string           `json:"to"`
+	Got     string           `json:"got"`
+	Verdict *kubepox.Verdict `json:"verdict"`
+}
+
+// Result is the outcome of an Expectation.
+type Result struct {
+	Expectation Expectation `json:"expectation"`
+	// Connections is the number of connections evaluated.
+	Connections int `json:"connections"`
+	// Mismatches are the connections whose verdict is not the expected one.
+	Mismatches []Mismatch `json:"mismatches"`
+	// Error is set when the expectation couldn't be evaluated, such as when an end matches no pod.
+	Error string `json:"error,omitempty"`
+}
+
+// Passed returns true if the expectation was evaluated and every connection got the expected verdict.
+func (r *Result) Passed() bool {
+	return r.Error == "" && len(r.Mismatches) == 0
+}
+
+// Verify evaluates every expectation of the file against the State.
+func (f *File) Verify(state *cluster.State) []Result {
+	results := []Result{}
+	for _, e := range f.Expectations {
+		result := Result{
+			Expectation: e,
+			Mismatches:  []Mismatch{},
+		}
+		if err := result.evaluate(state); err != nil {
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+func (r *Result) evaluate(state *cluster.State) error {
+	e := &r.Expectation
+	sources, err := endpoints(state, &e.From)
+	if err != nil {
+		return err
+	}
+	destinations, err := endpoints(state, &e.To)
+	if err != nil {
+		return err
+	}
+
+	for _, src := range sources {
+		for _, dst := range destinations {
+			if src.Pod != nil && dst.Pod != nil && src.String() == dst.String() {
+				continue
+			}
+			verdict, err := kubepox.EvaluateTraffic(src, dst, e.Port, e.Protocol, &state.Namespaces, &state.Policies)
+			if err != nil {
+				return err
+			}
+			r.Connections++
+			got := Deny
+			if verdict.Allowed {
+				got = Allow
+			}
+			if got != e.Expect {
+				r.Mismatches = append(r.Mismatches, Mismatch{From: src.String(), To: dst.String(), Got: got, Verdict: verdict})
+			}
+		}
+	}
+	if r.Connections == 0 {
+		return fmt.Errorf("no connection to evaluate between %s and %s", &e.From, &e.To)
+	}
+	return nil
+}
+
+// endpoints resolves an end to the endpoints it stands for.
+func endpoints(state *cluster.State, end *End) ([]*kubepox.Endpoint, error) {
+	if end.IP != "" {
+		ip := net.ParseIP(end.IP)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid address %q", end.IP)
+		}
+		return []*kubepox.Endpoint{kubepox.IPEndpoint(ip)}, nil
+	}
+
+	pods := &api.PodList{}
+	if end.Selector != "" {
+		selector, err := labels.Parse(end.Selector)
+		if err != nil {
+			return nil, err
+		}
+		for _, pod := range state.PodsInNamespace(end.Namespace).Items {
+			if selector.Matches(labels.Set(pod.Labels)) {
+				pods.Items = append(pods.Items, pod)
+			}
+		}
+		for _, pod := range state.PendingPods().Items {
+			if pod.Namespace == end.Namespace && selector.Matches(labels.Set(pod.Labels)) {
+				pods.Items = append(pods.Items, pod)
+			}
+		}
+	} else {
+		workload, err := cluster.ParseQualifiedWorkload(end.Ref, end.Namespace)
+		if err != nil {
+			return nil, err
+		}
+		pods = state.ResolveWorkload(workload)
+	}
+
+	endpoints := []*kubepox.Endpoint{}
+	for i := range pods.Items {
+		if kubepox.UnenforceablePods.Excludes(&pods.Items[i]) {
+			continue
+		}
+		endpoints = append(endpoints, kubepox.PodEndpoint(&pods.Items[i]))
+	}
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("%s matches no pod", end)
+	}
+	return endpoints, nil
+}
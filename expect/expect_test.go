@@ -0,0 +1,128 @@
+package expect
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aporeto-inc/kubepox/cluster"
+)
+
+func TestVerify(t *testing.T) {
+	state, err := cluster.LoadPath("testdata/state")
+	if err != nil {
+		t.Fatalf("Error loading state: %s", err)
+	}
+	file, err := Load("testdata/expectations.yaml")
+	if err != nil {
+		t.Fatalf("Error loading expectations: %s", err)
+	}
+
+	type testStruct struct {
+		Passed      bool
+		Connections int
+		Mismatches  int
+		IsError     bool
+	}
+
+	tests := []testStruct{
+		testStruct{Passed: true, Connections: 1},
+		// Only the api is allowed to connect to the db.
+		testStruct{Passed: false, Connections: 2, Mismatches: 1},
+		// The worker is evaluated with the pod of its template.
+		testStruct{Passed: true, Connections: 1},
+		testStruct{Passed: true, Connections: 1},
+		testStruct{Passed: false, IsError: true},
+	}
+
+	results := file.Verify(state)
+	if len(results) != len(tests) {
+		t.Fatalf("Got %d results expected %d", len(results), len(tests))
+	}
+	for i, test := range tests {
+		t.Log("Testing expectation ", i)
+		result := results[i]
+		if result.Passed() != test.Passed || result.Connections != test.Connections || len(result.Mismatches) != test.Mismatches || (result.Error != "") != test.IsError {
+			t.Errorf("Got result %+v expected %+v", result, test)
+		}
+	}
+	if mismatch := results[1].Mismatches[0]; mismatch.From != "web/frontend" || mismatch.To != "web/db" || mismatch.Got != Deny {
+		t.Errorf("Got mismatch %+v expected web/frontend denied to web/db", mismatch)
+	}
+
+	tap := &bytes.Buffer{}
+	if err := WriteTAP(tap, results); err != nil {
+		t.Fatalf("Error writing TAP: %s", err)
+	}
+	for _, line := range []string{"1..5", "ok 1 - the frontend reaches the api", "not ok 2 - web/{role in (frontend,api)} -> web/{tier=data} TCP/5432 allow", "ok 3 - web/deployment/worker -> web/db TCP/5432 deny"} {
+		if !strings.Contains(tap.String(), line+"\n") {
+			t.Errorf("Couldn't find %q in TAP output:\n%s", line, tap)
+		}
+	}
+
+	junit := &bytes.Buffer{}
+	if err := WriteJUnit(junit, "expectations.yaml", results); err != nil {
+		t.Fatalf("Error writing JUnit: %s", err)
+	}
+	if !strings.Contains(junit.String(), `<testsuite name="expectations.yaml" tests="5" failures="1" errors="1">`) {
+		t.Errorf("Got JUnit output without the expected suite:\n%s", junit)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	if _, err := Load("testdata/missing.yaml"); err == nil {
+		t.Errorf("Loaded a missing file")
+	}
+	if _, err := Load("testdata/state/state.yaml"); err == nil {
+		t.Errorf("Loaded a manifest as expectations")
+	}
+
+	dir, err := ioutil.TempDir("", "expect")
+	if err != nil {
+		t.Fatalf("Error creating directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	type testStruct struct {
+		Expectation string
+		IsError     bool
+	}
+
+	tests := []testStruct{
+		testStruct{Expectation: "{from: frontend, to: api, expect: deny}", IsError: true},
+		testStruct{Expectation: "{from: frontend, to: api, port: 0, expect: deny}", IsError: true},
+		testStruct{Expectation: "{from: frontend, to: api, port: 70000, expect: deny}", IsError: true},
+		testStruct{Expectation: "{from: frontend, to: api, port: 8080, protocol: ICMP, expect: deny}", IsError: true},
+		testStruct{Expectation: "{from: frontend, to: api, port: 8080, protocol: tcp, expect: deny}", IsError: false},
+		testStruct{Expectation: "{from: frontend, to: api, port: 8080, expect: maybe}", IsError: true},
+	}
+
+	for i, test := range tests {
+		t.Log("Testing Load ", i)
+		file := filepath.Join(dir, fmt.Sprintf("%d.yaml", i))
+		if err := ioutil.WriteFile(file, []byte("namespace: web\nexpectations:\n- "+test.Expectation+"\n"), 0644); err != nil {
+			t.Fatalf("Error writing expectations: %s", err)
+		}
+		_, err := Load(file)
+		if (err != nil) != test.IsError {
+			t.Errorf("Test %d Got error %v expected error %t", i, err, test.IsError)
+		}
+	}
+
+	// The protocol is case insensitive: the allowed connection doesn't pass as denied.
+	f, err := Load(filepath.Join(dir, "4.yaml"))
+	if err != nil {
+		t.Fatalf("Error loading expectations: %s", err)
+	}
+	state, err := cluster.LoadPath("testdata/state")
+	if err != nil {
+		t.Fatalf("Error loading state: %s", err)
+	}
+	if results := f.Verify(state); results[0].Passed() || f.Expectations[0].Protocol != "TCP" {
+		t.Errorf("Got result %+v expected frontend allowed to api on TCP/8080", results[0])
+	}
+}
@@ -0,0 +1,125 @@
+package expect
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// failureMessage describes why the expectation failed, empty if it passed.
+func (r *Result) failureMessage() string {
+	switch {
+	case r.Error != "":
+		return r.Error
+	case len(r.Mismatches) > 0:
+		return fmt.Sprintf("%d of %d connections are not %s", len(r.Mismatches), r.Connections, expectedVerdict(r.Expectation.Expect))
+	default:
+		return ""
+	}
+}
+
+// details lists the mismatched connections, one per line.
+func (r *Result) details() []string {
+	lines := []string{}
+	for _, m := range r.Mismatches {
+		lines = append(lines, fmt.Sprintf("%s -> %s: %s", m.From, m.To, m.Got))
+	}
+	return lines
+}
+
+func expectedVerdict(expect string) string {
+	if expect == Allow {
+		return "allowed"
+	}
+	return "denied"
+}
+
+type junitSuites struct {
+	XMLName xml.Name     `xml:"testsuites"`
+	Suites  []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Errors   int         `xml:"errors,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitProblem `xml:"failure,omitempty"`
+	Error     *junitProblem `xml:"error,omitempty"`
+}
+
+type junitProblem struct {
+	Message string `xml:"message,attr"`
+	Details string `xml:",chardata"`
+}
+
+// WriteJUnit writes the results as a JUnit XML test suite of the given name, typically the expectations file.
+// Mismatches are failures, and expectations that couldn't be evaluated are errors.
+func WriteJUnit(w io.Writer, name string, results []Result) error {
+	suite := junitSuite{
+		Name:  name,
+		Tests: len(results),
+		Cases: []junitCase{},
+	}
+	for i := range results {
+		r := &results[i]
+		c := junitCase{
+			Name:      r.Expectation.String(),
+			ClassName: name,
+		}
+		switch {
+		case r.Error != "":
+			suite.Errors++
+			c.Error = &junitProblem{Message: r.failureMessage()}
+		case !r.Passed():
+			suite.Failures++
+			c.Failure = &junitProblem{Message: r.failureMessage(), Details: strings.Join(r.details(), "\n")}
+		}
+		suite.Cases = append(suite.Cases, c)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(junitSuites{Suites: []junitSuite{suite}}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// WriteTAP writes the results in the Test Anything Protocol, version 13, the reason of every failure
+// in a YAML block.
+func WriteTAP(w io.Writer, results []Result) error {
+	lines := []string{"TAP version 13", fmt.Sprintf("1..%d", len(results))}
+	for i := range results {
+		r := &results[i]
+		if r.Passed() {
+			lines = append(lines, fmt.Sprintf("ok %d - %s", i+1, r.Expectation.String()))
+			continue
+		}
+		lines = append(lines,
+			fmt.Sprintf("not ok %d - %s", i+1, r.Expectation.String()),
+			"  ---",
+			fmt.Sprintf("  message: %q", r.failureMessage()),
+		)
+		if details := r.details(); len(details) > 0 {
+			lines = append(lines, "  mismatches:")
+			for _, detail := range details {
+				lines = append(lines, fmt.Sprintf("  - %q", detail))
+			}
+		}
+		lines = append(lines, "  ...")
+	}
+	_, err := io.WriteString(w, strings.Join(lines, "\n")+"\n")
+	return err
+}
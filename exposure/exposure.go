@@ -0,0 +1,188 @@
+// Package exposure reports the pods exposed to the internet: the pods accepting connections from the internet
+// and the pods allowed to connect to the internet.
+//
+// A pod is exposed in a direction when it is not isolated in that direction, when a rule of a policy selecting
+// it has no peer, allowing every address, or when a rule has an ipBlock covering public addresses once its
+// except ranges and the private ranges are left out. Pod and namespace selectors only select pods of the
+// cluster and never expose a pod. Pods on the host network and terminated pods, which policies don't govern,
+// are left out. Workloads without any pod are evaluated with a pod synthesized from their pod template.
+package exposure
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/aporeto-inc/kubepox"
+	"github.com/aporeto-inc/kubepox/cluster"
+
+	api "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+)
+
+// Directions of a Finding.
+const (
+	Ingress = "ingress"
+	Egress  = "egress"
+)
+
+// Reasons of a Finding.
+const (
+	// NotIsolated is a pod selected by no policy applicable to the direction.
+	NotIsolated = "not-isolated"
+	// AnyPeer is a rule without any peer, allowing every address.
+	AnyPeer = "any-peer"
+	// PublicIPBlock is a rule with an ipBlock covering public addresses.
+	PublicIPBlock = "public-ip-block"
+)
+
+// Options configures the analysis.
+type Options struct {
+	// PrivateRanges are the ranges that are not part of the internet. DefaultPrivateRanges are used when it is nil.
+	PrivateRanges []*net.IPNet
+}
+
+// Finding is a reason for a pod to be exposed to the internet in a direction.
+type Finding struct {
+	Pod       string `json:"pod"`
+	Direction string `json:"direction"`
+	Reason    string `json:"reason"`
+	// Policy and Rule identify the rule exposing the pod, as namespace/name and index in the rules
+	// of the direction. They are empty for NotIsolated.
+	Policy string `json:"policy,omitempty"`
+	Rule   int    `json:"rule"`
+	// CIDR is the ipBlock of a PublicIPBlock, and Public the ranges of it that are public.
+	CIDR   string   `json:"cidr,omitempty"`
+	Public []string `json:"public,omitempty"`
+	// Ports are the ports of the rule, empty for all the ports.
+	Ports []string `json:"ports"`
+}
+
+// Report lists the findings of the exposed pods, in the order of the pods.
+type Report struct {
+	Ingress []Finding `json:"ingress"`
+	Egress  []Finding `json:"egress"`
+}
+
+// Analyze reports the pods of the State exposed to the internet.
+func Analyze(state *cluster.State, options Options) (*Report, error) {
+	private := options.PrivateRanges
+	if private == nil {
+		var err error
+		if private, err = ParseRanges(DefaultPrivateRanges); err != nil {
+			return nil, err
+		}
+	}
+
+	state.Sort()
+	report := &Report{
+		Ingress: []Finding{},
+		Egress:  []Finding{},
+	}
+	pods := append(append([]api.Pod{}, state.Pods.Items...), state.PendingPods().Items...)
+	for i := range pods {
+		pod := &pods[i]
+		if kubepox.UnenforceablePods.Excludes(pod) {
+			continue
+		}
+		name := kubepox.PodEndpoint(pod).String()
+
+		policies, err := kubepox.ListPoliciesPerPod(pod, &state.Policies)
+		if err != nil {
+			return nil, err
+		}
+
+		ingressIsolated, egressIsolated := false, false
+		for j := range policies.Items {
+			policy := &policies.Items[j]
+			policyName := policy.Namespace + "/" + policy.Name
+			if kubepox.IsPolicyApplicableToIngress(policy) {
+				ingressIsolated = true
+				for k, rule := range policy.Spec.Ingress {
+					findings, err := ruleFindings(name, Ingress, policyName, k, rule.From, rule.Ports, private)
+					if err != nil {
+						return nil, err
+					}
+					report.Ingress = append(report.Ingress, findings...)
+				}
+			}
+			if kubepox.IsPolicyApplicableToEgress(policy) {
+				egressIsolated = true
+				for k, rule := range policy.Spec.Egress {
+					findings, err := ruleFindings(name, Egress, policyName, k, rule.To, rule.Ports, private)
+					if err != nil {
+						return nil, err
+					}
+					report.Egress = append(report.Egress, findings...)
+				}
+			}
+		}
+		if !ingressIsolated {
+			report.Ingress = append(report.Ingress, Finding{Pod: name, Direction: Ingress, Reason: NotIsolated, Ports: []string{}})
+		}
+		if !egressIsolated {
+			report.Egress = append(report.Egress, Finding{Pod: name, Direction: Egress, Reason: NotIsolated, Ports: []string{}})
+		}
+	}
+
+	return report, nil
+}
+
+// ruleFindings returns the findings of a rule: AnyPeer if it has no peer, PublicIPBlock for each of its
+// ipBlocks covering public addresses.
+func ruleFindings(pod, direction, policy string, rule int, peers []networking.NetworkPolicyPeer, ports []networking.NetworkPolicyPort, private []*net.IPNet) ([]Finding, error) {
+	finding := Finding{
+		Pod:       pod,
+		Direction: direction,
+		Policy:    policy,
+		Rule:      rule,
+		Ports:     renderPorts(ports),
+	}
+	if len(peers) == 0 {
+		finding.Reason = AnyPeer
+		return []Finding{finding}, nil
+	}
+
+	findings := []Finding{}
+	for _, peer := range peers {
+		if peer.IPBlock == nil {
+			continue
+		}
+		_, cidr, err := net.ParseCIDR(peer.IPBlock.CIDR)
+		if err != nil {
+			return nil, fmt.Errorf("policy %s: invalid ipBlock %q: %v", policy, peer.IPBlock.CIDR, err)
+		}
+		excluded, err := ParseRanges(peer.IPBlock.Except)
+		if err != nil {
+			return nil, fmt.Errorf("policy %s: %v", policy, err)
+		}
+		public := publicRanges(cidr, append(excluded, private...))
+		if len(public) == 0 {
+			continue
+		}
+		blockFinding := finding
+		blockFinding.Reason = PublicIPBlock
+		blockFinding.CIDR = peer.IPBlock.CIDR
+		for _, r := range public {
+			blockFinding.Public = append(blockFinding.Public, r.String())
+		}
+		findings = append(findings, blockFinding)
+	}
+	return findings, nil
+}
+
+// renderPorts renders the ports of a rule as protocol/port, or protocol/name for named ports.
+func renderPorts(ports []networking.NetworkPolicyPort) []string {
+	rendered := []string{}
+	for _, p := range ports {
+		protocol := api.ProtocolTCP
+		if p.Protocol != nil {
+			protocol = *p.Protocol
+		}
+		if p.Port == nil {
+			rendered = append(rendered, string(protocol)+"/any")
+			continue
+		}
+		rendered = append(rendered, fmt.Sprintf("%s/%s", protocol, p.Port.String()))
+	}
+	return rendered
+}
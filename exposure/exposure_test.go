@@ -0,0 +1,103 @@
+package exposure
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aporeto-inc/kubepox/cluster"
+)
+
+func TestPublicRanges(t *testing.T) {
+	type testStruct struct {
+		CIDR     string
+		Excluded []string
+		Public   []string
+	}
+
+	tests := []testStruct{
+		testStruct{
+			CIDR:     "10.1.0.0/16",
+			Excluded: DefaultPrivateRanges,
+			Public:   []string{},
+		},
+		testStruct{
+			CIDR:     "0.0.0.0/0",
+			Excluded: []string{"128.0.0.0/1", "0.0.0.0/2"},
+			Public:   []string{"64.0.0.0/2"},
+		},
+		testStruct{
+			CIDR:     "203.0.113.0/24",
+			Excluded: []string{"203.0.113.128/25", "203.0.113.0/26"},
+			Public:   []string{"203.0.113.64/26"},
+		},
+		testStruct{
+			CIDR:     "192.168.0.0/16",
+			Excluded: []string{"192.168.1.0/24", "fc00::/7"},
+			Public:   []string{"192.168.0.0/24", "192.168.2.0/23", "192.168.4.0/22", "192.168.8.0/21", "192.168.16.0/20", "192.168.32.0/19", "192.168.64.0/18", "192.168.128.0/17"},
+		},
+		testStruct{
+			CIDR:     "2001:db8::/32",
+			Excluded: DefaultPrivateRanges,
+			Public:   []string{"2001:db8::/32"},
+		},
+	}
+
+	for i, test := range tests {
+		t.Log("Testing publicRanges ", i)
+		cidr, _ := ParseRanges([]string{test.CIDR})
+		excluded, err := ParseRanges(test.Excluded)
+		if err != nil {
+			t.Fatalf("Error parsing ranges: %s", err)
+		}
+		public := []string{}
+		for _, r := range publicRanges(cidr[0], excluded) {
+			public = append(public, r.String())
+		}
+		if !reflect.DeepEqual(public, test.Public) {
+			t.Errorf("Got public ranges %v expected %v", public, test.Public)
+		}
+	}
+
+	if _, err := ParseRanges([]string{"10.0.0.0"}); err == nil {
+		t.Errorf("Parsed an address without prefix length as a range")
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	state, err := cluster.LoadPath("testdata")
+	if err != nil {
+		t.Fatalf("Error loading state: %s", err)
+	}
+
+	report, err := Analyze(state, Options{})
+	if err != nil {
+		t.Fatalf("Error analyzing exposure: %s", err)
+	}
+
+	if len(report.Ingress) != 1 {
+		t.Fatalf("Got ingress findings %+v expected web/lb only", report.Ingress)
+	}
+	finding := report.Ingress[0]
+	if finding.Pod != "web/lb" || finding.Reason != PublicIPBlock || finding.Policy != "web/allow-lb" || finding.CIDR != "0.0.0.0/0" || !reflect.DeepEqual(finding.Ports, []string{"TCP/443"}) {
+		t.Errorf("Got finding %+v expected the public ipBlock of web/allow-lb", finding)
+	}
+	if len(finding.Public) == 0 || finding.Public[0] != "0.0.0.0/5" {
+		t.Errorf("Got public ranges %v expected the ranges of 0.0.0.0/0 outside of private ranges", finding.Public)
+	}
+
+	expected := []Finding{
+		Finding{Pod: "web/db", Direction: Egress, Reason: AnyPeer, Policy: "web/allow-db", Rule: 0, Ports: []string{"UDP/53"}},
+	}
+	if !reflect.DeepEqual(report.Egress, expected) {
+		t.Errorf("Got egress findings %+v expected %+v", report.Egress, expected)
+	}
+
+	private, _ := ParseRanges([]string{"0.0.0.0/0"})
+	report, err = Analyze(state, Options{PrivateRanges: private})
+	if err != nil {
+		t.Fatalf("Error analyzing exposure: %s", err)
+	}
+	if len(report.Ingress) != 0 {
+		t.Errorf("Got ingress findings %+v with all IPv4 addresses private", report.Ingress)
+	}
+}
@@ -0,0 +1,81 @@
+package exposure
+
+import (
+	"fmt"
+	"net"
+)
+
+// DefaultPrivateRanges are the ranges that are not part of the internet: private, shared, loopback,
+// link-local and unique local addresses.
+var DefaultPrivateRanges = []string{
+	"10.0.0.0/8",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"::1/128",
+	"fc00::/7",
+	"fe80::/10",
+}
+
+// ParseRanges parses a list of CIDRs.
+func ParseRanges(cidrs []string) ([]*net.IPNet, error) {
+	ranges := []*net.IPNet{}
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %v", cidr, err)
+		}
+		ranges = append(ranges, normalize(ipNet))
+	}
+	return ranges, nil
+}
+
+// normalize uses the 4 bytes form for IPv4 networks, so that networks of the same family compare.
+func normalize(ipNet *net.IPNet) *net.IPNet {
+	if ip := ipNet.IP.To4(); ip != nil && len(ipNet.Mask) == net.IPv4len {
+		return &net.IPNet{IP: ip, Mask: ipNet.Mask}
+	}
+	return ipNet
+}
+
+// subtract returns the ranges covering the addresses of a that are not part of b.
+func subtract(a, b *net.IPNet) []*net.IPNet {
+	if len(a.IP) != len(b.IP) {
+		return []*net.IPNet{a}
+	}
+	aOnes, _ := a.Mask.Size()
+	bOnes, _ := b.Mask.Size()
+	switch {
+	case bOnes <= aOnes && b.Contains(a.IP):
+		return nil
+	case bOnes <= aOnes || !a.Contains(b.IP):
+		return []*net.IPNet{a}
+	}
+
+	// b is strictly part of a: split a in halves and subtract b from the half containing it.
+	bits := len(a.IP) * 8
+	mask := net.CIDRMask(aOnes+1, bits)
+	low := &net.IPNet{IP: a.IP.Mask(mask), Mask: mask}
+	high := &net.IPNet{IP: make(net.IP, len(a.IP)), Mask: mask}
+	copy(high.IP, low.IP)
+	high.IP[aOnes/8] |= 0x80 >> uint(aOnes%8)
+	if low.Contains(b.IP) {
+		return append(subtract(low, b), high)
+	}
+	return append([]*net.IPNet{low}, subtract(high, b)...)
+}
+
+// publicRanges returns the ranges of the CIDR that are part of none of the excluded ranges.
+func publicRanges(cidr *net.IPNet, excluded []*net.IPNet) []*net.IPNet {
+	remaining := []*net.IPNet{normalize(cidr)}
+	for _, exclude := range excluded {
+		next := []*net.IPNet{}
+		for _, r := range remaining {
+			next = append(next, subtract(r, exclude)...)
+		}
+		remaining = next
+	}
+	return remaining
+}
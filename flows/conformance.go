@@ -0,0 +1,134 @@
+package flows
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/aporeto-inc/kubepox"
+	"github.com/aporeto-inc/kubepox/cluster"
+)
+
+// Kinds of Mismatch.
+const (
+	// AllowedButDenied is a flow allowed by the CNI that the policies deny.
+	AllowedButDenied = "allowed-but-denied"
+	// DeniedButAllowed is a flow denied by the CNI that the policies allow.
+	DeniedButAllowed = "denied-but-allowed"
+)
+
+// Report is the result of the conformance check of a set of flows.
+type Report struct {
+	// Flows is the number of flows read.
+	Flows int `json:"flows"`
+	// Checked is the number of flows with at least one endpoint resolved to a pod.
+	Checked int `json:"checked"`
+	// Unresolved is the number of flows between addresses that no pod owns.
+	Unresolved int        `json:"unresolved"`
+	Mismatches []Mismatch `json:"mismatches"`
+}
+
+// Mismatch groups the flows between the same endpoints whose verdict differs from the policies.
+type Mismatch struct {
+	Kind        string           `json:"kind"`
+	Source      string           `json:"src"`
+	Destination string           `json:"dst"`
+	Port        int32            `json:"port"`
+	Protocol    string           `json:"protocol"`
+	Count       int              `json:"count"`
+	FirstSeen   *time.Time       `json:"firstSeen,omitempty"`
+	LastSeen    *time.Time       `json:"lastSeen,omitempty"`
+	Verdict     *kubepox.Verdict `json:"expected"`
+}
+
+// Check evaluates the policies of the state on every flow, resolving the addresses to the pods owning them,
+// and reports the flows whose observed verdict differs.
+func Check(flows []Flow, state *cluster.State) (*Report, error) {
+	report := &Report{
+		Flows:      len(flows),
+		Mismatches: []Mismatch{},
+	}
+	mismatches := map[string]*Mismatch{}
+
+	for _, flow := range flows {
+		src := Endpoint(flow.Source, state)
+		dst := Endpoint(flow.Destination, state)
+		if src.Pod == nil && dst.Pod == nil {
+			report.Unresolved++
+			continue
+		}
+		report.Checked++
+
+		verdict, err := kubepox.EvaluateTraffic(src, dst, flow.Port, flow.Protocol, &state.Namespaces, &state.Policies)
+		if err != nil {
+			return nil, err
+		}
+
+		var kind string
+		switch {
+		case flow.Verdict == Allowed && !verdict.Allowed:
+			kind = AllowedButDenied
+		case flow.Verdict == Denied && verdict.Allowed:
+			kind = DeniedButAllowed
+		default:
+			continue
+		}
+
+		mismatch := Mismatch{
+			Kind:        kind,
+			Source:      src.String(),
+			Destination: dst.String(),
+			Port:        flow.Port,
+			Protocol:    string(flow.Protocol),
+			Verdict:     verdict,
+		}
+		key := fmt.Sprintf("%s|%s|%s|%s/%d", kind, mismatch.Source, mismatch.Destination, mismatch.Protocol, flow.Port)
+		if mismatches[key] == nil {
+			mismatches[key] = &mismatch
+		}
+		m := mismatches[key]
+		m.Count++
+		if !flow.Time.IsZero() {
+			seen := flow.Time
+			if m.FirstSeen == nil || seen.Before(*m.FirstSeen) {
+				m.FirstSeen = &seen
+			}
+			if m.LastSeen == nil || seen.After(*m.LastSeen) {
+				m.LastSeen = &seen
+			}
+		}
+	}
+
+	for _, mismatch := range mismatches {
+		report.Mismatches = append(report.Mismatches, *mismatch)
+	}
+	sort.Slice(report.Mismatches, func(i, j int) bool {
+		a, b := report.Mismatches[i], report.Mismatches[j]
+		if a.Source != b.Source {
+			return a.Source < b.Source
+		}
+		if a.Destination != b.Destination {
+			return a.Destination < b.Destination
+		}
+		if a.Port != b.Port {
+			return a.Port < b.Port
+		}
+		if a.Protocol != b.Protocol {
+			return a.Protocol < b.Protocol
+		}
+		return a.Kind < b.Kind
+	})
+
+	return report, nil
+}
+
+// Endpoint returns the pod owning the address, or the address itself if no pod owns it. The endpoint of a pod
+// keeps the observed address, which ipBlock peers are matched against: it differs from the primary address of
+// the pod for the other address family of a dual-stack pod.
+func Endpoint(ip string, state *cluster.State) *kubepox.Endpoint {
+	if pod := state.PodByIP(ip); pod != nil {
+		return &kubepox.Endpoint{Pod: pod, IP: net.ParseIP(ip)}
+	}
+	return kubepox.IPEndpoint(net.ParseIP(ip))
+}
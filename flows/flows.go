@@ -0,0 +1,187 @@
+// Package flows reads the flow records observed on a cluster and checks them against the verdicts of the policies.
+//
+// The native format is JSON lines, one flow per line:
+//
+//	{"time":"2020-09-01T10:00:00Z","src":"10.0.0.1","dst":"10.0.0.2","port":5432,"protocol":"TCP","verdict":"allowed"}
+//
+// protocol defaults to TCP and verdict is either allowed or denied. Hubble flows, as printed by
+// hubble observe -o json, can be read as well.
+package flows
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	api "k8s.io/api/core/v1"
+)
+
+// Verdicts of a Flow.
+const (
+	Allowed = "allowed"
+	Denied  = "denied"
+)
+
+// Supported formats of flow records.
+const (
+	FormatJSONLines = "jsonl"
+	FormatHubble    = "hubble"
+)
+
+// maxLineSize is the size of the longest flow record accepted.
+const maxLineSize = 1024 * 1024
+
+// Flow is a connection observed on the cluster and the verdict of the CNI.
+type Flow struct {
+	Time        time.Time    `json:"time"`
+	Source      string       `json:"src"`
+	Destination string       `json:"dst"`
+	Port        int32        `json:"port"`
+	Protocol    api.Protocol `json:"protocol,omitempty"`
+	Verdict     string       `json:"verdict"`
+}
+
+// Read reads the flow records of r in the given format.
+func Read(r io.Reader, format string) ([]Flow, error) {
+	switch format {
+	case FormatJSONLines, "":
+		return ReadJSONLines(r)
+	case FormatHubble:
+		return ReadHubble(r)
+	default:
+		return nil, fmt.Errorf("unknown flow format %q", format)
+	}
+}
+
+// ReadJSONLines reads flow records in the JSON lines format.
+func ReadJSONLines(r io.Reader) ([]Flow, error) {
+	flows := []Flow{}
+	err := readLines(r, func(line []byte) error {
+		flow := Flow{}
+		if err := json.Unmarshal(line, &flow); err != nil {
+			return err
+		}
+		if flow.Protocol == "" {
+			flow.Protocol = api.ProtocolTCP
+		}
+		flow.Protocol = api.Protocol(strings.ToUpper(string(flow.Protocol)))
+		if flow.Verdict != Allowed && flow.Verdict != Denied {
+			return fmt.Errorf("invalid verdict %q, expected %s or %s", flow.Verdict, Allowed, Denied)
+		}
+		if net.ParseIP(flow.Source) == nil || net.ParseIP(flow.Destination) == nil {
+			return fmt.Errorf("invalid source or destination IP")
+		}
+		flows = append(flows, flow)
+		return nil
+	})
+	return flows, err
+}
+
+// hubbleRecord is a line of hubble observe -o json. Recent versions wrap the flow in a flow field.
+type hubbleRecord struct {
+	Flow *hubbleFlow `json:"flow"`
+	hubbleFlow
+}
+
+// hubbleFlow holds the fields of a Hubble flow needed to check it.
+type hubbleFlow struct {
+	Time           time.Time `json:"time"`
+	Verdict        string    `json:"verdict"`
+	DropReasonDesc string    `json:"drop_reason_desc"`
+	IsReply        bool      `json:"is_reply"`
+	IP             *struct {
+		Source      string `json:"source"`
+		Destination string `json:"destination"`
+	} `json:"IP"`
+	L4 *struct {
+		TCP  *hubblePorts `json:"TCP"`
+		UDP  *hubblePorts `json:"UDP"`
+		SCTP *hubblePorts `json:"SCTP"`
+	} `json:"l4"`
+}
+
+type hubblePorts struct {
+	DestinationPort int32 `json:"destination_port"`
+}
+
+// ReadHubble reads Hubble flows. Only the flows relevant to policies are kept: replies, non IP flows,
+// ICMP flows and packets dropped for another reason than a policy are skipped.
+func ReadHubble(r io.Reader) ([]Flow, error) {
+	flows := []Flow{}
+	err := readLines(r, func(line []byte) error {
+		record := hubbleRecord{}
+		if err := json.Unmarshal(line, &record); err != nil {
+			return err
+		}
+		hubble := &record.hubbleFlow
+		if record.Flow != nil {
+			hubble = record.Flow
+		}
+		if flow, ok := hubble.flow(); ok {
+			flows = append(flows, flow)
+		}
+		return nil
+	})
+	return flows, err
+}
+
+// flow converts a Hubble flow, returning false if it is not relevant to policies.
+func (h *hubbleFlow) flow() (Flow, bool) {
+	if h.IsReply || h.IP == nil || h.L4 == nil {
+		return Flow{}, false
+	}
+
+	flow := Flow{
+		Time:        h.Time,
+		Source:      h.IP.Source,
+		Destination: h.IP.Destination,
+	}
+	switch {
+	case h.L4.TCP != nil:
+		flow.Protocol = api.ProtocolTCP
+		flow.Port = h.L4.TCP.DestinationPort
+	case h.L4.UDP != nil:
+		flow.Protocol = api.ProtocolUDP
+		flow.Port = h.L4.UDP.DestinationPort
+	case h.L4.SCTP != nil:
+		flow.Protocol = api.ProtocolSCTP
+		flow.Port = h.L4.SCTP.DestinationPort
+	default:
+		return Flow{}, false
+	}
+
+	switch h.Verdict {
+	case "FORWARDED":
+		flow.Verdict = Allowed
+	case "DROPPED":
+		if h.DropReasonDesc != "POLICY_DENIED" {
+			return Flow{}, false
+		}
+		flow.Verdict = Denied
+	default:
+		return Flow{}, false
+	}
+	return flow, true
+}
+
+// readLines calls parse on every non empty line of r, annotating errors with the line number.
+func readLines(r io.Reader, parse func(line []byte) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	number := 0
+	for scanner.Scan() {
+		number++
+		line := scanner.Bytes()
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+		if err := parse(line); err != nil {
+			return fmt.Errorf("line %d: %v", number, err)
+		}
+	}
+	return scanner.Err()
+}
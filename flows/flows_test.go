@@ -0,0 +1,183 @@
+package flows
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aporeto-inc/kubepox/cluster"
+
+	api "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func buildPod(name, ip string) api.Pod {
+	return api.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "web", Labels: map[string]string{"app": name}},
+		Status:     api.PodStatus{Phase: api.PodRunning, PodIP: ip},
+	}
+}
+
+func buildState() *cluster.State {
+	postgres := intstr.FromInt(5432)
+	return &cluster.State{
+		Pods: api.PodList{
+			Items: []api.Pod{
+				buildPod("api", "10.0.0.1"),
+				buildPod("db", "10.0.0.2"),
+				buildPod("worker", "10.0.0.3"),
+			},
+		},
+		Policies: networking.NetworkPolicyList{
+			Items: []networking.NetworkPolicy{
+				networking.NetworkPolicy{
+					ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "web"},
+					Spec: networking.NetworkPolicySpec{
+						PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "db"}},
+						Ingress: []networking.NetworkPolicyIngressRule{
+							networking.NetworkPolicyIngressRule{
+								From: []networking.NetworkPolicyPeer{
+									networking.NetworkPolicyPeer{PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "api"}}},
+								},
+								Ports: []networking.NetworkPolicyPort{
+									networking.NetworkPolicyPort{Port: &postgres},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func readFile(t *testing.T, file, format string) []Flow {
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatalf("Error opening %s: %s", file, err)
+	}
+	defer f.Close()
+
+	flows, err := Read(f, format)
+	if err != nil {
+		t.Fatalf("Error reading %s: %s", file, err)
+	}
+	return flows
+}
+
+func TestReadJSONLines(t *testing.T) {
+	flows := readFile(t, "testdata/flows.jsonl", FormatJSONLines)
+	if len(flows) != 6 {
+		t.Fatalf("Got %d flows expected 6", len(flows))
+	}
+	if flows[1].Protocol != api.ProtocolTCP {
+		t.Errorf("Got protocol %s expected TCP by default", flows[1].Protocol)
+	}
+	if flows[3].Protocol != api.ProtocolTCP {
+		t.Errorf("Got protocol %s expected TCP", flows[3].Protocol)
+	}
+	if !flows[0].Time.Equal(time.Date(2020, 9, 1, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("Got time %s", flows[0].Time)
+	}
+}
+
+func TestReadHubble(t *testing.T) {
+	flows := readFile(t, "testdata/hubble.json", FormatHubble)
+
+	expected := []Flow{
+		Flow{Source: "10.0.0.1", Destination: "10.0.0.2", Port: 5432, Protocol: api.ProtocolTCP, Verdict: Allowed},
+		Flow{Source: "10.0.0.3", Destination: "10.0.0.2", Port: 5432, Protocol: api.ProtocolTCP, Verdict: Denied},
+		Flow{Source: "10.0.0.1", Destination: "10.0.0.3", Port: 53, Protocol: api.ProtocolUDP, Verdict: Allowed},
+	}
+	if len(flows) != len(expected) {
+		t.Fatalf("Got %d flows expected %d: %+v", len(flows), len(expected), flows)
+	}
+	for i := range expected {
+		t.Log("Testing ReadHubble ", i)
+		flow := flows[i]
+		flow.Time = time.Time{}
+		if flow != expected[i] {
+			t.Errorf("Got %+v expected %+v", flow, expected[i])
+		}
+	}
+}
+
+func TestRead(t *testing.T) {
+	if _, err := Read(nil, "pcap"); err == nil {
+		t.Errorf("Expected an error for an unknown format")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	state := buildState()
+
+	report, err := Check(readFile(t, "testdata/flows.jsonl", FormatJSONLines), state)
+	if err != nil {
+		t.Fatalf("Error checking flows: %s", err)
+	}
+	if report.Flows != 6 || report.Checked != 5 || report.Unresolved != 1 {
+		t.Errorf("Got %d flows, %d checked, %d unresolved expected 6, 5, 1", report.Flows, report.Checked, report.Unresolved)
+	}
+
+	type testStruct struct {
+		kind        string
+		source      string
+		destination string
+		count       int
+	}
+	tests := []testStruct{
+		testStruct{kind: DeniedButAllowed, source: "web/api", destination: "web/db", count: 1},
+		testStruct{kind: DeniedButAllowed, source: "web/api", destination: "web/worker", count: 1},
+		testStruct{kind: AllowedButDenied, source: "web/worker", destination: "web/db", count: 2},
+	}
+	if len(report.Mismatches) != len(tests) {
+		t.Fatalf("Got mismatches %+v expected %d", report.Mismatches, len(tests))
+	}
+	for i, test := range tests {
+		t.Log("Testing Check ", i)
+		mismatch := report.Mismatches[i]
+		if mismatch.Kind != test.kind || mismatch.Source != test.source || mismatch.Destination != test.destination || mismatch.Count != test.count {
+			t.Errorf("Got %+v expected %+v", mismatch, test)
+		}
+	}
+	if first, last := report.Mismatches[2].FirstSeen, report.Mismatches[2].LastSeen; first == nil || last == nil || !last.After(*first) {
+		t.Errorf("Got first seen %v and last seen %v", report.Mismatches[2].FirstSeen, report.Mismatches[2].LastSeen)
+	}
+
+	report, err = Check(readFile(t, "testdata/hubble.json", FormatHubble), state)
+	if err != nil {
+		t.Fatalf("Error checking flows: %s", err)
+	}
+	if len(report.Mismatches) != 0 {
+		t.Errorf("Got mismatches %+v expected none", report.Mismatches)
+	}
+}
+
+func TestCheckDualStack(t *testing.T) {
+	state := buildState()
+	worker := &state.Pods.Items[2]
+	worker.Status.PodIPs = []api.PodIP{api.PodIP{IP: "10.0.0.3"}, api.PodIP{IP: "fd00::3"}}
+	// Only the IPv6 addresses of the workers reach the db.
+	state.Policies.Items[0].Spec.Ingress = append(state.Policies.Items[0].Spec.Ingress, networking.NetworkPolicyIngressRule{
+		From: []networking.NetworkPolicyPeer{
+			networking.NetworkPolicyPeer{IPBlock: &networking.IPBlock{CIDR: "fd00::/64"}},
+		},
+	})
+
+	observed := []Flow{
+		Flow{Source: "fd00::3", Destination: "10.0.0.2", Port: 5432, Protocol: api.ProtocolTCP, Verdict: Allowed},
+		Flow{Source: "10.0.0.3", Destination: "10.0.0.2", Port: 5432, Protocol: api.ProtocolTCP, Verdict: Allowed},
+	}
+	report, err := Check(observed, state)
+	if err != nil {
+		t.Fatalf("Error checking flows: %s", err)
+	}
+	if len(report.Mismatches) != 1 || report.Mismatches[0].Kind != AllowedButDenied || report.Mismatches[0].Verdict.Allowed {
+		t.Fatalf("Got mismatches %+v expected the IPv4 flow only", report.Mismatches)
+	}
+	if report.Mismatches[0].FirstSeen != nil {
+		t.Errorf("Got first seen %v for flows without time", report.Mismatches[0].FirstSeen)
+	}
+}
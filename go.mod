@@ -3,11 +3,17 @@ module github.com/aporeto-inc/kubepox
 go 1.13
 
 require (
-	github.com/docopt/docopt-go v0.0.0-20180111231733-ee0de3bc6815
+	github.com/golang/protobuf v1.4.2
+	github.com/google/cel-go v0.6.0
 	github.com/imdario/mergo v0.3.11 // indirect
+	github.com/prometheus/client_golang v1.7.1
+	github.com/spf13/cobra v1.0.0
+	github.com/spf13/pflag v1.0.5
 	golang.org/x/time v0.0.0-20200630173020-3af7569d3a1e // indirect
 	k8s.io/api v0.19.0
 	k8s.io/apimachinery v0.19.0
+	k8s.io/cli-runtime v0.19.0
 	k8s.io/client-go v0.19.0
 	k8s.io/utils v0.0.0-20200821003339-5e75c0163111 // indirect
+	sigs.k8s.io/yaml v1.2.0
 )
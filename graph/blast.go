@@ -0,0 +1,114 @@
+package graph
+
+import (
+	"sort"
+
+	"github.com/aporeto-inc/kubepox"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Hop is a connection from a pod to another on a path.
+type Hop struct {
+	From  string         `json:"from"`
+	To    string         `json:"to"`
+	Ports []kubepox.Port `json:"ports"`
+}
+
+// Reach is a pod reachable from the source, with one of the shortest paths to it.
+type Reach struct {
+	Pod       string `json:"pod"`
+	Hops      int    `json:"hops"`
+	Sensitive bool   `json:"sensitive"`
+	Path      []Hop  `json:"path"`
+}
+
+// BlastRadius is the set of pods an attacker controlling the source pod can reach by hopping from pod to pod.
+type BlastRadius struct {
+	Source  string `json:"source"`
+	MaxHops int    `json:"maxHops"`
+	// Reachable are the pods reachable within MaxHops, by number of hops then by name.
+	Reachable []Reach `json:"reachable"`
+}
+
+// Sensitive returns the sensitive pods of the blast radius.
+func (b *BlastRadius) Sensitive() []Reach {
+	sensitive := []Reach{}
+	for _, reach := range b.Reachable {
+		if reach.Sensitive {
+			sensitive = append(sensitive, reach)
+		}
+	}
+	return sensitive
+}
+
+// BlastRadius computes the pods reachable from the source pod, given as namespace/name, within maxHops hops
+// following the allowed connections, 0 standing for no limit. A pod reached is sensitive if its labels match
+// the selector, which can be nil. Only the connections of the pods reached are evaluated.
+func (g *Graph) BlastRadius(source string, maxHops int, sensitive labels.Selector) (*BlastRadius, error) {
+	start, err := g.Node(source)
+	if err != nil {
+		return nil, err
+	}
+	radius := &BlastRadius{
+		Source:    source,
+		MaxHops:   maxHops,
+		Reachable: []Reach{},
+	}
+
+	// Breadth first search, visiting the pods in the order of Pods so that the paths are stable.
+	previous := make([]int, len(g.Pods))
+	hops := make([]int, len(g.Pods))
+	for i := range previous {
+		previous[i] = -1
+	}
+	hops[start] = 0
+	visited := map[int]bool{start: true}
+	queue := []int{start}
+	for len(queue) > 0 {
+		from := queue[0]
+		queue = queue[1:]
+		if maxHops > 0 && hops[from] >= maxHops {
+			continue
+		}
+		if err := g.evaluate(from); err != nil {
+			return nil, err
+		}
+		for to := range g.Pods {
+			if visited[to] || len(g.Ports(from, to)) == 0 {
+				continue
+			}
+			visited[to] = true
+			previous[to] = from
+			hops[to] = hops[from] + 1
+			queue = append(queue, to)
+
+			pod := g.Pods[to]
+			radius.Reachable = append(radius.Reachable, Reach{
+				Pod:       key(pod),
+				Hops:      hops[to],
+				Sensitive: sensitive != nil && sensitive.Matches(labels.Set(pod.Labels)),
+				Path:      g.path(previous, to),
+			})
+		}
+	}
+	sort.SliceStable(radius.Reachable, func(i, j int) bool {
+		if radius.Reachable[i].Hops != radius.Reachable[j].Hops {
+			return radius.Reachable[i].Hops < radius.Reachable[j].Hops
+		}
+		return radius.Reachable[i].Pod < radius.Reachable[j].Pod
+	})
+
+	return radius, nil
+}
+
+// path returns the hops from the start of the search to the pod at index to.
+func (g *Graph) path(previous []int, to int) []Hop {
+	path := []Hop{}
+	for previous[to] >= 0 {
+		from := previous[to]
+		path = append([]Hop{{From: key(g.Pods[from]), To: key(g.Pods[to]), Ports: g.Ports(from, to)}}, path...)
+		to = from
+	}
+	return path
+}
@@ -0,0 +1,165 @@
+// Package graph builds the graph of the connections allowed between the pods of a cluster, to follow the
+// paths an attacker could take from a compromised pod and to partition the pods in isolated segments.
+//
+// The nodes are the pods of the State that have not terminated, and the pods synthesized from the templates
+// of workloads without any pod. There is an edge from a pod to another when the policies allow the first to
+// connect to the second on at least one port: the ports declared by the containers of the destination and
+// the numeric ports of the policies, and port 0 standing for any port for each protocol of a rule port without
+// a number. When there is no such port, the verdict doesn't depend on the port and is reported with port 0.
+//
+// Build evaluates every connection, which takes a time proportional to the square of the number of pods. New
+// evaluates the connections of a pod only when they are followed, so that a search from a pod, such as
+// BlastRadius, only evaluates the connections of the pods it reaches.
+package graph
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/aporeto-inc/kubepox"
+	"github.com/aporeto-inc/kubepox/cluster"
+
+	api "k8s.io/api/core/v1"
+)
+
+// Graph is the directed graph of the allowed connections between pods.
+type Graph struct {
+	// Pods are the nodes of the graph.
+	Pods []*api.Pod
+	// edges holds, for every pod, the connections to every other pod it can connect to, nil until evaluated.
+	edges []map[int]*edge
+	index map[string]int
+	// ports are the ports every pod is probed on.
+	ports [][]kubepox.Port
+	state *cluster.State
+}
+
+// edge holds the allowed connections from a pod to another.
+type edge struct {
+	ports []kubepox.Port
+	// policies are the namespace/name of the policies with a rule allowing a connection.
+	policies map[string]bool
+	// unisolated is true if a side of a connection is not isolated, no rule being needed to allow it.
+	unisolated bool
+}
+
+// Build evaluates the connections between every pair of pods of the State.
+func Build(state *cluster.State) (*Graph, error) {
+	g := New(state)
+	for i := range g.Pods {
+		if err := g.evaluate(i); err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+// New returns the graph of the pods of the State, whose connections are evaluated when they are followed.
+// Ports and Policies only know the connections evaluated so far, and Segments needs them all: use Build
+// to evaluate every connection.
+func New(state *cluster.State) *Graph {
+	state.Sort()
+	g := &Graph{
+		Pods:  []*api.Pod{},
+		index: map[string]int{},
+		state: state,
+	}
+	pending := state.PendingPods()
+	for _, pods := range []*api.PodList{&state.Pods, pending} {
+		for i := range pods.Items {
+			pod := &pods.Items[i]
+			if kubepox.ClassifyPod(pod) == kubepox.PodTerminated {
+				continue
+			}
+			g.index[key(pod)] = len(g.Pods)
+			g.Pods = append(g.Pods, pod)
+		}
+	}
+
+	policyPorts := kubepox.PolicyPorts(&state.Policies)
+	g.edges = make([]map[int]*edge, len(g.Pods))
+	g.ports = make([][]kubepox.Port, len(g.Pods))
+	for j, dst := range g.Pods {
+		g.ports[j] = kubepox.MergePorts(kubepox.ContainerPorts(dst), policyPorts)
+		if len(g.ports[j]) == 0 {
+			g.ports[j] = []kubepox.Port{{Protocol: api.ProtocolTCP}}
+		}
+	}
+	return g
+}
+
+// evaluate evaluates the connections from the pod at index i to every other pod, once.
+func (g *Graph) evaluate(i int) error {
+	if g.edges[i] != nil {
+		return nil
+	}
+	edges := map[int]*edge{}
+	src := g.Pods[i]
+	for j, dst := range g.Pods {
+		if i == j {
+			continue
+		}
+		for _, port := range g.ports[j] {
+			verdict, err := kubepox.EvaluateTraffic(kubepox.PodEndpoint(src), kubepox.PodEndpoint(dst), port.Number, port.Protocol, &g.state.Namespaces, &g.state.Policies)
+			if err != nil {
+				return err
+			}
+			if !verdict.Allowed {
+				continue
+			}
+			e := edges[j]
+			if e == nil {
+				e = &edge{policies: map[string]bool{}}
+				edges[j] = e
+			}
+			e.ports = append(e.ports, port)
+			for _, name := range verdict.EgressPolicies {
+				e.policies[src.Namespace+"/"+name] = true
+			}
+			for _, name := range verdict.IngressPolicies {
+				e.policies[dst.Namespace+"/"+name] = true
+			}
+			if !verdict.EgressIsolated || !verdict.IngressIsolated {
+				e.unisolated = true
+			}
+		}
+	}
+	g.edges[i] = edges
+	return nil
+}
+
+func key(pod *api.Pod) string {
+	return pod.Namespace + "/" + pod.Name
+}
+
+// Node returns the index of the pod with the given namespace/name in Pods.
+func (g *Graph) Node(name string) (int, error) {
+	i, ok := g.index[name]
+	if !ok {
+		return 0, fmt.Errorf("pod %s is not part of the graph", name)
+	}
+	return i, nil
+}
+
+// Ports returns the ports the pod at index from can connect to on the pod at index to, nil if it can't connect to it.
+func (g *Graph) Ports(from, to int) []kubepox.Port {
+	if e := g.edges[from][to]; e != nil {
+		return e.ports
+	}
+	return nil
+}
+
+// Policies returns the namespace/name of the policies with a rule allowing the pod at index from to connect
+// to the pod at index to, sorted, and whether a side of the connection is not isolated, so that no rule is needed to allow it.
+func (g *Graph) Policies(from, to int) ([]string, bool) {
+	e := g.edges[from][to]
+	if e == nil {
+		return nil, false
+	}
+	policies := []string{}
+	for name := range e.policies {
+		policies = append(policies, name)
+	}
+	sort.Strings(policies)
+	return policies, e.unisolated
+}
@@ -0,0 +1,161 @@
+package graph
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aporeto-inc/kubepox"
+	"github.com/aporeto-inc/kubepox/cluster"
+
+	api "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+func buildGraph(t *testing.T, path string) *Graph {
+	state, err := cluster.LoadPath(path)
+	if err != nil {
+		t.Fatalf("Error loading state: %s", err)
+	}
+	g, err := Build(state)
+	if err != nil {
+		t.Fatalf("Error building graph: %s", err)
+	}
+	return g
+}
+
+func TestBuild(t *testing.T) {
+	g := buildGraph(t, "testdata/blast")
+
+	type testStruct struct {
+		From  string
+		To    string
+		Ports []kubepox.Port
+	}
+
+	tests := []testStruct{
+		testStruct{From: "web/frontend", To: "web/api", Ports: []kubepox.Port{{Number: 8080, Protocol: api.ProtocolTCP}}},
+		testStruct{From: "tools/debug", To: "web/frontend", Ports: []kubepox.Port{{Number: 80, Protocol: api.ProtocolTCP}}},
+		testStruct{From: "web/api", To: "web/db", Ports: []kubepox.Port{{Number: 5432, Protocol: api.ProtocolTCP}}},
+		testStruct{From: "web/frontend", To: "web/db", Ports: nil},
+		testStruct{From: "web/db", To: "tools/debug", Ports: []kubepox.Port{{Number: 80, Protocol: api.ProtocolTCP}, {Number: 5432, Protocol: api.ProtocolTCP}, {Number: 8080, Protocol: api.ProtocolTCP}, {Number: 0, Protocol: api.ProtocolUDP}}},
+		// The UDP rule without port allows any UDP port.
+		testStruct{From: "web/db", To: "web/api", Ports: []kubepox.Port{{Number: 0, Protocol: api.ProtocolUDP}}},
+	}
+
+	for i, test := range tests {
+		t.Log("Testing edge ", i)
+		from, err := g.Node(test.From)
+		if err != nil {
+			t.Fatalf("Error finding %s: %s", test.From, err)
+		}
+		to, err := g.Node(test.To)
+		if err != nil {
+			t.Fatalf("Error finding %s: %s", test.To, err)
+		}
+		if ports := g.Ports(from, to); !reflect.DeepEqual(ports, test.Ports) {
+			t.Errorf("Got ports %v from %s to %s expected %v", ports, test.From, test.To, test.Ports)
+		}
+	}
+
+	if _, err := g.Node("web/unknown"); err == nil {
+		t.Errorf("Found a pod that doesn't exist")
+	}
+}
+
+func TestBlastRadius(t *testing.T) {
+	g := buildGraph(t, "testdata/blast")
+	sensitive, _ := labels.Parse("tier=data")
+
+	type testStruct struct {
+		MaxHops   int
+		Reachable []string
+	}
+
+	tests := []testStruct{
+		testStruct{MaxHops: 0, Reachable: []string{"tools/debug", "web/api", "web/db"}},
+		testStruct{MaxHops: 1, Reachable: []string{"tools/debug", "web/api"}},
+	}
+
+	for i, test := range tests {
+		t.Log("Testing BlastRadius ", i)
+		radius, err := g.BlastRadius("web/frontend", test.MaxHops, sensitive)
+		if err != nil {
+			t.Fatalf("Error computing blast radius: %s", err)
+		}
+		reachable := []string{}
+		for _, reach := range radius.Reachable {
+			reachable = append(reachable, reach.Pod)
+		}
+		if !reflect.DeepEqual(reachable, test.Reachable) {
+			t.Errorf("Got reachable pods %v expected %v", reachable, test.Reachable)
+		}
+	}
+
+	radius, err := g.BlastRadius("web/frontend", 0, sensitive)
+	if err != nil {
+		t.Fatalf("Error computing blast radius: %s", err)
+	}
+	targets := radius.Sensitive()
+	if len(targets) != 1 || targets[0].Pod != "web/db" || targets[0].Hops != 2 {
+		t.Fatalf("Got sensitive pods %+v expected web/db in 2 hops", targets)
+	}
+	path := targets[0].Path
+	if len(path) != 2 || path[0].From != "web/frontend" || path[0].To != "web/api" || path[1].To != "web/db" {
+		t.Errorf("Got path %+v expected web/frontend to web/api to web/db", path)
+	}
+}
+
+func TestBlastRadiusLazy(t *testing.T) {
+	state, err := cluster.LoadPath("testdata/blast")
+	if err != nil {
+		t.Fatalf("Error loading state: %s", err)
+	}
+	g := New(state)
+
+	radius, err := g.BlastRadius("web/api", 1, nil)
+	if err != nil {
+		t.Fatalf("Error computing blast radius: %s", err)
+	}
+	if len(radius.Reachable) != 3 {
+		t.Errorf("Got reachable pods %+v expected tools/debug, web/db and web/frontend", radius.Reachable)
+	}
+
+	// Only the connections of web/api, the only pod expanded within one hop, are evaluated.
+	for i, pod := range g.Pods {
+		if evaluated := g.edges[i] != nil; evaluated != (key(pod) == "web/api") {
+			t.Errorf("Got connections of %s evaluated %t", key(pod), evaluated)
+		}
+	}
+}
+
+func TestSegments(t *testing.T) {
+	g := buildGraph(t, "testdata/segments")
+	segmentation := g.Segments()
+
+	// Both tenants reach shared/proxy, which doesn't reach them back: they stay in separate segments.
+	segments := [][]string{
+		[]string{"tenant-a/a1", "tenant-a/a2", "tenant-a/a3"},
+		[]string{"tenant-b/b1", "tenant-b/b2"},
+		[]string{"shared/proxy"},
+	}
+	if !reflect.DeepEqual(segmentation.Segments, segments) {
+		t.Errorf("Got segments %v expected %v", segmentation.Segments, segments)
+	}
+
+	if !reflect.DeepEqual(segmentation.BridgePods, []string{"tenant-a/a1"}) {
+		t.Errorf("Got bridge pods %v expected tenant-a/a1", segmentation.BridgePods)
+	}
+
+	gateway := []string{"tenant-a/gateway", "tenant-a/through-gateway"}
+	bridges := []Bridge{
+		Bridge{From: "tenant-a/a1", To: "tenant-a/a2", Policies: gateway},
+		Bridge{From: "tenant-a/a1", To: "tenant-a/a3", Policies: gateway},
+		Bridge{From: "tenant-a/a2", To: "tenant-a/a1", Policies: gateway},
+		Bridge{From: "tenant-a/a3", To: "tenant-a/a1", Policies: gateway},
+		Bridge{From: "tenant-b/b1", To: "tenant-b/b2", Policies: []string{"tenant-b/same-namespace"}},
+		Bridge{From: "tenant-b/b2", To: "tenant-b/b1", Policies: []string{"tenant-b/same-namespace"}},
+	}
+	if !reflect.DeepEqual(segmentation.Bridges, bridges) {
+		t.Errorf("Got bridges %+v expected %+v", segmentation.Bridges, bridges)
+	}
+}
@@ -0,0 +1,324 @@
+package graph
+
+import (
+	"sort"
+)
+
+// Bridge is a connection between two pods of a segment whose removal would split it.
+type Bridge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Policies are the namespace/name of the policies with a rule allowing the connection.
+	Policies []string `json:"policies"`
+	// Unisolated is true if a side of the connection is not isolated, so that no rule is needed to allow it.
+	Unisolated bool `json:"unisolated"`
+}
+
+// Segmentation is the partition of the pods in segments.
+type Segmentation struct {
+	// Segments are the namespace/name of the pods of every segment, largest first.
+	Segments [][]string `json:"segments"`
+	// BridgePods are the pods whose removal would split their segment.
+	BridgePods []string `json:"bridgePods"`
+	// Bridges are the connections whose removal would split their segment.
+	Bridges []Bridge `json:"bridges"`
+}
+
+// Segments partitions the pods in segments: two pods are in the same segment if each can reach the other
+// through a chain of allowed connections. Pods of different segments can't reach each other both ways:
+// a pod may reach a pod of another segment, such as a shared service, but is then never reached back from
+// that segment, so that tenants reaching the same shared pods stay in separate segments.
+//
+// The bridges of a segment are the pods and the connections without which some pods of the segment would no
+// longer reach each other both ways.
+func (g *Graph) Segments() *Segmentation {
+	// Successors and predecessors, in the order of Pods so that the results are stable.
+	successors := make([][]int, len(g.Pods))
+	predecessors := make([][]int, len(g.Pods))
+	for i := range g.Pods {
+		for j := range g.Pods {
+			if i != j && g.edges[i][j] != nil {
+				successors[i] = append(successors[i], j)
+				predecessors[j] = append(predecessors[j], i)
+			}
+		}
+	}
+
+	s := &Segmentation{
+		Segments:   [][]string{},
+		BridgePods: []string{},
+		Bridges:    []Bridge{},
+	}
+
+	bridgePods := map[int]bool{}
+	segments := components(len(g.Pods), successors, nil)
+	for _, segment := range segments {
+		pods, bridges := strongBridges(segment, successors, predecessors)
+		for _, pod := range pods {
+			bridgePods[pod] = true
+		}
+		for _, bridge := range bridges {
+			s.Bridges = append(s.Bridges, g.bridge(bridge[0], bridge[1]))
+		}
+
+		names := []string{}
+		for _, pod := range segment {
+			names = append(names, key(g.Pods[pod]))
+		}
+		sort.Strings(names)
+		s.Segments = append(s.Segments, names)
+	}
+	sort.SliceStable(s.Segments, func(i, j int) bool {
+		if len(s.Segments[i]) != len(s.Segments[j]) {
+			return len(s.Segments[i]) > len(s.Segments[j])
+		}
+		return s.Segments[i][0] < s.Segments[j][0]
+	})
+
+	for pod := range g.Pods {
+		if bridgePods[pod] {
+			s.BridgePods = append(s.BridgePods, key(g.Pods[pod]))
+		}
+	}
+	sort.Strings(s.BridgePods)
+	sort.Slice(s.Bridges, func(i, j int) bool {
+		if s.Bridges[i].From != s.Bridges[j].From {
+			return s.Bridges[i].From < s.Bridges[j].From
+		}
+		return s.Bridges[i].To < s.Bridges[j].To
+	})
+
+	return s
+}
+
+// components returns the strongly connected components of the graph of n nodes, leaving out the removed nodes.
+// It is Tarjan's algorithm: a depth first search numbering the nodes in visit order and tracking the lowest
+// number of the nodes still on the stack reachable from the subtree of each node.
+func components(n int, successors [][]int, removed map[int]bool) [][]int {
+	order := make([]int, n)
+	low := make([]int, n)
+	onStack := make([]bool, n)
+	stack := []int{}
+	counter := 0
+	result := [][]int{}
+
+	var visit func(node int)
+	visit = func(node int) {
+		counter++
+		order[node], low[node] = counter, counter
+		stack = append(stack, node)
+		onStack[node] = true
+		for _, next := range successors[node] {
+			if removed[next] {
+				continue
+			}
+			if order[next] == 0 {
+				visit(next)
+				if low[next] < low[node] {
+					low[node] = low[next]
+				}
+			} else if onStack[next] && order[next] < low[node] {
+				low[node] = order[next]
+			}
+		}
+		if low[node] != order[node] {
+			return
+		}
+		component := []int{}
+		for {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[top] = false
+			component = append(component, top)
+			if top == node {
+				break
+			}
+		}
+		sort.Ints(component)
+		result = append(result, component)
+	}
+
+	for node := 0; node < n; node++ {
+		if order[node] == 0 && !removed[node] {
+			visit(node)
+		}
+	}
+	return result
+}
+
+// strongBridges returns the strong articulation points and the strong bridges of a strongly connected
+// component: the nodes and the edges whose removal splits it in several components.
+//
+// Following Italiano, Laura and Santaroni, with s a node of the component, G(s) the flow graph of the
+// component from s and G^R(s) the flow graph of its reverse from s:
+//   - a node other than s is a strong articulation point if it dominates another node in G(s) or G^R(s),
+//     and s is one if the component without s is not strongly connected,
+//   - an edge is a strong bridge if every path from s to its head goes through it in G(s), or if the
+//     same holds for its reverse in G^R(s).
+func strongBridges(component []int, successors, predecessors [][]int) ([]int, [][2]int) {
+	if len(component) < 2 {
+		return nil, nil
+	}
+	member := map[int]bool{}
+	for _, node := range component {
+		member[node] = true
+	}
+	source := component[0]
+
+	points := map[int]bool{}
+	bridges := map[[2]int]bool{}
+	for _, reverse := range []bool{false, true} {
+		forward, backward := successors, predecessors
+		if reverse {
+			forward, backward = predecessors, successors
+		}
+		idom := dominators(source, member, forward)
+		for node, dominator := range idom {
+			if node == source {
+				continue
+			}
+			if dominator != source {
+				points[dominator] = true
+			}
+			// The edge from the immediate dominator is the only way in if the node dominates all its other
+			// predecessors: they can only be reached through it.
+			only := true
+			for _, previous := range backward[node] {
+				if member[previous] && previous != dominator && !dominates(idom, source, node, previous) {
+					only = false
+					break
+				}
+			}
+			if only {
+				if reverse {
+					bridges[[2]int{node, dominator}] = true
+				} else {
+					bridges[[2]int{dominator, node}] = true
+				}
+			}
+		}
+	}
+
+	if len(componentsOf(component, successors, map[int]bool{source: true})) > 1 {
+		points[source] = true
+	}
+
+	pointList := []int{}
+	for point := range points {
+		pointList = append(pointList, point)
+	}
+	bridgeList := [][2]int{}
+	for bridge := range bridges {
+		bridgeList = append(bridgeList, bridge)
+	}
+	return pointList, bridgeList
+}
+
+// componentsOf returns the strongly connected components of the nodes of the component that are not removed.
+func componentsOf(component []int, successors [][]int, removed map[int]bool) [][]int {
+	// Restrict the graph to the component, renumbering its nodes.
+	local := map[int]int{}
+	for i, node := range component {
+		local[node] = i
+	}
+	restricted := make([][]int, len(component))
+	localRemoved := map[int]bool{}
+	for i, node := range component {
+		if removed[node] {
+			localRemoved[i] = true
+		}
+		for _, next := range successors[node] {
+			if j, ok := local[next]; ok {
+				restricted[i] = append(restricted[i], j)
+			}
+		}
+	}
+	return components(len(component), restricted, localRemoved)
+}
+
+// dominators returns the immediate dominator of every node of the flow graph of the members from source,
+// following the edges of successors. It is the iterative algorithm of Cooper, Harvey and Kennedy, on the
+// nodes in reverse postorder.
+func dominators(source int, member map[int]bool, successors [][]int) map[int]int {
+	postorder := []int{}
+	visited := map[int]bool{}
+	var visit func(node int)
+	visit = func(node int) {
+		visited[node] = true
+		for _, next := range successors[node] {
+			if member[next] && !visited[next] {
+				visit(next)
+			}
+		}
+		postorder = append(postorder, node)
+	}
+	visit(source)
+
+	number := map[int]int{}
+	predecessors := map[int][]int{}
+	for i, node := range postorder {
+		number[node] = i
+		for _, next := range successors[node] {
+			if member[next] {
+				predecessors[next] = append(predecessors[next], node)
+			}
+		}
+	}
+
+	idom := map[int]int{source: source}
+	intersect := func(a, b int) int {
+		for a != b {
+			for number[a] < number[b] {
+				a = idom[a]
+			}
+			for number[b] < number[a] {
+				b = idom[b]
+			}
+		}
+		return a
+	}
+	for changed := true; changed; {
+		changed = false
+		for i := len(postorder) - 2; i >= 0; i-- {
+			node := postorder[i]
+			dominator := -1
+			for _, previous := range predecessors[node] {
+				if _, ok := idom[previous]; !ok {
+					continue
+				}
+				if dominator < 0 {
+					dominator = previous
+				} else {
+					dominator = intersect(previous, dominator)
+				}
+			}
+			if current, ok := idom[node]; dominator >= 0 && (!ok || current != dominator) {
+				idom[node] = dominator
+				changed = true
+			}
+		}
+	}
+	return idom
+}
+
+// dominates returns true if the node dominates other, following the immediate dominators of other up to source.
+func dominates(idom map[int]int, source, node, other int) bool {
+	for other != source {
+		if other == node {
+			return true
+		}
+		other = idom[other]
+	}
+	return node == source
+}
+
+// bridge returns the Bridge of the connection from the pod at index from to the pod at index to.
+func (g *Graph) bridge(from, to int) Bridge {
+	policies, unisolated := g.Policies(from, to)
+	return Bridge{
+		From:       key(g.Pods[from]),
+		To:         key(g.Pods[to]),
+		Policies:   policies,
+		Unisolated: unisolated,
+	}
+}
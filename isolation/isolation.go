@@ -0,0 +1,227 @@
+// Package isolation evaluates the isolation and the effective rules of every pod of a cluster.State, and
+// describes the changes between two evaluations, as streamed by kubepox watch on every change of a cluster.Cache.
+//
+// Pods that NetworkPolicies don't govern, on the host network or terminated, are reported as such and left out
+// of the isolation changes.
+package isolation
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/aporeto-inc/kubepox"
+	"github.com/aporeto-inc/kubepox/cluster"
+
+	networking "k8s.io/api/networking/v1"
+)
+
+// State is the policy view of a set of pods at one point in time.
+type State struct {
+	Namespaces map[string]bool
+	Pods       map[string]Pod
+	// Policies holds the number of pods selected by each policy.
+	Policies map[string]int
+}
+
+// Pod is the isolation status and the effective rules of a single pod.
+type Pod struct {
+	// Class tells whether NetworkPolicies govern the pod. The other fields are only set if they do.
+	Class        kubepox.PodClass
+	Ingress      bool
+	Egress       bool
+	IngressRules int
+	EgressRules  int
+	// Rules is a canonical representation of the effective rules, used to detect any change.
+	Rules string
+}
+
+func objectKey(namespace, name string) string {
+	if namespace == "" {
+		return name
+	}
+	return namespace + "/" + name
+}
+
+// Compute evaluates the isolation of every pod of the state against its policies.
+func Compute(state *cluster.State) (*State, error) {
+	current := &State{
+		Namespaces: map[string]bool{},
+		Pods:       map[string]Pod{},
+		Policies:   map[string]int{},
+	}
+
+	for _, namespace := range state.Namespaces.Items {
+		current.Namespaces[namespace.Name] = true
+	}
+
+	podList := &state.Pods
+	policyList := &state.Policies
+
+	for i := range podList.Items {
+		pod := &podList.Items[i]
+		if kubepox.UnenforceablePods.Excludes(pod) {
+			current.Pods[objectKey(pod.Namespace, pod.Name)] = Pod{Class: kubepox.ClassifyPod(pod)}
+			continue
+		}
+		ingress, egress, err := kubepox.IsPodSelected(pod, policyList)
+		if err != nil {
+			return nil, err
+		}
+		ingressRules, err := kubepox.ListIngressRulesPerPod(pod, policyList)
+		if err != nil {
+			return nil, err
+		}
+		egressRules, err := kubepox.ListEgressRulesPerPod(pod, policyList)
+		if err != nil {
+			return nil, err
+		}
+
+		isolation := Pod{
+			Class:   kubepox.ClassifyPod(pod),
+			Ingress: ingress,
+			Egress:  egress,
+		}
+		// A pod not isolated in a direction has no rule in it, as an isolated pod without any rule: the change
+		// of isolation is reported on its own.
+		ingressList := []networking.NetworkPolicyIngressRule{}
+		if ingressRules != nil {
+			ingressList = append(ingressList, *ingressRules...)
+		}
+		egressList := []networking.NetworkPolicyEgressRule{}
+		if egressRules != nil {
+			egressList = append(egressList, *egressRules...)
+		}
+		rules, err := json.Marshal([]interface{}{ingressList, egressList})
+		if err != nil {
+			return nil, err
+		}
+		isolation.Rules = string(rules)
+		isolation.IngressRules = len(ingressList)
+		isolation.EgressRules = len(egressList)
+		current.Pods[objectKey(pod.Namespace, pod.Name)] = isolation
+	}
+
+	for i := range policyList.Items {
+		policy := &policyList.Items[i]
+		selected, err := kubepox.ListPodsPerPolicy(policy, podList)
+		if err != nil {
+			return nil, err
+		}
+		current.Policies[objectKey(policy.Namespace, policy.Name)] = len(selected.Items)
+	}
+
+	return current, nil
+}
+
+func isolationString(isolated bool) string {
+	if isolated {
+		return "isolated"
+	}
+	return "NOT isolated"
+}
+
+// Diff returns one human readable line per change between two states.
+func Diff(before, after *State) []string {
+	lines := []string{}
+
+	for _, name := range namespaceNames(before, after) {
+		_, existed := before.Namespaces[name]
+		_, exists := after.Namespaces[name]
+		switch {
+		case !existed && exists:
+			lines = append(lines, fmt.Sprintf("namespace %s created", name))
+		case existed && !exists:
+			lines = append(lines, fmt.Sprintf("namespace %s deleted", name))
+		}
+	}
+
+	for _, name := range policyNames(before, after) {
+		old, existed := before.Policies[name]
+		cur, exists := after.Policies[name]
+		switch {
+		case !existed && exists:
+			lines = append(lines, fmt.Sprintf("policy %s created, selecting %d pods", name, cur))
+		case existed && !exists:
+			lines = append(lines, fmt.Sprintf("policy %s deleted", name))
+		case old == 0 && cur > 0:
+			lines = append(lines, fmt.Sprintf("policy %s started selecting pods (%d)", name, cur))
+		case old > 0 && cur == 0:
+			lines = append(lines, fmt.Sprintf("policy %s stopped selecting pods", name))
+		}
+	}
+
+	for _, name := range podNames(before, after) {
+		old, existed := before.Pods[name]
+		cur, exists := after.Pods[name]
+		switch {
+		case !existed && exists && !cur.Class.Enforceable():
+			lines = append(lines, fmt.Sprintf("pod %s created and %s", name, cur.Class.Describe()))
+		case !existed && exists:
+			lines = append(lines, fmt.Sprintf("pod %s created: ingress %s, egress %s", name, isolationString(cur.Ingress), isolationString(cur.Egress)))
+		case existed && !exists:
+			lines = append(lines, fmt.Sprintf("pod %s deleted", name))
+		case !cur.Class.Enforceable():
+			if old.Class != cur.Class {
+				lines = append(lines, fmt.Sprintf("pod %s %s", name, cur.Class.Describe()))
+			}
+		default:
+			if old.Ingress != cur.Ingress {
+				lines = append(lines, fmt.Sprintf("pod %s ingress: %s -> %s", name, isolationString(old.Ingress), isolationString(cur.Ingress)))
+			}
+			if old.Egress != cur.Egress {
+				lines = append(lines, fmt.Sprintf("pod %s egress: %s -> %s", name, isolationString(old.Egress), isolationString(cur.Egress)))
+			}
+			if old.Rules != cur.Rules {
+				lines = append(lines, fmt.Sprintf("pod %s effective rules changed: ingress %d -> %d, egress %d -> %d", name, old.IngressRules, cur.IngressRules, old.EgressRules, cur.EgressRules))
+			}
+		}
+	}
+
+	return lines
+}
+
+// namespaceNames returns the namespaces of either state, sorted.
+func namespaceNames(before, after *State) []string {
+	set := map[string]bool{}
+	for name := range before.Namespaces {
+		set[name] = true
+	}
+	for name := range after.Namespaces {
+		set[name] = true
+	}
+	return sortedSet(set)
+}
+
+// policyNames returns the policies of either state, sorted.
+func policyNames(before, after *State) []string {
+	set := map[string]bool{}
+	for name := range before.Policies {
+		set[name] = true
+	}
+	for name := range after.Policies {
+		set[name] = true
+	}
+	return sortedSet(set)
+}
+
+// podNames returns the pods of either state, sorted.
+func podNames(before, after *State) []string {
+	set := map[string]bool{}
+	for name := range before.Pods {
+		set[name] = true
+	}
+	for name := range after.Pods {
+		set[name] = true
+	}
+	return sortedSet(set)
+}
+
+func sortedSet(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
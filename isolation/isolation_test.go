@@ -0,0 +1,182 @@
+package isolation
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aporeto-inc/kubepox/cluster"
+
+	api "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var (
+	allowFrontend = networking.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "web"},
+		Spec: networking.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "api"}},
+			PolicyTypes: []networking.PolicyType{networking.PolicyTypeIngress},
+			Ingress: []networking.NetworkPolicyIngressRule{
+				{From: []networking.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "frontend"}}}}},
+			},
+		},
+	}
+
+	allowAdmin = networking.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "web"},
+		Spec: networking.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "api"}},
+			PolicyTypes: []networking.PolicyType{networking.PolicyTypeIngress},
+			Ingress: []networking.NetworkPolicyIngressRule{
+				{From: []networking.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "frontend"}}}}},
+				{From: []networking.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "admin"}}}}},
+			},
+		},
+	}
+
+	denyEgress = networking.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "deny-egress", Namespace: "web"},
+		Spec: networking.NetworkPolicySpec{
+			PolicyTypes: []networking.PolicyType{networking.PolicyTypeEgress},
+		},
+	}
+)
+
+func buildPod(name string, labels map[string]string) api.Pod {
+	return api.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "web", Labels: labels},
+		Status:     api.PodStatus{Phase: api.PodRunning, PodIP: "10.0.0.1"},
+	}
+}
+
+// buildState returns the web and batch namespaces, with the api and frontend pods of web and the given policies.
+func buildState(policies ...networking.NetworkPolicy) *cluster.State {
+	state := &cluster.State{}
+	state.Namespaces.Items = []api.Namespace{
+		{ObjectMeta: metav1.ObjectMeta{Name: "batch"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "web"}},
+	}
+	state.Pods.Items = []api.Pod{
+		buildPod("api", map[string]string{"app": "api"}),
+		buildPod("frontend", map[string]string{"app": "frontend"}),
+	}
+	state.Policies.Items = policies
+	return state
+}
+
+func TestDiff(t *testing.T) {
+	type testStruct struct {
+		description string
+		before      *cluster.State
+		after       *cluster.State
+		result      []string
+	}
+
+	relabeled := buildState(allowFrontend)
+	relabeled.Pods.Items[0].Labels = map[string]string{"app": "worker"}
+	terminated := buildState(allowFrontend)
+	terminated.Pods.Items[0].Status.Phase = api.PodSucceeded
+	deleted := buildState(allowFrontend)
+	deleted.Namespaces.Items = deleted.Namespaces.Items[1:]
+	hostNetwork := buildState(allowFrontend)
+	agent := buildPod("agent", map[string]string{"app": "api"})
+	agent.Spec.HostNetwork = true
+	hostNetwork.Pods.Items = append(hostNetwork.Pods.Items, agent)
+
+	tests := []testStruct{
+		testStruct{
+			description: "no change",
+			before:      buildState(allowFrontend),
+			after:       buildState(allowFrontend),
+			result:      []string{},
+		},
+		testStruct{
+			description: "pod becoming isolated",
+			before:      buildState(),
+			after:       buildState(allowFrontend),
+			result: []string{
+				"policy web/api created, selecting 1 pods",
+				"pod web/api ingress: NOT isolated -> isolated",
+				"pod web/api effective rules changed: ingress 0 -> 1, egress 0 -> 0",
+			},
+		},
+		testStruct{
+			description: "pod becoming non-isolated",
+			before:      buildState(allowFrontend),
+			after:       relabeled,
+			result: []string{
+				"policy web/api stopped selecting pods",
+				"pod web/api ingress: isolated -> NOT isolated",
+				"pod web/api effective rules changed: ingress 1 -> 0, egress 0 -> 0",
+			},
+		},
+		testStruct{
+			description: "rule change",
+			before:      buildState(allowFrontend),
+			after:       buildState(allowAdmin),
+			result: []string{
+				"pod web/api effective rules changed: ingress 1 -> 2, egress 0 -> 0",
+			},
+		},
+		testStruct{
+			description: "policy added",
+			before:      buildState(allowFrontend),
+			after:       buildState(allowFrontend, denyEgress),
+			result: []string{
+				"policy web/deny-egress created, selecting 2 pods",
+				"pod web/api egress: NOT isolated -> isolated",
+				"pod web/frontend egress: NOT isolated -> isolated",
+			},
+		},
+		testStruct{
+			description: "policy removed",
+			before:      buildState(allowFrontend, denyEgress),
+			after:       buildState(allowFrontend),
+			result: []string{
+				"policy web/deny-egress deleted",
+				"pod web/api egress: isolated -> NOT isolated",
+				"pod web/frontend egress: isolated -> NOT isolated",
+			},
+		},
+		testStruct{
+			description: "namespace deleted",
+			before:      buildState(allowFrontend),
+			after:       deleted,
+			result: []string{
+				"namespace batch deleted",
+			},
+		},
+		testStruct{
+			description: "pod terminated",
+			before:      buildState(allowFrontend),
+			after:       terminated,
+			result: []string{
+				"pod web/api has terminated: NetworkPolicies have no traffic to enforce on it",
+			},
+		},
+		testStruct{
+			description: "host network pod created",
+			before:      buildState(allowFrontend),
+			after:       hostNetwork,
+			result: []string{
+				"pod web/agent created and uses the host network: NetworkPolicies are not enforced on it",
+			},
+		},
+	}
+
+	for i, test := range tests {
+		t.Log("Testing Diff ", i)
+		before, err := Compute(test.before)
+		if err != nil {
+			t.Fatalf("Test %d Error computing the state before %s: %s", i, test.description, err)
+		}
+		after, err := Compute(test.after)
+		if err != nil {
+			t.Fatalf("Test %d Error computing the state after %s: %s", i, test.description, err)
+		}
+		if result := Diff(before, after); !reflect.DeepEqual(result, test.result) {
+			t.Errorf("Test %d %s: Got %q expected %q", i, test.description, result, test.result)
+		}
+	}
+}
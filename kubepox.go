@@ -67,6 +67,10 @@ func ListPodsPerPolicy(np *networking.NetworkPolicy, allPods *api.PodList) (*api
 
 	// Match pods based on the Label Selector that came with the policy
 	for _, pod := range allPods.Items {
+		// A policy only selects pods from its own namespace
+		if pod.Namespace != np.Namespace {
+			continue
+		}
 		if selector.Matches(labels.Set(pod.GetLabels())) {
 			matchedPods.Items = append(matchedPods.Items, pod)
 		}
@@ -640,6 +640,16 @@ func TestListPodsPerPolicy(t *testing.T) {
 			Pods:   buildPodList(),
 			Result: buildPodList(),
 		},
+		testStruct{
+			Policy: np1,
+			Pods:   buildPodList(pod1namespacex),
+			Result: buildPodList(),
+		},
+		testStruct{
+			Policy: np1namespacex,
+			Pods:   buildPodList(pod1, pod1namespacex),
+			Result: buildPodList(pod1namespacex),
+		},
 	}
 
 	for i, test := range tests {
@@ -729,11 +739,11 @@ func TestIsPolicyApplicable(t *testing.T) {
 		resultEgress := IsPolicyApplicableToEgress(&test.Policy)
 
 		if resultIngress != test.ResultIngress {
-			t.Errorf("Ingress Selection error. Test %d Got %s expected %s ", i, resultIngress, test.ResultIngress)
+			t.Errorf("Ingress Selection error. Test %d Got %t expected %t ", i, resultIngress, test.ResultIngress)
 		}
 
 		if resultEgress != test.ResultEgress {
-			t.Errorf("Egress Selection error. Test %d Got %s expected %s ", i, resultEgress, test.ResultEgress)
+			t.Errorf("Egress Selection error. Test %d Got %t expected %t ", i, resultEgress, test.ResultEgress)
 		}
 	}
 }
@@ -821,17 +831,17 @@ func TestIsPodSelected(t *testing.T) {
 		}
 
 		if resultIngressCombined != test.ResultIngress {
-			t.Errorf("Ingress Combined Selection error. Test %d Got %s expected %s ", i, resultIngressCombined, test.ResultIngress)
+			t.Errorf("Ingress Combined Selection error. Test %d Got %t expected %t ", i, resultIngressCombined, test.ResultIngress)
 		}
 		if resultIngressDirect != test.ResultIngress {
-			t.Errorf("Ingress Direct Selection error. Test %d Got %s expected %s ", i, resultIngressDirect, test.ResultEgress)
+			t.Errorf("Ingress Direct Selection error. Test %d Got %t expected %t ", i, resultIngressDirect, test.ResultEgress)
 		}
 
 		if resultEgressCombined != test.ResultEgress {
-			t.Errorf("Egress Combined Selection error. Test %d Got %s expected %s ", i, resultEgressCombined, test.ResultIngress)
+			t.Errorf("Egress Combined Selection error. Test %d Got %t expected %t ", i, resultEgressCombined, test.ResultIngress)
 		}
 		if resultEgressDirect != test.ResultEgress {
-			t.Errorf("Egress Direct Selection error. Test %d Got %s expected %s ", i, resultEgressDirect, test.ResultEgress)
+			t.Errorf("Egress Direct Selection error. Test %d Got %t expected %t ", i, resultEgressDirect, test.ResultEgress)
 		}
 	}
 }
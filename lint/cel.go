@@ -0,0 +1,210 @@
+package lint
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/aporeto-inc/kubepox"
+	"github.com/aporeto-inc/kubepox/cluster"
+	"github.com/golang/protobuf/proto"
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker/decls"
+	"github.com/google/cel-go/common/types"
+
+	networking "k8s.io/api/networking/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// RuleConfig is a rule written as a CEL expression, that must evaluate to true for every policy:
+//
+//	rules:
+//	- id: team-label
+//	  description: Every policy must have a team label
+//	  severity: error
+//	  expression: has(policy.metadata.labels) && 'team' in policy.metadata.labels
+//	- id: prod-namespaces
+//	  description: Policies of production namespaces must not allow every namespace
+//	  expression: >
+//	    !('env' in ns.labels) || ns.labels['env'] != 'prod' || !has(policy.spec.ingress) ||
+//	    !policy.spec.ingress.exists(r, has(r.from) && r.from.exists(p, has(p.namespaceSelector) && p.namespaceSelector == {}))
+//
+// The expression is evaluated with the variables:
+//   - policy, the NetworkPolicy as it is written in JSON,
+//   - ns, the name and labels of the namespace of the policy, namespace being a reserved word of CEL,
+//   - pods, the name, namespace and labels of the pods selected by the policy.
+//
+// As in JSON, the fields that are not set are missing: has() tests their presence. Numbers are int when whole,
+// and ports are numbers or names: type(p.port) == int tests for a number.
+type RuleConfig struct {
+	ID          string   `json:"id"`
+	Description string   `json:"description,omitempty"`
+	Severity    Severity `json:"severity,omitempty"`
+	Expression  string   `json:"expression"`
+	// Message is the message of the findings, the description if not set.
+	Message string `json:"message,omitempty"`
+}
+
+// Config lists the custom rules.
+type Config struct {
+	Rules []RuleConfig `json:"rules"`
+}
+
+// LoadConfig loads a file of custom rules and compiles them.
+func LoadConfig(file string) ([]Rule, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	config := Config{}
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	rules, err := config.Compile()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	return rules, nil
+}
+
+// Compile compiles the custom rules. Their identifiers must be unique and differ from the built-in rules.
+func (c *Config) Compile() ([]Rule, error) {
+	env, err := cel.NewEnv(cel.Declarations(
+		decls.NewVar("policy", decls.NewMapType(decls.String, decls.Dyn)),
+		decls.NewVar("ns", decls.NewMapType(decls.String, decls.Dyn)),
+		decls.NewVar("pods", decls.NewListType(decls.NewMapType(decls.String, decls.Dyn))),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	builtin := map[string]bool{}
+	for _, rule := range Rules() {
+		builtin[rule.ID] = true
+	}
+	ids := map[string]bool{}
+	rules := []Rule{}
+	for _, config := range c.Rules {
+		if config.ID == "" {
+			return nil, fmt.Errorf("a rule has no id")
+		}
+		if builtin[config.ID] {
+			return nil, fmt.Errorf("rule %s collides with a built-in rule", config.ID)
+		}
+		if ids[config.ID] {
+			return nil, fmt.Errorf("rule %s is defined twice", config.ID)
+		}
+		ids[config.ID] = true
+
+		switch config.Severity {
+		case "":
+			config.Severity = SeverityWarning
+		case SeverityError, SeverityWarning:
+		default:
+			return nil, fmt.Errorf("rule %s: invalid severity %q", config.ID, config.Severity)
+		}
+
+		ast, issues := env.Compile(config.Expression)
+		if issues != nil && issues.Err() != nil {
+			return nil, fmt.Errorf("rule %s: %v", config.ID, issues.Err())
+		}
+		if !proto.Equal(ast.ResultType(), decls.Bool) && !proto.Equal(ast.ResultType(), decls.Dyn) {
+			return nil, fmt.Errorf("rule %s: the expression must evaluate to a bool", config.ID)
+		}
+		program, err := env.Program(ast)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %v", config.ID, err)
+		}
+
+		message := config.Message
+		if message == "" {
+			message = config.Description
+		}
+		if message == "" {
+			message = fmt.Sprintf("%s doesn't hold", config.Expression)
+		}
+		rules = append(rules, Rule{
+			ID:          config.ID,
+			Description: config.Description,
+			Severity:    config.Severity,
+			Check: func(policy *networking.NetworkPolicy, state *cluster.State) []string {
+				value, _, err := program.Eval(variables(policy, state))
+				if err != nil {
+					return []string{fmt.Sprintf("couldn't evaluate the rule: %v", err)}
+				}
+				if result, ok := value.(types.Bool); !ok {
+					return []string{fmt.Sprintf("couldn't evaluate the rule: got %v expected a bool", value)}
+				} else if !result {
+					return []string{message}
+				}
+				return nil
+			},
+		})
+	}
+	return rules, nil
+}
+
+// variables returns the variables of the CEL expressions for the policy.
+func variables(policy *networking.NetworkPolicy, state *cluster.State) map[string]interface{} {
+	namespace := map[string]interface{}{
+		"name":   policy.Namespace,
+		"labels": map[string]interface{}{},
+	}
+	pods := []interface{}{}
+	if state != nil {
+		if ns := state.Namespace(policy.Namespace); ns != nil {
+			namespace["labels"] = toJSON(ns.Labels)
+		}
+		if selected, err := kubepox.ListPodsPerPolicy(policy, &state.Pods); err == nil {
+			for _, pod := range selected.Items {
+				pods = append(pods, map[string]interface{}{
+					"name":      pod.Name,
+					"namespace": pod.Namespace,
+					"labels":    toJSON(pod.Labels),
+				})
+			}
+		}
+	}
+	return map[string]interface{}{
+		"policy": toJSON(policy),
+		"ns":     namespace,
+		"pods":   pods,
+	}
+}
+
+// toJSON returns an object as decoded from its JSON encoding: maps, lists, strings, numbers and bools,
+// which CEL evaluates natively. Whole numbers are int64, so that they compare with integer literals such
+// as 80, and the other numbers float64. A nil map is an empty map.
+func toJSON(obj interface{}) interface{} {
+	data, _ := json.Marshal(obj)
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	decoder.Decode(&value)
+	if value == nil {
+		return map[string]interface{}{}
+	}
+	return numbers(value)
+}
+
+// numbers replaces the json.Number values of a decoded JSON value with int64 or float64.
+func numbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = numbers(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = numbers(item)
+		}
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	}
+	return value
+}
@@ -0,0 +1,143 @@
+package lint
+
+import (
+	"testing"
+
+	"github.com/aporeto-inc/kubepox/cluster"
+
+	api "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestLoadConfig(t *testing.T) {
+	rules, err := LoadConfig("testdata/rules.yaml")
+	if err != nil {
+		t.Fatalf("Error loading rules: %s", err)
+	}
+
+	state := &cluster.State{
+		Namespaces: api.NamespaceList{
+			Items: []api.Namespace{
+				api.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "prod", Labels: map[string]string{"env": "prod"}}},
+				api.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "web"}},
+			},
+		},
+		Pods: api.PodList{
+			Items: []api.Pod{
+				api.Pod{ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "web", Labels: map[string]string{"role": "db"}}},
+				api.Pod{ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "prod", Labels: map[string]string{"role": "api"}}},
+			},
+		},
+	}
+
+	http, ssh, named := intstr.FromInt(80), intstr.FromInt(22), intstr.FromString("ssh")
+	allNamespaces := []networking.NetworkPolicyIngressRule{
+		networking.NetworkPolicyIngressRule{
+			From: []networking.NetworkPolicyPeer{
+				networking.NetworkPolicyPeer{NamespaceSelector: &metav1.LabelSelector{}},
+			},
+		},
+	}
+
+	type testStruct struct {
+		Policy networking.NetworkPolicy
+		Rules  []string
+	}
+
+	tests := []testStruct{
+		testStruct{
+			Policy: networking.NetworkPolicy{
+				ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "web", Labels: map[string]string{"team": "data"}},
+				Spec:       networking.NetworkPolicySpec{Ingress: allNamespaces},
+			},
+			Rules: []string{},
+		},
+		testStruct{
+			Policy: networking.NetworkPolicy{
+				ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "web"},
+			},
+			Rules: []string{"team-label"},
+		},
+		testStruct{
+			Policy: networking.NetworkPolicy{
+				ObjectMeta: metav1.ObjectMeta{Name: "open", Namespace: "prod", Labels: map[string]string{"team": "api"}},
+				Spec:       networking.NetworkPolicySpec{Ingress: allNamespaces},
+			},
+			Rules: []string{"prod-all-namespaces", "selects-db"},
+		},
+		testStruct{
+			Policy: networking.NetworkPolicy{
+				ObjectMeta: metav1.ObjectMeta{Name: "ssh", Namespace: "web", Labels: map[string]string{"team": "ops"}},
+				Spec: networking.NetworkPolicySpec{
+					Ingress: []networking.NetworkPolicyIngressRule{
+						networking.NetworkPolicyIngressRule{
+							Ports: []networking.NetworkPolicyPort{
+								networking.NetworkPolicyPort{Port: &http},
+								networking.NetworkPolicyPort{Port: &ssh},
+							},
+						},
+					},
+				},
+			},
+			Rules: []string{"no-ssh"},
+		},
+		testStruct{
+			Policy: networking.NetworkPolicy{
+				ObjectMeta: metav1.ObjectMeta{Name: "http", Namespace: "web", Labels: map[string]string{"team": "web"}},
+				Spec: networking.NetworkPolicySpec{
+					Ingress: []networking.NetworkPolicyIngressRule{
+						networking.NetworkPolicyIngressRule{
+							Ports: []networking.NetworkPolicyPort{
+								networking.NetworkPolicyPort{Port: &http},
+								networking.NetworkPolicyPort{Port: &named},
+							},
+						},
+					},
+				},
+			},
+			Rules: []string{},
+		},
+	}
+
+	for i, test := range tests {
+		t.Log("Testing LoadConfig ", i)
+		findings := Lint(&test.Policy, state, rules)
+		if len(findings) != len(test.Rules) {
+			t.Errorf("Test %d Got findings %+v expected %v", i, findings, test.Rules)
+			continue
+		}
+		for j, finding := range findings {
+			if finding.Rule != test.Rules[j] {
+				t.Errorf("Test %d Got finding %+v expected rule %s", i, finding, test.Rules[j])
+			}
+		}
+	}
+	if findings := Lint(&tests[2].Policy, state, rules); len(findings) == 2 && findings[1].Message != "the policy must select a database pod" {
+		t.Errorf("Got message %q expected the message of the rule", findings[1].Message)
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	type testStruct struct {
+		Rule RuleConfig
+	}
+
+	tests := []testStruct{
+		testStruct{Rule: RuleConfig{Expression: "true"}},
+		testStruct{Rule: RuleConfig{ID: RuleNoPodSelected, Expression: "true"}},
+		testStruct{Rule: RuleConfig{ID: "severity", Severity: "fatal", Expression: "true"}},
+		testStruct{Rule: RuleConfig{ID: "syntax", Expression: "policy.metadata.("}},
+		testStruct{Rule: RuleConfig{ID: "type", Expression: "size(pods)"}},
+		testStruct{Rule: RuleConfig{ID: "undeclared", Expression: "service.name == 'db'"}},
+	}
+
+	for i, test := range tests {
+		t.Log("Testing Compile ", i)
+		config := Config{Rules: []RuleConfig{test.Rule}}
+		if _, err := config.Compile(); err == nil {
+			t.Errorf("Test %d Compiled rule %+v expected an error", i, test.Rule)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+// Package lint checks NetworkPolicies for common mistakes.
+package lint
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/aporeto-inc/kubepox"
+	"github.com/aporeto-inc/kubepox/cluster"
+
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Severity is the importance of a Finding.
+type Severity string
+
+const (
+	// SeverityError is used for policies that don't behave as written.
+	SeverityError Severity = "error"
+	// SeverityWarning is used for policies that are valid but most likely not what was intended.
+	SeverityWarning Severity = "warning"
+)
+
+// Finding is a problem found on a NetworkPolicy.
+type Finding struct {
+	Rule      string   `json:"rule"`
+	Severity  Severity `json:"severity"`
+	Namespace string   `json:"namespace"`
+	Policy    string   `json:"policy"`
+	Message   string   `json:"message"`
+	// Location is the position of the policy in its manifest file, when it was loaded from one.
+	Location *cluster.Location `json:"location,omitempty"`
+}
+
+// Rule is a check run on every NetworkPolicy.
+type Rule struct {
+	ID          string
+	Description string
+	Severity    Severity
+	// Check returns one message per problem found on the policy.
+	// state holds the other objects of the cluster and can be used to resolve selectors.
+	Check func(policy *networking.NetworkPolicy, state *cluster.State) []string
+}
+
+// Rule identifiers of the built-in rules.
+const (
+	RuleInvalidSelector    = "invalid-selector"
+	RuleNoPodSelected      = "no-pod-selected"
+	RuleAllowAllNamespaces = "allow-all-namespaces"
+)
+
+// Rules returns the built-in rules.
+func Rules() []Rule {
+	return []Rule{
+		Rule{
+			ID:          RuleInvalidSelector,
+			Description: "Every label selector of the policy must be valid",
+			Severity:    SeverityError,
+			Check:       checkInvalidSelector,
+		},
+		Rule{
+			ID:          RuleNoPodSelected,
+			Description: "The podSelector of the policy should select at least one pod",
+			Severity:    SeverityWarning,
+			Check:       checkNoPodSelected,
+		},
+		Rule{
+			ID:          RuleAllowAllNamespaces,
+			Description: "Rules should not allow every pod of every namespace",
+			Severity:    SeverityWarning,
+			Check:       checkAllowAllNamespaces,
+		},
+	}
+}
+
+// Lint runs the rules on the policy. The built-in rules are used if rules is nil.
+// The findings are located in the manifest file of the policy if the state has its location.
+func Lint(policy *networking.NetworkPolicy, state *cluster.State, rules []Rule) []Finding {
+	if rules == nil {
+		rules = Rules()
+	}
+	var location *cluster.Location
+	if state != nil {
+		if l, ok := state.Locations[policy.Namespace+"/"+policy.Name]; ok {
+			location = &l
+		}
+	}
+	findings := []Finding{}
+	for _, rule := range rules {
+		for _, message := range rule.Check(policy, state) {
+			findings = append(findings, Finding{
+				Rule:      rule.ID,
+				Severity:  rule.Severity,
+				Namespace: policy.Namespace,
+				Policy:    policy.Name,
+				Message:   message,
+				Location:  location,
+			})
+		}
+	}
+	return findings
+}
+
+// LintAll runs the rules on every policy of the state, sorted by namespace and name.
+func LintAll(state *cluster.State, rules []Rule) []Finding {
+	policies := make([]*networking.NetworkPolicy, len(state.Policies.Items))
+	for i := range state.Policies.Items {
+		policies[i] = &state.Policies.Items[i]
+	}
+	sort.SliceStable(policies, func(i, j int) bool {
+		if policies[i].Namespace != policies[j].Namespace {
+			return policies[i].Namespace < policies[j].Namespace
+		}
+		return policies[i].Name < policies[j].Name
+	})
+
+	findings := []Finding{}
+	for _, policy := range policies {
+		findings = append(findings, Lint(policy, state, rules)...)
+	}
+	return findings
+}
+
+// HasErrors returns true if one of the findings has the error severity.
+func HasErrors(findings []Finding) bool {
+	for _, finding := range findings {
+		if finding.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// selectors returns every label selector of the policy with its location.
+func selectors(policy *networking.NetworkPolicy) map[string]*metav1.LabelSelector {
+	all := map[string]*metav1.LabelSelector{
+		"spec.podSelector": &policy.Spec.PodSelector,
+	}
+	addPeers := func(prefix string, peers []networking.NetworkPolicyPeer) {
+		for i, peer := range peers {
+			if peer.PodSelector != nil {
+				all[fmt.Sprintf("%s[%d].podSelector", prefix, i)] = peer.PodSelector
+			}
+			if peer.NamespaceSelector != nil {
+				all[fmt.Sprintf("%s[%d].namespaceSelector", prefix, i)] = peer.NamespaceSelector
+			}
+		}
+	}
+	for i, rule := range policy.Spec.Ingress {
+		addPeers(fmt.Sprintf("spec.ingress[%d].from", i), rule.From)
+	}
+	for i, rule := range policy.Spec.Egress {
+		addPeers(fmt.Sprintf("spec.egress[%d].to", i), rule.To)
+	}
+	return all
+}
+
+func checkInvalidSelector(policy *networking.NetworkPolicy, state *cluster.State) []string {
+	all := selectors(policy)
+	paths := make([]string, 0, len(all))
+	for path := range all {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	messages := []string{}
+	for _, path := range paths {
+		if _, err := metav1.LabelSelectorAsSelector(all[path]); err != nil {
+			messages = append(messages, fmt.Sprintf("%s is invalid: %v", path, err))
+		}
+	}
+	return messages
+}
+
+func checkNoPodSelected(policy *networking.NetworkPolicy, state *cluster.State) []string {
+	if state == nil {
+		return nil
+	}
+	pods, err := kubepox.ListPodsPerPolicy(policy, &state.Pods)
+	if err != nil {
+		// Reported by the invalid-selector rule.
+		return nil
+	}
+	if len(pods.Items) == 0 {
+		return []string{fmt.Sprintf("spec.podSelector doesn't select any pod in namespace %s", policy.Namespace)}
+	}
+	return nil
+}
+
+// isEmptySelector returns true for a selector matching everything.
+func isEmptySelector(selector *metav1.LabelSelector) bool {
+	return len(selector.MatchLabels) == 0 && len(selector.MatchExpressions) == 0
+}
+
+// allowsAllNamespaces returns true if a list of peers allows every pod of every namespace.
+func allowsAllNamespaces(peers []networking.NetworkPolicyPeer) bool {
+	if len(peers) == 0 {
+		return true
+	}
+	for _, peer := range peers {
+		if peer.NamespaceSelector != nil && isEmptySelector(peer.NamespaceSelector) &&
+			(peer.PodSelector == nil || isEmptySelector(peer.PodSelector)) {
+			return true
+		}
+	}
+	return false
+}
+
+func checkAllowAllNamespaces(policy *networking.NetworkPolicy, state *cluster.State) []string {
+	messages := []string{}
+	if kubepox.IsPolicyApplicableToIngress(policy) {
+		for i, rule := range policy.Spec.Ingress {
+			if allowsAllNamespaces(rule.From) {
+				messages = append(messages, fmt.Sprintf("spec.ingress[%d] allows all sources from all namespaces", i))
+			}
+		}
+	}
+	if kubepox.IsPolicyApplicableToEgress(policy) {
+		for i, rule := range policy.Spec.Egress {
+			if allowsAllNamespaces(rule.To) {
+				messages = append(messages, fmt.Sprintf("spec.egress[%d] allows all destinations in all namespaces", i))
+			}
+		}
+	}
+	return messages
+}
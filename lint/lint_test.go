@@ -0,0 +1,156 @@
+package lint
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/aporeto-inc/kubepox/cluster"
+
+	api "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var state = &cluster.State{
+	Pods: api.PodList{
+		Items: []api.Pod{
+			api.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "db",
+					Namespace: "default",
+					Labels: map[string]string{
+						"role": "db",
+					},
+				},
+			},
+		},
+	},
+}
+
+func TestLint(t *testing.T) {
+	type testStruct struct {
+		Policy networking.NetworkPolicy
+		Rules  []string
+	}
+
+	tests := []testStruct{
+		testStruct{
+			Policy: networking.NetworkPolicy{
+				ObjectMeta: metav1.ObjectMeta{Name: "fine", Namespace: "default"},
+				Spec: networking.NetworkPolicySpec{
+					PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"role": "db"}},
+				},
+			},
+			Rules: []string{},
+		},
+		testStruct{
+			Policy: networking.NetworkPolicy{
+				ObjectMeta: metav1.ObjectMeta{Name: "invalid", Namespace: "default"},
+				Spec: networking.NetworkPolicySpec{
+					Ingress: []networking.NetworkPolicyIngressRule{
+						networking.NetworkPolicyIngressRule{
+							From: []networking.NetworkPolicyPeer{
+								networking.NetworkPolicyPeer{
+									PodSelector: &metav1.LabelSelector{
+										MatchExpressions: []metav1.LabelSelectorRequirement{
+											metav1.LabelSelectorRequirement{Key: "role", Operator: "Bad"},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			Rules: []string{RuleInvalidSelector},
+		},
+		testStruct{
+			Policy: networking.NetworkPolicy{
+				ObjectMeta: metav1.ObjectMeta{Name: "nopod", Namespace: "other"},
+			},
+			Rules: []string{RuleNoPodSelected},
+		},
+		testStruct{
+			Policy: networking.NetworkPolicy{
+				ObjectMeta: metav1.ObjectMeta{Name: "allowall", Namespace: "default"},
+				Spec: networking.NetworkPolicySpec{
+					Ingress: []networking.NetworkPolicyIngressRule{
+						networking.NetworkPolicyIngressRule{},
+						networking.NetworkPolicyIngressRule{
+							From: []networking.NetworkPolicyPeer{
+								networking.NetworkPolicyPeer{
+									NamespaceSelector: &metav1.LabelSelector{},
+								},
+							},
+						},
+					},
+				},
+			},
+			Rules: []string{RuleAllowAllNamespaces, RuleAllowAllNamespaces},
+		},
+	}
+
+	for i, test := range tests {
+		t.Log("Testing Lint ", i)
+		findings := Lint(&test.Policy, state, nil)
+		if len(findings) != len(test.Rules) {
+			t.Errorf("Test %d Got findings %+v expected %v", i, findings, test.Rules)
+			continue
+		}
+		for j, finding := range findings {
+			if finding.Rule != test.Rules[j] {
+				t.Errorf("Test %d Got finding %+v expected rule %s", i, finding, test.Rules[j])
+			}
+		}
+	}
+}
+
+func TestWriteSARIF(t *testing.T) {
+	state, err := cluster.LoadManifests("testdata/policies.yaml")
+	if err != nil {
+		t.Fatalf("Error loading manifests: %s", err)
+	}
+	findings := LintAll(state, nil)
+
+	buffer := &bytes.Buffer{}
+	if err := WriteSARIF(buffer, findings, nil); err != nil {
+		t.Fatalf("Error writing SARIF: %s", err)
+	}
+	log := sarifLog{}
+	if err := json.Unmarshal(buffer.Bytes(), &log); err != nil {
+		t.Fatalf("Error decoding SARIF: %s", err)
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 {
+		t.Fatalf("Got SARIF log %+v expected version 2.1.0 with one run", log)
+	}
+	if len(log.Runs[0].Tool.Driver.Rules) != len(Rules()) {
+		t.Errorf("Got rules %+v expected the built-in rules", log.Runs[0].Tool.Driver.Rules)
+	}
+
+	type testStruct struct {
+		Rule string
+		Line int
+	}
+
+	tests := []testStruct{
+		testStruct{Rule: RuleAllowAllNamespaces, Line: 9},
+		testStruct{Rule: RuleNoPodSelected, Line: 22},
+	}
+
+	results := log.Runs[0].Results
+	if len(results) != len(tests) {
+		t.Fatalf("Got results %+v expected %d", results, len(tests))
+	}
+	for i, test := range tests {
+		t.Log("Testing WriteSARIF ", i)
+		result := results[i]
+		if result.RuleID != test.Rule || log.Runs[0].Tool.Driver.Rules[result.RuleIndex].ID != test.Rule {
+			t.Errorf("Test %d Got result %+v expected rule %s", i, result, test.Rule)
+		}
+		physical := result.Locations[0].PhysicalLocation
+		if physical == nil || physical.ArtifactLocation.URI != "testdata/policies.yaml" || physical.Region.StartLine != test.Line {
+			t.Errorf("Test %d Got location %+v expected testdata/policies.yaml:%d", i, physical, test.Line)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+// Package metrics exposes the policy posture of a cluster as Prometheus metrics.
+package metrics
+
+import (
+	"time"
+
+	"github.com/aporeto-inc/kubepox"
+	"github.com/aporeto-inc/kubepox/cluster"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "kubepox"
+
+var (
+	podsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "pods"),
+		"Number of pods whose traffic NetworkPolicies govern.",
+		[]string{"namespace"}, nil,
+	)
+	podsUnenforceableDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "pods_unenforceable"),
+		"Number of pods whose traffic NetworkPolicies don't govern, such as host network and terminated pods. They are left out of the other pod metrics.",
+		[]string{"namespace", "class"}, nil,
+	)
+	podsNotIsolatedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "pods_not_isolated"),
+		"Number of pods not selected by any policy applicable to the direction.",
+		[]string{"namespace", "direction"}, nil,
+	)
+	policiesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "policies"),
+		"Number of NetworkPolicies.",
+		[]string{"namespace"}, nil,
+	)
+	policiesSelectingNoPodsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "policies_selecting_no_pods"),
+		"Number of NetworkPolicies whose podSelector doesn't select any pod.",
+		[]string{"namespace"}, nil,
+	)
+	podRulesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "pod_rules"),
+		"Number of rules applied to a pod. Not reported for a direction where the pod is not isolated.",
+		[]string{"namespace", "pod", "direction"}, nil,
+	)
+	evaluationErrorsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "evaluation_errors"),
+		"1 if the last evaluation failed, 0 otherwise.",
+		nil, nil,
+	)
+)
+
+// Collector is a prometheus.Collector evaluating the State of a Source on every scrape.
+type Collector struct {
+	source   cluster.Source
+	podRules bool
+	duration prometheus.Histogram
+}
+
+// NewCollector returns a Collector for the State of the source. kubepox_pod_rules, labeled by pod, is only
+// collected with podRules, as it has a series per isolated pod.
+func NewCollector(source cluster.Source, podRules bool) *Collector {
+	return &Collector{
+		source:   source,
+		podRules: podRules,
+		duration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "evaluation_duration_seconds",
+			Help:      "Time spent evaluating the policies of the cluster.",
+			Buckets:   prometheus.ExponentialBuckets(0.001, 2, 15),
+		}),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- podsDesc
+	ch <- podsUnenforceableDesc
+	ch <- podsNotIsolatedDesc
+	ch <- policiesDesc
+	ch <- policiesSelectingNoPodsDesc
+	if c.podRules {
+		ch <- podRulesDesc
+	}
+	ch <- evaluationErrorsDesc
+	c.duration.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	start := time.Now()
+	metrics, err := c.evaluate()
+	c.duration.Observe(time.Since(start).Seconds())
+
+	if err != nil {
+		ch <- prometheus.MustNewConstMetric(evaluationErrorsDesc, prometheus.GaugeValue, 1)
+	} else {
+		ch <- prometheus.MustNewConstMetric(evaluationErrorsDesc, prometheus.GaugeValue, 0)
+		for _, metric := range metrics {
+			ch <- metric
+		}
+	}
+	c.duration.Collect(ch)
+}
+
+// namespaceCounts holds the counters of a namespace.
+type namespaceCounts struct {
+	pods                    int
+	unenforceable           map[kubepox.PodClass]int
+	ingressNotIsolated      int
+	egressNotIsolated       int
+	policies                int
+	policiesSelectingNoPods int
+}
+
+// evaluate computes all the metrics out of the current State.
+func (c *Collector) evaluate() ([]prometheus.Metric, error) {
+	state, err := c.source.State()
+	if err != nil {
+		return nil, err
+	}
+
+	metrics := []prometheus.Metric{}
+	counts := map[string]*namespaceCounts{}
+	countsOf := func(namespace string) *namespaceCounts {
+		if counts[namespace] == nil {
+			counts[namespace] = &namespaceCounts{unenforceable: map[kubepox.PodClass]int{}}
+		}
+		return counts[namespace]
+	}
+
+	for _, ns := range state.Namespaces.Items {
+		countsOf(ns.Name)
+	}
+
+	for i := range state.Pods.Items {
+		pod := &state.Pods.Items[i]
+		nsCounts := countsOf(pod.Namespace)
+		if kubepox.UnenforceablePods.Excludes(pod) {
+			nsCounts.unenforceable[kubepox.ClassifyPod(pod)]++
+			continue
+		}
+		nsCounts.pods++
+
+		ingress, egress, err := kubepox.IsPodSelected(pod, &state.Policies)
+		if err != nil {
+			return nil, err
+		}
+		if !ingress {
+			nsCounts.ingressNotIsolated++
+		}
+		if !egress {
+			nsCounts.egressNotIsolated++
+		}
+
+		if !c.podRules {
+			continue
+		}
+		ingressRules, err := kubepox.ListIngressRulesPerPod(pod, &state.Policies)
+		if err != nil {
+			return nil, err
+		}
+		if ingressRules != nil {
+			metrics = append(metrics, prometheus.MustNewConstMetric(podRulesDesc, prometheus.GaugeValue, float64(len(*ingressRules)), pod.Namespace, pod.Name, "ingress"))
+		}
+		egressRules, err := kubepox.ListEgressRulesPerPod(pod, &state.Policies)
+		if err != nil {
+			return nil, err
+		}
+		if egressRules != nil {
+			metrics = append(metrics, prometheus.MustNewConstMetric(podRulesDesc, prometheus.GaugeValue, float64(len(*egressRules)), pod.Namespace, pod.Name, "egress"))
+		}
+	}
+
+	for i := range state.Policies.Items {
+		policy := &state.Policies.Items[i]
+		nsCounts := countsOf(policy.Namespace)
+		nsCounts.policies++
+
+		pods, err := kubepox.ListPodsPerPolicy(policy, &state.Pods)
+		if err != nil {
+			return nil, err
+		}
+		if len(pods.Items) == 0 {
+			nsCounts.policiesSelectingNoPods++
+		}
+	}
+
+	for name, nsCounts := range counts {
+		metrics = append(metrics,
+			prometheus.MustNewConstMetric(podsDesc, prometheus.GaugeValue, float64(nsCounts.pods), name),
+			prometheus.MustNewConstMetric(podsNotIsolatedDesc, prometheus.GaugeValue, float64(nsCounts.ingressNotIsolated), name, "ingress"),
+			prometheus.MustNewConstMetric(podsNotIsolatedDesc, prometheus.GaugeValue, float64(nsCounts.egressNotIsolated), name, "egress"),
+			prometheus.MustNewConstMetric(policiesDesc, prometheus.GaugeValue, float64(nsCounts.policies), name),
+			prometheus.MustNewConstMetric(policiesSelectingNoPodsDesc, prometheus.GaugeValue, float64(nsCounts.policiesSelectingNoPods), name),
+		)
+		for class, count := range nsCounts.unenforceable {
+			metrics = append(metrics, prometheus.MustNewConstMetric(podsUnenforceableDesc, prometheus.GaugeValue, float64(count), name, string(class)))
+		}
+	}
+
+	return metrics, nil
+}
@@ -0,0 +1,131 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aporeto-inc/kubepox/cluster"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+const manifests = `
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: empty
+---
+apiVersion: v1
+kind: Pod
+metadata:
+  name: frontend
+  namespace: web
+  labels:
+    role: frontend
+---
+apiVersion: v1
+kind: Pod
+metadata:
+  name: db
+  namespace: web
+  labels:
+    role: db
+---
+apiVersion: v1
+kind: Pod
+metadata:
+  name: node-exporter
+  namespace: web
+spec:
+  hostNetwork: true
+---
+apiVersion: v1
+kind: Pod
+metadata:
+  name: migration
+  namespace: web
+  labels:
+    role: db
+status:
+  phase: Succeeded
+---
+apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: db
+  namespace: web
+spec:
+  podSelector:
+    matchLabels:
+      role: db
+  ingress:
+  - from:
+    - podSelector:
+        matchLabels:
+          role: frontend
+---
+apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: nothing
+  namespace: web
+spec:
+  podSelector:
+    matchLabels:
+      role: nothing
+  policyTypes:
+  - Egress
+`
+
+const expected = `
+# HELP kubepox_pod_rules Number of rules applied to a pod. Not reported for a direction where the pod is not isolated.
+# TYPE kubepox_pod_rules gauge
+kubepox_pod_rules{direction="ingress",namespace="web",pod="db"} 1
+# HELP kubepox_pods Number of pods whose traffic NetworkPolicies govern.
+# TYPE kubepox_pods gauge
+kubepox_pods{namespace="empty"} 0
+kubepox_pods{namespace="web"} 2
+# HELP kubepox_pods_unenforceable Number of pods whose traffic NetworkPolicies don't govern, such as host network and terminated pods. They are left out of the other pod metrics.
+# TYPE kubepox_pods_unenforceable gauge
+kubepox_pods_unenforceable{class="host-network",namespace="web"} 1
+kubepox_pods_unenforceable{class="terminated",namespace="web"} 1
+# HELP kubepox_pods_not_isolated Number of pods not selected by any policy applicable to the direction.
+# TYPE kubepox_pods_not_isolated gauge
+kubepox_pods_not_isolated{direction="egress",namespace="empty"} 0
+kubepox_pods_not_isolated{direction="egress",namespace="web"} 2
+kubepox_pods_not_isolated{direction="ingress",namespace="empty"} 0
+kubepox_pods_not_isolated{direction="ingress",namespace="web"} 1
+# HELP kubepox_policies_selecting_no_pods Number of NetworkPolicies whose podSelector doesn't select any pod.
+# TYPE kubepox_policies_selecting_no_pods gauge
+kubepox_policies_selecting_no_pods{namespace="empty"} 0
+kubepox_policies_selecting_no_pods{namespace="web"} 1
+`
+
+func TestCollector(t *testing.T) {
+	state := &cluster.State{}
+	if err := state.AddManifest([]byte(manifests)); err != nil {
+		t.Fatalf("Error loading manifests: %s", err)
+	}
+
+	collector := NewCollector(cluster.NewStaticSource(state), true)
+	err := testutil.CollectAndCompare(collector, strings.NewReader(expected),
+		"kubepox_pod_rules", "kubepox_pods", "kubepox_pods_unenforceable", "kubepox_pods_not_isolated", "kubepox_policies_selecting_no_pods")
+	if err != nil {
+		t.Errorf("Unexpected metrics: %s", err)
+	}
+}
+
+func TestCollectorWithoutPodRules(t *testing.T) {
+	state := &cluster.State{}
+	if err := state.AddManifest([]byte(manifests)); err != nil {
+		t.Fatalf("Error loading manifests: %s", err)
+	}
+
+	collector := NewCollector(cluster.NewStaticSource(state), false)
+	if count := testutil.CollectAndCount(collector, "kubepox_pod_rules"); count != 0 {
+		t.Errorf("Got %d kubepox_pod_rules series expected none", count)
+	}
+	if count := testutil.CollectAndCount(collector, "kubepox_pods_not_isolated"); count != 4 {
+		t.Errorf("Got %d kubepox_pods_not_isolated series expected 4", count)
+	}
+}
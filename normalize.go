@@ -0,0 +1,482 @@
+package kubepox
+
+import (
+	"net"
+	"sort"
+	"strings"
+
+	api "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// IngressRule is a normalized IngressRule with the names of the policies it comes from.
+type IngressRule struct {
+	networking.NetworkPolicyIngressRule
+	Policies []string `json:"policies"`
+}
+
+// EgressRule is a normalized EgressRule with the names of the policies it comes from.
+type EgressRule struct {
+	networking.NetworkPolicyEgressRule
+	Policies []string `json:"policies"`
+}
+
+// ListNormalizedIngressRulesPerPod returns the IngressRules that apply to the pod, as ListIngressRulesPerPod, once normalized.
+// returns nil if the policies in parameters are not applicable to Ingress
+func ListNormalizedIngressRulesPerPod(pod *api.Pod, allPolicies *networking.NetworkPolicyList) (*[]IngressRule, error) {
+	matchedPolicies, err := ListPoliciesPerPod(pod, allPolicies)
+	if err != nil {
+		return nil, err
+	}
+	return NormalizeIngressRules(matchedPolicies)
+}
+
+// ListNormalizedEgressRulesPerPod returns the EgressRules that apply to the pod, as ListEgressRulesPerPod, once normalized.
+// returns nil if the policies in parameters are not applicable to Egress
+func ListNormalizedEgressRulesPerPod(pod *api.Pod, allPolicies *networking.NetworkPolicyList) (*[]EgressRule, error) {
+	matchedPolicies, err := ListPoliciesPerPod(pod, allPolicies)
+	if err != nil {
+		return nil, err
+	}
+	return NormalizeEgressRules(matchedPolicies)
+}
+
+// NormalizeIngressRules returns the union of the IngressRules of the policies, all selecting the same pod, normalized:
+// selectors are canonicalized, rules with identical peers or identical ports are merged and rules subsumed by
+// broader ones are removed. The policies of a rule are the policies whose rules it represents.
+// returns nil if the policies in parameters are not applicable to Ingress
+func NormalizeIngressRules(policies *networking.NetworkPolicyList) (*[]IngressRule, error) {
+	rules := []*normalRule{}
+	applicable := false
+	for _, policy := range policies.Items {
+		if !IsPolicyApplicableToIngress(&policy) {
+			continue
+		}
+		applicable = true
+		for _, rule := range policy.Spec.Ingress {
+			normal, err := newNormalRule(rule.From, rule.Ports, policy.Name)
+			if err != nil {
+				return nil, err
+			}
+			rules = append(rules, normal)
+		}
+	}
+	if !applicable {
+		return nil, nil
+	}
+
+	ingressRules := []IngressRule{}
+	for _, rule := range normalizeRules(rules) {
+		ingressRules = append(ingressRules, IngressRule{
+			NetworkPolicyIngressRule: networking.NetworkPolicyIngressRule{
+				From:  rule.peers,
+				Ports: rule.ports,
+			},
+			Policies: rule.policies,
+		})
+	}
+	return &ingressRules, nil
+}
+
+// NormalizeEgressRules returns the union of the EgressRules of the policies, normalized as NormalizeIngressRules.
+// returns nil if the policies in parameters are not applicable to Egress
+func NormalizeEgressRules(policies *networking.NetworkPolicyList) (*[]EgressRule, error) {
+	rules := []*normalRule{}
+	applicable := false
+	for _, policy := range policies.Items {
+		if !IsPolicyApplicableToEgress(&policy) {
+			continue
+		}
+		applicable = true
+		for _, rule := range policy.Spec.Egress {
+			normal, err := newNormalRule(rule.To, rule.Ports, policy.Name)
+			if err != nil {
+				return nil, err
+			}
+			rules = append(rules, normal)
+		}
+	}
+	if !applicable {
+		return nil, nil
+	}
+
+	egressRules := []EgressRule{}
+	for _, rule := range normalizeRules(rules) {
+		egressRules = append(egressRules, EgressRule{
+			NetworkPolicyEgressRule: networking.NetworkPolicyEgressRule{
+				To:    rule.peers,
+				Ports: rule.ports,
+			},
+			Policies: rule.policies,
+		})
+	}
+	return &egressRules, nil
+}
+
+// normalRule is a rule of either direction being normalized. No peer means all peers, no port means all ports.
+type normalRule struct {
+	peers    []networking.NetworkPolicyPeer
+	ports    []networking.NetworkPolicyPort
+	policies []string
+}
+
+// newNormalRule canonicalizes the peers and ports of a rule.
+func newNormalRule(peers []networking.NetworkPolicyPeer, ports []networking.NetworkPolicyPort, policy string) (*normalRule, error) {
+	rule := &normalRule{
+		policies: []string{policy},
+	}
+	for _, peer := range peers {
+		canonical, err := canonicalPeer(&peer)
+		if err != nil {
+			return nil, err
+		}
+		rule.peers = append(rule.peers, canonical)
+	}
+	for _, port := range ports {
+		rule.ports = append(rule.ports, canonicalPort(&port))
+	}
+	rule.peers = reducePeers(rule.peers)
+	rule.ports = reducePorts(rule.ports)
+	return rule, nil
+}
+
+// normalizeRules merges the rules with identical peers or ports, until no rule can be merged, then removes
+// the rules subsumed by another one.
+func normalizeRules(rules []*normalRule) []*normalRule {
+	for merged := true; merged; {
+		merged = false
+		for i := 0; i < len(rules) && !merged; i++ {
+			for j := i + 1; j < len(rules) && !merged; j++ {
+				a, b := rules[i], rules[j]
+				switch {
+				case peersKey(a.peers) == peersKey(b.peers):
+					a.ports = unionPorts(a.ports, b.ports)
+				case portsKey(a.ports) == portsKey(b.ports):
+					a.peers = unionPeers(a.peers, b.peers)
+				default:
+					continue
+				}
+				a.policies = unionStrings(a.policies, b.policies)
+				rules = append(rules[:j], rules[j+1:]...)
+				merged = true
+			}
+		}
+	}
+
+	removed := make([]bool, len(rules))
+	for i, rule := range rules {
+		for j, broader := range rules {
+			if i == j || removed[j] || !ruleCovers(broader, rule) {
+				continue
+			}
+			broader.policies = unionStrings(broader.policies, rule.policies)
+			removed[i] = true
+			break
+		}
+	}
+
+	normalized := []*normalRule{}
+	for i, rule := range rules {
+		if !removed[i] {
+			normalized = append(normalized, rule)
+		}
+	}
+	return normalized
+}
+
+// canonicalSelector returns an equivalent selector where single value In expressions are turned into matchLabels,
+// redundant expressions are removed and expressions and values are sorted.
+func canonicalSelector(selector *metav1.LabelSelector) (*metav1.LabelSelector, error) {
+	if selector == nil {
+		return nil, nil
+	}
+	if _, err := metav1.LabelSelectorAsSelector(selector); err != nil {
+		return nil, err
+	}
+
+	matchLabels := map[string]string{}
+	for k, v := range selector.MatchLabels {
+		matchLabels[k] = v
+	}
+	expressions := []metav1.LabelSelectorRequirement{}
+	for _, expression := range selector.MatchExpressions {
+		values := unionStrings(nil, expression.Values)
+		value, labeled := matchLabels[expression.Key]
+		switch {
+		case expression.Operator == metav1.LabelSelectorOpIn && len(values) == 1 && !labeled:
+			matchLabels[expression.Key] = values[0]
+			continue
+		case expression.Operator == metav1.LabelSelectorOpIn && len(values) == 1 && value == values[0]:
+			continue
+		case expression.Operator == metav1.LabelSelectorOpExists && labeled:
+			continue
+		}
+		expressions = append(expressions, metav1.LabelSelectorRequirement{
+			Key:      expression.Key,
+			Operator: expression.Operator,
+			Values:   values,
+		})
+	}
+	sort.Slice(expressions, func(i, j int) bool {
+		return requirementKey(&expressions[i]) < requirementKey(&expressions[j])
+	})
+
+	canonical := &metav1.LabelSelector{}
+	if len(matchLabels) > 0 {
+		canonical.MatchLabels = matchLabels
+	}
+	for i, expression := range expressions {
+		if i > 0 && requirementKey(&expression) == requirementKey(&expressions[i-1]) {
+			continue
+		}
+		canonical.MatchExpressions = append(canonical.MatchExpressions, expression)
+	}
+	return canonical, nil
+}
+
+func requirementKey(requirement *metav1.LabelSelectorRequirement) string {
+	return requirement.Key + " " + string(requirement.Operator) + " " + strings.Join(requirement.Values, ",")
+}
+
+// selectorKey returns a string identifying the selector. A nil selector is distinct from an empty one.
+func selectorKey(selector *metav1.LabelSelector) string {
+	if selector == nil {
+		return "<nil>"
+	}
+	s, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return "<invalid>"
+	}
+	return "{" + s.String() + "}"
+}
+
+func isEmptySelector(selector *metav1.LabelSelector) bool {
+	return selector != nil && len(selector.MatchLabels) == 0 && len(selector.MatchExpressions) == 0
+}
+
+// canonicalPeer canonicalizes the selectors of the peer. An empty podSelector along with a namespaceSelector
+// is removed, as it doesn't restrict the pods of the namespaces.
+func canonicalPeer(peer *networking.NetworkPolicyPeer) (networking.NetworkPolicyPeer, error) {
+	canonical := networking.NetworkPolicyPeer{}
+	var err error
+	if canonical.PodSelector, err = canonicalSelector(peer.PodSelector); err != nil {
+		return canonical, err
+	}
+	if canonical.NamespaceSelector, err = canonicalSelector(peer.NamespaceSelector); err != nil {
+		return canonical, err
+	}
+	if canonical.NamespaceSelector != nil && isEmptySelector(canonical.PodSelector) {
+		canonical.PodSelector = nil
+	}
+	if peer.IPBlock != nil {
+		canonical.IPBlock = &networking.IPBlock{
+			CIDR:   peer.IPBlock.CIDR,
+			Except: unionStrings(nil, peer.IPBlock.Except),
+		}
+	}
+	return canonical, nil
+}
+
+func peerKey(peer *networking.NetworkPolicyPeer) string {
+	if peer.IPBlock != nil {
+		return "ipBlock " + peer.IPBlock.CIDR + " except " + strings.Join(peer.IPBlock.Except, ",")
+	}
+	return "namespaces " + selectorKey(peer.NamespaceSelector) + " pods " + selectorKey(peer.PodSelector)
+}
+
+// peerCovers returns true if every endpoint matched by peer a is matched by peer b.
+func peerCovers(b, a *networking.NetworkPolicyPeer) bool {
+	if peerKey(a) == peerKey(b) {
+		return true
+	}
+	if a.IPBlock != nil || b.IPBlock != nil {
+		return a.IPBlock != nil && b.IPBlock != nil && len(b.IPBlock.Except) == 0 && cidrContains(b.IPBlock.CIDR, a.IPBlock.CIDR)
+	}
+
+	if b.NamespaceSelector == nil {
+		// Every pod of the namespace of the policy.
+		return a.NamespaceSelector == nil && isEmptySelector(b.PodSelector)
+	}
+	if isEmptySelector(b.NamespaceSelector) && selectorKey(a.PodSelector) == selectorKey(b.PodSelector) {
+		// The same pods in every namespace.
+		return true
+	}
+	// Every pod of the namespaces.
+	return b.PodSelector == nil && (isEmptySelector(b.NamespaceSelector) || selectorKey(a.NamespaceSelector) == selectorKey(b.NamespaceSelector))
+}
+
+// cidrContains returns true if the network b is within the network a.
+func cidrContains(a, b string) bool {
+	_, networkA, err := net.ParseCIDR(a)
+	if err != nil {
+		return false
+	}
+	_, networkB, err := net.ParseCIDR(b)
+	if err != nil {
+		return false
+	}
+	onesA, bitsA := networkA.Mask.Size()
+	onesB, bitsB := networkB.Mask.Size()
+	return bitsA == bitsB && onesA <= onesB && networkA.Contains(networkB.IP)
+}
+
+// canonicalPort sets the protocol of the port explicitly.
+func canonicalPort(port *networking.NetworkPolicyPort) networking.NetworkPolicyPort {
+	protocol := api.ProtocolTCP
+	if port.Protocol != nil {
+		protocol = *port.Protocol
+	}
+	return networking.NetworkPolicyPort{
+		Protocol: &protocol,
+		Port:     port.Port,
+	}
+}
+
+func portKey(port *networking.NetworkPolicyPort) string {
+	if port.Port == nil {
+		return string(*port.Protocol) + "/*"
+	}
+	return string(*port.Protocol) + "/" + port.Port.String()
+}
+
+// portCovers returns true if port b allows the traffic allowed by port a.
+func portCovers(b, a *networking.NetworkPolicyPort) bool {
+	return *a.Protocol == *b.Protocol && (b.Port == nil || portKey(a) == portKey(b))
+}
+
+// reducePeers removes the peers covered by another peer and sorts them.
+func reducePeers(peers []networking.NetworkPolicyPeer) []networking.NetworkPolicyPeer {
+	sort.SliceStable(peers, func(i, j int) bool {
+		return peerKey(&peers[i]) < peerKey(&peers[j])
+	})
+	reduced := []networking.NetworkPolicyPeer{}
+	for i := range peers {
+		covered := false
+		for j := range peers {
+			if i != j && peerCovers(&peers[j], &peers[i]) && (peerKey(&peers[i]) != peerKey(&peers[j]) || j < i) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			reduced = append(reduced, peers[i])
+		}
+	}
+	if len(reduced) == 0 {
+		return nil
+	}
+	return reduced
+}
+
+// reducePorts removes the ports covered by another port and sorts them.
+func reducePorts(ports []networking.NetworkPolicyPort) []networking.NetworkPolicyPort {
+	sort.SliceStable(ports, func(i, j int) bool {
+		return portKey(&ports[i]) < portKey(&ports[j])
+	})
+	reduced := []networking.NetworkPolicyPort{}
+	for i := range ports {
+		covered := false
+		for j := range ports {
+			if i != j && portCovers(&ports[j], &ports[i]) && (portKey(&ports[i]) != portKey(&ports[j]) || j < i) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			reduced = append(reduced, ports[i])
+		}
+	}
+	if len(reduced) == 0 {
+		return nil
+	}
+	return reduced
+}
+
+func peersKey(peers []networking.NetworkPolicyPeer) string {
+	keys := []string{}
+	for i := range peers {
+		keys = append(keys, peerKey(&peers[i]))
+	}
+	return strings.Join(keys, ";")
+}
+
+func portsKey(ports []networking.NetworkPolicyPort) string {
+	keys := []string{}
+	for i := range ports {
+		keys = append(keys, portKey(&ports[i]))
+	}
+	return strings.Join(keys, ";")
+}
+
+// unionPeers returns the peers of both lists. No peer means all peers.
+func unionPeers(a, b []networking.NetworkPolicyPeer) []networking.NetworkPolicyPeer {
+	if len(a) == 0 || len(b) == 0 {
+		return nil
+	}
+	return reducePeers(append(append([]networking.NetworkPolicyPeer{}, a...), b...))
+}
+
+// unionPorts returns the ports of both lists. No port means all ports.
+func unionPorts(a, b []networking.NetworkPolicyPort) []networking.NetworkPolicyPort {
+	if len(a) == 0 || len(b) == 0 {
+		return nil
+	}
+	return reducePorts(append(append([]networking.NetworkPolicyPort{}, a...), b...))
+}
+
+// ruleCovers returns true if rule b allows all the traffic allowed by rule a.
+func ruleCovers(b, a *normalRule) bool {
+	if len(b.peers) > 0 {
+		if len(a.peers) == 0 {
+			return false
+		}
+		for i := range a.peers {
+			covered := false
+			for j := range b.peers {
+				if peerCovers(&b.peers[j], &a.peers[i]) {
+					covered = true
+					break
+				}
+			}
+			if !covered {
+				return false
+			}
+		}
+	}
+	if len(b.ports) > 0 {
+		if len(a.ports) == 0 {
+			return false
+		}
+		for i := range a.ports {
+			covered := false
+			for j := range b.ports {
+				if portCovers(&b.ports[j], &a.ports[i]) {
+					covered = true
+					break
+				}
+			}
+			if !covered {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// unionStrings returns the sorted strings of both lists, without duplicates. It returns nil if both are empty.
+func unionStrings(a, b []string) []string {
+	if len(a) == 0 && len(b) == 0 {
+		return nil
+	}
+	set := map[string]bool{}
+	for _, s := range append(append([]string{}, a...), b...) {
+		set[s] = true
+	}
+	union := []string{}
+	for s := range set {
+		union = append(union, s)
+	}
+	sort.Strings(union)
+	return union
+}
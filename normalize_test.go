@@ -0,0 +1,192 @@
+package kubepox
+
+import (
+	"reflect"
+	"testing"
+
+	api "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func ingressPolicy(name string, rules ...networking.NetworkPolicyIngressRule) networking.NetworkPolicy {
+	return networking.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: networking.NetworkPolicySpec{
+			PolicyTypes: []networking.PolicyType{networking.PolicyTypeIngress},
+			Ingress:     rules,
+		},
+	}
+}
+
+func podPeer(labels map[string]string) networking.NetworkPolicyPeer {
+	return networking.NetworkPolicyPeer{PodSelector: &metav1.LabelSelector{MatchLabels: labels}}
+}
+
+func cidrPeer(cidr string) networking.NetworkPolicyPeer {
+	return networking.NetworkPolicyPeer{IPBlock: &networking.IPBlock{CIDR: cidr}}
+}
+
+func tcpPort(port int) networking.NetworkPolicyPort {
+	protocol := api.ProtocolTCP
+	p := intstr.FromInt(port)
+	return networking.NetworkPolicyPort{Protocol: &protocol, Port: &p}
+}
+
+func TestNormalizeIngressRules(t *testing.T) {
+	webPeer := podPeer(map[string]string{"app": "web"})
+	apiPeer := podPeer(map[string]string{"app": "api"})
+	webIn := networking.NetworkPolicyPeer{
+		PodSelector: &metav1.LabelSelector{
+			MatchExpressions: []metav1.LabelSelectorRequirement{
+				metav1.LabelSelectorRequirement{Key: "app", Operator: metav1.LabelSelectorOpIn, Values: []string{"web"}},
+			},
+		},
+	}
+	allPods := podPeer(nil)
+	port80 := intstr.FromInt(80)
+	implicitTCP80 := networking.NetworkPolicyPort{Port: &port80}
+
+	type testStruct struct {
+		description string
+		policies    networking.NetworkPolicyList
+		expected    []IngressRule
+	}
+
+	tests := []testStruct{
+		testStruct{
+			description: "canonicalized duplicates",
+			policies: buildNetworkPolicyList(
+				ingressPolicy("a", networking.NetworkPolicyIngressRule{From: []networking.NetworkPolicyPeer{webPeer}, Ports: []networking.NetworkPolicyPort{tcpPort(80)}}),
+				ingressPolicy("b", networking.NetworkPolicyIngressRule{From: []networking.NetworkPolicyPeer{webIn}, Ports: []networking.NetworkPolicyPort{implicitTCP80}}),
+			),
+			expected: []IngressRule{
+				IngressRule{
+					NetworkPolicyIngressRule: networking.NetworkPolicyIngressRule{From: []networking.NetworkPolicyPeer{webPeer}, Ports: []networking.NetworkPolicyPort{tcpPort(80)}},
+					Policies:                 []string{"a", "b"},
+				},
+			},
+		},
+		testStruct{
+			description: "identical peers",
+			policies: buildNetworkPolicyList(
+				ingressPolicy("a", networking.NetworkPolicyIngressRule{From: []networking.NetworkPolicyPeer{webPeer}, Ports: []networking.NetworkPolicyPort{tcpPort(80)}}),
+				ingressPolicy("b", networking.NetworkPolicyIngressRule{From: []networking.NetworkPolicyPeer{webPeer}, Ports: []networking.NetworkPolicyPort{tcpPort(443)}}),
+			),
+			expected: []IngressRule{
+				IngressRule{
+					NetworkPolicyIngressRule: networking.NetworkPolicyIngressRule{From: []networking.NetworkPolicyPeer{webPeer}, Ports: []networking.NetworkPolicyPort{tcpPort(443), tcpPort(80)}},
+					Policies:                 []string{"a", "b"},
+				},
+			},
+		},
+		testStruct{
+			description: "identical ports",
+			policies: buildNetworkPolicyList(
+				ingressPolicy("a",
+					networking.NetworkPolicyIngressRule{From: []networking.NetworkPolicyPeer{webPeer}, Ports: []networking.NetworkPolicyPort{tcpPort(80)}},
+					networking.NetworkPolicyIngressRule{From: []networking.NetworkPolicyPeer{apiPeer}, Ports: []networking.NetworkPolicyPort{tcpPort(80)}},
+				),
+			),
+			expected: []IngressRule{
+				IngressRule{
+					NetworkPolicyIngressRule: networking.NetworkPolicyIngressRule{From: []networking.NetworkPolicyPeer{apiPeer, webPeer}, Ports: []networking.NetworkPolicyPort{tcpPort(80)}},
+					Policies:                 []string{"a"},
+				},
+			},
+		},
+		testStruct{
+			description: "subsumed by all the pods of the namespace on all ports",
+			policies: buildNetworkPolicyList(
+				ingressPolicy("a", networking.NetworkPolicyIngressRule{From: []networking.NetworkPolicyPeer{webPeer}, Ports: []networking.NetworkPolicyPort{tcpPort(80)}}),
+				ingressPolicy("b", networking.NetworkPolicyIngressRule{From: []networking.NetworkPolicyPeer{allPods}}),
+			),
+			expected: []IngressRule{
+				IngressRule{
+					NetworkPolicyIngressRule: networking.NetworkPolicyIngressRule{From: []networking.NetworkPolicyPeer{podPeer(nil)}},
+					Policies:                 []string{"a", "b"},
+				},
+			},
+		},
+		testStruct{
+			description: "ipBlock within a broader one",
+			policies: buildNetworkPolicyList(
+				ingressPolicy("a", networking.NetworkPolicyIngressRule{From: []networking.NetworkPolicyPeer{cidrPeer("10.0.0.0/24")}, Ports: []networking.NetworkPolicyPort{tcpPort(80)}}),
+				ingressPolicy("b", networking.NetworkPolicyIngressRule{From: []networking.NetworkPolicyPeer{cidrPeer("10.0.0.0/8")}, Ports: []networking.NetworkPolicyPort{tcpPort(80), tcpPort(443)}}),
+			),
+			expected: []IngressRule{
+				IngressRule{
+					NetworkPolicyIngressRule: networking.NetworkPolicyIngressRule{From: []networking.NetworkPolicyPeer{cidrPeer("10.0.0.0/8")}, Ports: []networking.NetworkPolicyPort{tcpPort(443), tcpPort(80)}},
+					Policies:                 []string{"a", "b"},
+				},
+			},
+		},
+		testStruct{
+			description: "distinct rules",
+			policies: buildNetworkPolicyList(
+				ingressPolicy("a", networking.NetworkPolicyIngressRule{From: []networking.NetworkPolicyPeer{webPeer}, Ports: []networking.NetworkPolicyPort{tcpPort(80)}}),
+				ingressPolicy("b", networking.NetworkPolicyIngressRule{From: []networking.NetworkPolicyPeer{apiPeer}, Ports: []networking.NetworkPolicyPort{tcpPort(443)}}),
+			),
+			expected: []IngressRule{
+				IngressRule{
+					NetworkPolicyIngressRule: networking.NetworkPolicyIngressRule{From: []networking.NetworkPolicyPeer{webPeer}, Ports: []networking.NetworkPolicyPort{tcpPort(80)}},
+					Policies:                 []string{"a"},
+				},
+				IngressRule{
+					NetworkPolicyIngressRule: networking.NetworkPolicyIngressRule{From: []networking.NetworkPolicyPeer{apiPeer}, Ports: []networking.NetworkPolicyPort{tcpPort(443)}},
+					Policies:                 []string{"b"},
+				},
+			},
+		},
+		testStruct{
+			description: "isolated without rules",
+			policies:    buildNetworkPolicyList(defaultdenyingress),
+			expected:    []IngressRule{},
+		},
+	}
+
+	for i, test := range tests {
+		t.Log("Testing NormalizeIngressRules ", i)
+		rules, err := NormalizeIngressRules(&test.policies)
+		if err != nil {
+			t.Errorf("Error normalizing %s: %s", test.description, err)
+			continue
+		}
+		if rules == nil || !reflect.DeepEqual(*rules, test.expected) {
+			t.Errorf("Normalizing %s: got %+v expected %+v", test.description, rules, test.expected)
+		}
+	}
+}
+
+func TestNormalizeEgressRules(t *testing.T) {
+	policies := buildNetworkPolicyList(defaultallowingress)
+	rules, err := NormalizeEgressRules(&policies)
+	if err != nil || rules != nil {
+		t.Errorf("Got %+v, %v expected nil for a policy not applicable to egress", rules, err)
+	}
+
+	egress := defaultallowegress.DeepCopy()
+	egress.Spec.Egress = append(egress.Spec.Egress, networking.NetworkPolicyEgressRule{
+		To:    []networking.NetworkPolicyPeer{cidrPeer("10.0.0.0/8")},
+		Ports: []networking.NetworkPolicyPort{tcpPort(53)},
+	})
+	policies = buildNetworkPolicyList(*egress)
+	rules, err = NormalizeEgressRules(&policies)
+	if err != nil {
+		t.Fatalf("Error normalizing: %s", err)
+	}
+	if rules == nil || len(*rules) != 1 || len((*rules)[0].To) != 0 || len((*rules)[0].Ports) != 0 {
+		t.Errorf("Got %+v expected a single rule allowing everything", rules)
+	}
+}
+
+func TestListNormalizedIngressRulesPerPod(t *testing.T) {
+	policies := buildNetworkPolicyList(np1, np2, np3)
+	pod := pod1.DeepCopy()
+	pod.Namespace = "other"
+	rules, err := ListNormalizedIngressRulesPerPod(pod, &policies)
+	if err != nil || rules != nil {
+		t.Errorf("Got %+v, %v expected nil for a pod not selected", rules, err)
+	}
+}
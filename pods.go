@@ -0,0 +1,105 @@
+package kubepox
+
+import (
+	api "k8s.io/api/core/v1"
+)
+
+// PodClass classifies a pod by how NetworkPolicies apply to it.
+type PodClass string
+
+// Classes of pods.
+const (
+	// PodEnforced is a running pod with an IP, whose traffic is governed by NetworkPolicies.
+	PodEnforced PodClass = "enforced"
+	// PodHostNetwork is a pod using the network of its node. NetworkPolicies don't apply to it and
+	// its traffic can't be told apart from the traffic of the node.
+	PodHostNetwork PodClass = "host-network"
+	// PodTerminated is a pod whose containers have all terminated (Succeeded or Failed). It has no traffic.
+	PodTerminated PodClass = "terminated"
+	// PodWithoutIP is a pod that didn't get an IP yet. NetworkPolicies apply to it once it starts,
+	// but ipBlocks can't match it until then.
+	PodWithoutIP PodClass = "no-ip"
+)
+
+// ClassifyPod returns the class of a pod.
+func ClassifyPod(pod *api.Pod) PodClass {
+	switch {
+	case pod.Spec.HostNetwork:
+		return PodHostNetwork
+	case pod.Status.Phase == api.PodSucceeded || pod.Status.Phase == api.PodFailed:
+		return PodTerminated
+	case pod.Status.PodIP == "" && len(pod.Status.PodIPs) == 0:
+		return PodWithoutIP
+	default:
+		return PodEnforced
+	}
+}
+
+// Enforceable returns true if NetworkPolicies govern, or will govern, the traffic of the pods of the class.
+func (c PodClass) Enforceable() bool {
+	return c == PodEnforced || c == PodWithoutIP
+}
+
+// Describe explains what the class of a pod means for the policies selecting it. It is empty for PodEnforced.
+func (c PodClass) Describe() string {
+	switch c {
+	case PodHostNetwork:
+		return "uses the host network: NetworkPolicies are not enforced on it"
+	case PodTerminated:
+		return "has terminated: NetworkPolicies have no traffic to enforce on it"
+	case PodWithoutIP:
+		return "has no IP yet: NetworkPolicies will be enforced once it starts"
+	default:
+		return ""
+	}
+}
+
+// PodFilter selects the classes of pods to exclude from a PodList.
+type PodFilter struct {
+	ExcludeHostNetwork bool
+	ExcludeTerminated  bool
+	ExcludeWithoutIP   bool
+}
+
+// UnenforceablePods is the PodFilter excluding the pods whose traffic NetworkPolicies don't govern.
+var UnenforceablePods = PodFilter{
+	ExcludeHostNetwork: true,
+	ExcludeTerminated:  true,
+}
+
+// Excludes returns true if the filter excludes the pod.
+func (f PodFilter) Excludes(pod *api.Pod) bool {
+	switch ClassifyPod(pod) {
+	case PodHostNetwork:
+		return f.ExcludeHostNetwork
+	case PodTerminated:
+		return f.ExcludeTerminated
+	case PodWithoutIP:
+		return f.ExcludeWithoutIP
+	default:
+		return false
+	}
+}
+
+// FilterPods returns the pods of the list that the filter doesn't exclude.
+// It is typically applied to the list given to ListPodsPerPolicy or BuildConnectivityMatrix.
+func FilterPods(allPods *api.PodList, filter PodFilter) *api.PodList {
+	pods := &api.PodList{
+		Items: []api.Pod{},
+	}
+	for i := range allPods.Items {
+		if !filter.Excludes(&allPods.Items[i]) {
+			pods.Items = append(pods.Items, allPods.Items[i])
+		}
+	}
+	return pods
+}
+
+// networkEndpoint returns the endpoint as seen by NetworkPolicies: a pod using the network of its node
+// is only its address, as pod and namespace selectors don't select it and no policy isolates it.
+func networkEndpoint(endpoint *Endpoint) *Endpoint {
+	if endpoint.Pod != nil && endpoint.Pod.Spec.HostNetwork {
+		return IPEndpoint(endpoint.IP)
+	}
+	return endpoint
+}
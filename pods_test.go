@@ -0,0 +1,118 @@
+package kubepox
+
+import (
+	"testing"
+
+	api "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// pod1hostnetwork is a pod with role=frontend using the network of its node
+var pod1hostnetwork = api.Pod{
+	ObjectMeta: metav1.ObjectMeta{
+		Name:   "pod1hostnetwork",
+		Labels: pod1.Labels,
+	},
+	Spec: api.PodSpec{
+		HostNetwork: true,
+	},
+	Status: api.PodStatus{
+		Phase: api.PodRunning,
+		PodIP: "10.2.0.1",
+	},
+}
+
+// pod2running is pod2 running with an IP
+var pod2running = api.Pod{
+	ObjectMeta: pod2.ObjectMeta,
+	Status: api.PodStatus{
+		Phase: api.PodRunning,
+		PodIP: "10.1.0.2",
+	},
+}
+
+// pod3succeeded is a completed pod
+var pod3succeeded = api.Pod{
+	ObjectMeta: metav1.ObjectMeta{
+		Name: "pod3",
+	},
+	Status: api.PodStatus{
+		Phase: api.PodSucceeded,
+		PodIP: "10.1.0.3",
+	},
+}
+
+func TestClassifyPod(t *testing.T) {
+	type testStruct struct {
+		Pod         api.Pod
+		Class       PodClass
+		Enforceable bool
+	}
+
+	tests := []testStruct{
+		testStruct{
+			Pod:         pod2running,
+			Class:       PodEnforced,
+			Enforceable: true,
+		},
+		testStruct{
+			Pod:         pod1hostnetwork,
+			Class:       PodHostNetwork,
+			Enforceable: false,
+		},
+		testStruct{
+			Pod:         pod3succeeded,
+			Class:       PodTerminated,
+			Enforceable: false,
+		},
+		testStruct{
+			Pod:         pod1,
+			Class:       PodWithoutIP,
+			Enforceable: true,
+		},
+	}
+
+	for i, test := range tests {
+		t.Log("Testing ClassifyPod ", i)
+		class := ClassifyPod(&test.Pod)
+		if class != test.Class || class.Enforceable() != test.Enforceable {
+			t.Errorf("Class error. Test %d Got %s/%t expected %s/%t", i, class, class.Enforceable(), test.Class, test.Enforceable)
+		}
+	}
+}
+
+func TestFilterPods(t *testing.T) {
+	pods := buildPodList(pod1, pod1hostnetwork, pod2running, pod3succeeded)
+
+	filtered := FilterPods(&pods, UnenforceablePods)
+	if err := testPodListEquality(*filtered, buildPodList(pod1, pod2running)); err != nil {
+		t.Errorf("Filter error. %s", err)
+	}
+
+	filtered = FilterPods(&pods, PodFilter{ExcludeWithoutIP: true})
+	if err := testPodListEquality(*filtered, buildPodList(pod1hostnetwork, pod2running, pod3succeeded)); err != nil {
+		t.Errorf("Filter error. %s", err)
+	}
+}
+
+func TestEvaluateTrafficHostNetwork(t *testing.T) {
+	// The host network pod is not isolated by np1, and is only seen by its address by npipblock.
+	policies := buildNetworkPolicyList(np1, npipblock)
+
+	verdict, err := EvaluateTraffic(PodEndpoint(&pod2running), PodEndpoint(&pod1hostnetwork), 80, api.ProtocolTCP, &namespaces, &policies)
+	if err != nil {
+		t.Fatalf("Error on EvaluateTraffic: %s", err)
+	}
+	if !verdict.Allowed || verdict.IngressIsolated {
+		t.Errorf("Got %+v expected the host network pod not to be isolated", verdict)
+	}
+
+	policies = buildNetworkPolicyList(npipblock)
+	verdict, err = EvaluateTraffic(PodEndpoint(&pod1hostnetwork), PodEndpoint(&pod1withport), 80, api.ProtocolTCP, &namespaces, &policies)
+	if err != nil {
+		t.Fatalf("Error on EvaluateTraffic: %s", err)
+	}
+	if !verdict.Allowed {
+		t.Errorf("Got %+v expected the address of the host network pod to match the ipBlock", verdict)
+	}
+}
@@ -0,0 +1,85 @@
+package kubepox
+
+import (
+	"fmt"
+	"sort"
+
+	api "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+)
+
+// Port is a port number and protocol to evaluate connections on. Number 0 stands for any port.
+type Port struct {
+	Number   int32        `json:"port"`
+	Protocol api.Protocol `json:"protocol"`
+}
+
+// String returns protocol/number, or protocol/any for any port.
+func (p Port) String() string {
+	if p.Number == 0 {
+		return string(p.Protocol) + "/any"
+	}
+	return fmt.Sprintf("%s/%d", p.Protocol, p.Number)
+}
+
+// ContainerPorts returns the ports declared by the containers of the pod.
+func ContainerPorts(pod *api.Pod) []Port {
+	ports := []Port{}
+	for _, container := range pod.Spec.Containers {
+		for _, p := range container.Ports {
+			ports = append(ports, Port{Number: p.ContainerPort, Protocol: defaultProtocol(p.Protocol)})
+		}
+	}
+	return ports
+}
+
+// PolicyPorts returns the numeric ports of the ingress and egress rules of the policies, and port 0, standing
+// for any port, for the protocol of the rule ports without a number.
+// Named ports are left out, as they only resolve against the containers of a destination.
+func PolicyPorts(policies *networking.NetworkPolicyList) []Port {
+	ports := []Port{}
+	add := func(policyPorts []networking.NetworkPolicyPort) {
+		for _, p := range policyPorts {
+			protocol := api.ProtocolTCP
+			if p.Protocol != nil {
+				protocol = defaultProtocol(*p.Protocol)
+			}
+			switch {
+			case p.Port == nil:
+				ports = append(ports, Port{Number: 0, Protocol: protocol})
+			case p.Port.StrVal == "":
+				ports = append(ports, Port{Number: p.Port.IntVal, Protocol: protocol})
+			}
+		}
+	}
+	for _, policy := range policies.Items {
+		for _, rule := range policy.Spec.Ingress {
+			add(rule.Ports)
+		}
+		for _, rule := range policy.Spec.Egress {
+			add(rule.Ports)
+		}
+	}
+	return ports
+}
+
+// MergePorts returns the distinct ports of the lists, sorted by protocol and number.
+func MergePorts(lists ...[]Port) []Port {
+	seen := map[Port]bool{}
+	ports := []Port{}
+	for _, list := range lists {
+		for _, p := range list {
+			if !seen[p] {
+				seen[p] = true
+				ports = append(ports, p)
+			}
+		}
+	}
+	sort.Slice(ports, func(i, j int) bool {
+		if ports[i].Protocol != ports[j].Protocol {
+			return ports[i].Protocol < ports[j].Protocol
+		}
+		return ports[i].Number < ports[j].Number
+	})
+	return ports
+}
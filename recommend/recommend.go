@@ -0,0 +1,442 @@
+// Package recommend generates least-privilege NetworkPolicies allowing exactly the traffic observed on a cluster.
+//
+// Pods are grouped in workloads sharing the same stable labels, the labels set by controllers on every
+// revision of a pod (pod-template-hash, controller-revision-hash, ...) being ignored. Every workload owning
+// an observed flow gets a policy selecting it by its stable labels, with a rule per peer allowing the ports
+// observed with that peer. When the labels of a workload are a subset of the labels of other pods of its
+// namespace, the selector also requires the labels distinguishing those pods not to exist, so that it selects
+// the workload alone. Peers in another namespace are selected through the kubernetes.io/metadata.name label
+// set on namespaces by Kubernetes 1.21 and later, and addresses owned by no pod through an ipBlock.
+package recommend
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/aporeto-inc/kubepox"
+	"github.com/aporeto-inc/kubepox/cluster"
+	"github.com/aporeto-inc/kubepox/flows"
+
+	api "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// NamespaceNameLabel is the label holding the name of a namespace.
+const NamespaceNameLabel = "kubernetes.io/metadata.name"
+
+// unstableLabels are set by controllers and change between revisions of the pods of a workload.
+var unstableLabels = map[string]bool{
+	"pod-template-hash":                  true,
+	"controller-revision-hash":           true,
+	"pod-template-generation":            true,
+	"statefulset.kubernetes.io/pod-name": true,
+	"controller-uid":                     true,
+	"job-name":                           true,
+}
+
+// nameLabels are looked up, in order, to name the policy of a workload.
+var nameLabels = []string{
+	"app.kubernetes.io/name",
+	"app",
+	"k8s-app",
+	"name",
+}
+
+// Options selects the directions of the generated policies.
+type Options struct {
+	Ingress bool
+	Egress  bool
+}
+
+// Result holds the generated policies.
+type Result struct {
+	Policies []networking.NetworkPolicy `json:"policies"`
+	// Skipped lists the pods owning observed flows that can't be selected, as they have no stable label.
+	Skipped []string `json:"skipped"`
+	// Warnings list the namespaces selected by the policies that lack the kubernetes.io/metadata.name label,
+	// as on clusters older than 1.21: the namespaceSelectors of the policies don't select them.
+	Warnings []string `json:"warnings"`
+}
+
+// workload is a set of pods of a namespace with the same stable labels.
+type workload struct {
+	namespace string
+	labels    map[string]string
+	selector  *metav1.LabelSelector
+	pod       *api.Pod
+	ingress   map[string]*peerPorts
+	egress    map[string]*peerPorts
+}
+
+// peerPorts is a peer and the ports observed with it.
+type peerPorts struct {
+	peer  networking.NetworkPolicyPeer
+	ports map[string]networking.NetworkPolicyPort
+}
+
+// Recommend generates the policies allowing the allowed flows, for the pods of the state owning their addresses.
+// The policies are verified: the error lists the flows they don't allow and the pods they don't isolate.
+func Recommend(observed []flows.Flow, state *cluster.State, options Options) (*Result, error) {
+	workloads := map[string]*workload{}
+	skipped := map[string]bool{}
+
+	workloadOf := func(pod *api.Pod) *workload {
+		labels := StableLabels(pod.Labels)
+		if len(labels) == 0 {
+			skipped[pod.Namespace+"/"+pod.Name] = true
+			return nil
+		}
+		key := pod.Namespace + "|" + labelsKey(labels)
+		if workloads[key] == nil {
+			workloads[key] = &workload{
+				namespace: pod.Namespace,
+				labels:    labels,
+				selector:  exclusiveSelector(state, pod.Namespace, labels),
+				pod:       pod,
+				ingress:   map[string]*peerPorts{},
+				egress:    map[string]*peerPorts{},
+			}
+		}
+		return workloads[key]
+	}
+
+	for _, flow := range observed {
+		if flow.Verdict != flows.Allowed {
+			continue
+		}
+		src := state.PodByIP(flow.Source)
+		dst := state.PodByIP(flow.Destination)
+
+		if options.Egress && src != nil {
+			if w := workloadOf(src); w != nil {
+				addPort(w.egress, w.namespace, state, dst, flow.Destination, flow)
+			}
+		}
+		if options.Ingress && dst != nil {
+			if w := workloadOf(dst); w != nil {
+				addPort(w.ingress, w.namespace, state, src, flow.Source, flow)
+			}
+		}
+	}
+
+	result := &Result{
+		Policies: []networking.NetworkPolicy{},
+		Skipped:  []string{},
+		Warnings: []string{},
+	}
+
+	keys := []string{}
+	for key := range workloads {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	names := map[string]bool{}
+	for _, key := range keys {
+		policy := workloads[key].policy(options)
+		name := policy.Name
+		for i := 2; names[policy.Namespace+"/"+policy.Name]; i++ {
+			policy.Name = fmt.Sprintf("%s-%d", name, i)
+		}
+		names[policy.Namespace+"/"+policy.Name] = true
+		result.Policies = append(result.Policies, *policy)
+	}
+
+	for pod := range skipped {
+		result.Skipped = append(result.Skipped, pod)
+	}
+	sort.Strings(result.Skipped)
+	result.Warnings = namespaceWarnings(state, result.Policies)
+
+	return result, verify(observed, state, result.Policies, options)
+}
+
+// exclusiveSelector returns a selector of the pods of the namespace whose stable labels are exactly the labels.
+// The pods whose stable labels are a superset of the labels are left out by requiring one of their extra labels
+// not to exist.
+func exclusiveSelector(state *cluster.State, namespace string, labels map[string]string) *metav1.LabelSelector {
+	selector := &metav1.LabelSelector{MatchLabels: labels}
+	excluded := map[string]bool{}
+	for _, pod := range state.Pods.Items {
+		if pod.Namespace != namespace {
+			continue
+		}
+		others := StableLabels(pod.Labels)
+		if len(others) == len(labels) || !contains(others, labels) {
+			continue
+		}
+		extra := []string{}
+		for k := range others {
+			if _, ok := labels[k]; !ok {
+				extra = append(extra, k)
+			}
+		}
+		sort.Strings(extra)
+		found := false
+		for _, k := range extra {
+			if excluded[k] {
+				found = true
+				break
+			}
+		}
+		if !found {
+			excluded[extra[0]] = true
+		}
+	}
+
+	keys := []string{}
+	for k := range excluded {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		selector.MatchExpressions = append(selector.MatchExpressions, metav1.LabelSelectorRequirement{
+			Key:      k,
+			Operator: metav1.LabelSelectorOpDoesNotExist,
+		})
+	}
+	return selector
+}
+
+// contains returns true if all the labels of subset are in labels.
+func contains(labels, subset map[string]string) bool {
+	for k, v := range subset {
+		if value, ok := labels[k]; !ok || value != v {
+			return false
+		}
+	}
+	return true
+}
+
+// namespaceWarnings returns a warning for every namespace selected by name by the policies that is unknown
+// or lacks the label holding its name.
+func namespaceWarnings(state *cluster.State, policies []networking.NetworkPolicy) []string {
+	warned := map[string]bool{}
+	warnings := []string{}
+	check := func(peers []networking.NetworkPolicyPeer) {
+		for _, peer := range peers {
+			if peer.NamespaceSelector == nil {
+				continue
+			}
+			name := peer.NamespaceSelector.MatchLabels[NamespaceNameLabel]
+			if warned[name] {
+				continue
+			}
+			warned[name] = true
+			namespace := state.Namespace(name)
+			if namespace == nil {
+				warnings = append(warnings, fmt.Sprintf("namespace %s is unknown: the policies select it by its %s label", name, NamespaceNameLabel))
+			} else if namespace.Labels[NamespaceNameLabel] != name {
+				warnings = append(warnings, fmt.Sprintf("namespace %s has no %s label, set by Kubernetes 1.21 and later: the policies don't select it until it is labeled", name, NamespaceNameLabel))
+			}
+		}
+	}
+	for _, policy := range policies {
+		for _, rule := range policy.Spec.Ingress {
+			check(rule.From)
+		}
+		for _, rule := range policy.Spec.Egress {
+			check(rule.To)
+		}
+	}
+	sort.Strings(warnings)
+	return warnings
+}
+
+// StableLabels returns the labels of a pod, without the labels set by controllers on each revision.
+func StableLabels(labels map[string]string) map[string]string {
+	stable := map[string]string{}
+	for k, v := range labels {
+		if !unstableLabels[k] {
+			stable[k] = v
+		}
+	}
+	return stable
+}
+
+// addPort records the port of the flow with the peer, a pod or an address owned by no pod.
+// A pod without stable labels is a peer selecting all the pods of its namespace.
+func addPort(peers map[string]*peerPorts, namespace string, state *cluster.State, pod *api.Pod, ip string, flow flows.Flow) {
+	var key string
+	var peer networking.NetworkPolicyPeer
+	if pod != nil {
+		labels := StableLabels(pod.Labels)
+		key = pod.Namespace + "|" + labelsKey(labels)
+		peer.PodSelector = exclusiveSelector(state, pod.Namespace, labels)
+		if pod.Namespace != namespace {
+			peer.NamespaceSelector = &metav1.LabelSelector{
+				MatchLabels: map[string]string{NamespaceNameLabel: pod.Namespace},
+			}
+		}
+	} else {
+		key = "ip|" + ip
+		peer.IPBlock = &networking.IPBlock{CIDR: hostCIDR(ip)}
+	}
+
+	if peers[key] == nil {
+		peers[key] = &peerPorts{
+			peer:  peer,
+			ports: map[string]networking.NetworkPolicyPort{},
+		}
+	}
+	protocol := flow.Protocol
+	port := intstr.FromInt(int(flow.Port))
+	peers[key].ports[fmt.Sprintf("%s/%05d", protocol, flow.Port)] = networking.NetworkPolicyPort{
+		Protocol: &protocol,
+		Port:     &port,
+	}
+}
+
+// hostCIDR returns the CIDR holding only the address.
+func hostCIDR(ip string) string {
+	if parsed := net.ParseIP(ip); parsed != nil && parsed.To4() == nil {
+		return ip + "/128"
+	}
+	return ip + "/32"
+}
+
+// policy generates the policy of the workload.
+func (w *workload) policy(options Options) *networking.NetworkPolicy {
+	policy := &networking.NetworkPolicy{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: networking.SchemeGroupVersion.String(),
+			Kind:       "NetworkPolicy",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      w.name() + "-least-privilege",
+			Namespace: w.namespace,
+		},
+		Spec: networking.NetworkPolicySpec{
+			PodSelector: *w.selector,
+		},
+	}
+
+	if options.Ingress {
+		policy.Spec.PolicyTypes = append(policy.Spec.PolicyTypes, networking.PolicyTypeIngress)
+		for _, peer := range sortedPeers(w.ingress) {
+			policy.Spec.Ingress = append(policy.Spec.Ingress, networking.NetworkPolicyIngressRule{
+				From:  []networking.NetworkPolicyPeer{peer.peer},
+				Ports: peer.sortedPorts(),
+			})
+		}
+	}
+	if options.Egress {
+		policy.Spec.PolicyTypes = append(policy.Spec.PolicyTypes, networking.PolicyTypeEgress)
+		for _, peer := range sortedPeers(w.egress) {
+			policy.Spec.Egress = append(policy.Spec.Egress, networking.NetworkPolicyEgressRule{
+				To:    []networking.NetworkPolicyPeer{peer.peer},
+				Ports: peer.sortedPorts(),
+			})
+		}
+	}
+
+	return policy
+}
+
+// name returns a name for the workload, out of its labels or the name of one of its pods.
+func (w *workload) name() string {
+	for _, label := range nameLabels {
+		if name, ok := w.labels[label]; ok && name != "" {
+			return name
+		}
+	}
+	return w.pod.Name
+}
+
+func sortedPeers(peers map[string]*peerPorts) []*peerPorts {
+	keys := []string{}
+	for key := range peers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	sorted := []*peerPorts{}
+	for _, key := range keys {
+		sorted = append(sorted, peers[key])
+	}
+	return sorted
+}
+
+func (p *peerPorts) sortedPorts() []networking.NetworkPolicyPort {
+	keys := []string{}
+	for key := range p.ports {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	ports := []networking.NetworkPolicyPort{}
+	for _, key := range keys {
+		ports = append(ports, p.ports[key])
+	}
+	return ports
+}
+
+// verify checks that the policies, along with the existing ones, allow every observed flow and isolate
+// the pods they select in the chosen directions, and only those of their workload. Namespaces are evaluated
+// with their actual labels: a namespace without the label holding its name is not selected.
+func verify(observed []flows.Flow, state *cluster.State, policies []networking.NetworkPolicy, options Options) error {
+	allPolicies := &networking.NetworkPolicyList{
+		Items: append(append([]networking.NetworkPolicy{}, state.Policies.Items...), policies...),
+	}
+
+	problems := []string{}
+	for _, flow := range observed {
+		if flow.Verdict != flows.Allowed {
+			continue
+		}
+		src, dst := flows.Endpoint(flow.Source, state), flows.Endpoint(flow.Destination, state)
+		if src.Pod == nil && dst.Pod == nil {
+			continue
+		}
+		verdict, err := kubepox.EvaluateTraffic(src, dst, flow.Port, flow.Protocol, &state.Namespaces, allPolicies)
+		if err != nil {
+			return err
+		}
+		// Only the directions of the generated policies are checked, on the pods they can select.
+		if (options.Egress && selectable(src) && !verdict.EgressAllowed) || (options.Ingress && selectable(dst) && !verdict.IngressAllowed) {
+			problems = append(problems, fmt.Sprintf("flow %s -> %s %s/%d is not allowed", src, dst, flow.Protocol, flow.Port))
+		}
+	}
+
+	for i := range policies {
+		pods, err := kubepox.ListPodsPerPolicy(&policies[i], &state.Pods)
+		if err != nil {
+			return err
+		}
+		for j := range pods.Items {
+			pod := &pods.Items[j]
+			ingress, egress, err := kubepox.IsPodSelected(pod, allPolicies)
+			if err != nil {
+				return err
+			}
+			if (options.Ingress && !ingress) || (options.Egress && !egress) {
+				problems = append(problems, fmt.Sprintf("pod %s/%s is not isolated", pod.Namespace, pod.Name))
+			}
+			if labels := StableLabels(pod.Labels); len(labels) != len(policies[i].Spec.PodSelector.MatchLabels) {
+				problems = append(problems, fmt.Sprintf("policy %s/%s selects pod %s/%s of another workload", policies[i].Namespace, policies[i].Name, pod.Namespace, pod.Name))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("the recommended policies are incorrect: %s", strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+// selectable returns true if the endpoint is a pod with stable labels.
+func selectable(endpoint *kubepox.Endpoint) bool {
+	return endpoint.Pod != nil && len(StableLabels(endpoint.Pod.Labels)) > 0
+}
+
+func labelsKey(labels map[string]string) string {
+	pairs := []string{}
+	for k, v := range labels {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,172 @@
+package recommend
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aporeto-inc/kubepox/cluster"
+	"github.com/aporeto-inc/kubepox/flows"
+
+	api "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func buildPod(namespace, name, ip string, labels map[string]string) api.Pod {
+	return api.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: labels},
+		Status:     api.PodStatus{Phase: api.PodRunning, PodIP: ip},
+	}
+}
+
+func buildNamespace(name string) api.Namespace {
+	return api.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{NamespaceNameLabel: name}},
+	}
+}
+
+func buildState() *cluster.State {
+	return &cluster.State{
+		Namespaces: api.NamespaceList{
+			Items: []api.Namespace{buildNamespace("web"), buildNamespace("data")},
+		},
+		Pods: api.PodList{
+			Items: []api.Pod{
+				buildPod("web", "frontend-1", "10.0.0.1", map[string]string{"app": "frontend", "pod-template-hash": "abc"}),
+				buildPod("web", "frontend-2", "10.0.0.4", map[string]string{"app": "frontend", "pod-template-hash": "def"}),
+				buildPod("web", "api", "10.0.0.2", map[string]string{"app": "api"}),
+				buildPod("web", "nolabel", "10.0.0.9", nil),
+				buildPod("data", "db", "10.0.1.1", map[string]string{"app": "db"}),
+			},
+		},
+	}
+}
+
+func buildFlows() []flows.Flow {
+	return []flows.Flow{
+		flows.Flow{Source: "10.0.0.1", Destination: "10.0.0.2", Port: 8080, Protocol: api.ProtocolTCP, Verdict: flows.Allowed},
+		flows.Flow{Source: "10.0.0.4", Destination: "10.0.0.2", Port: 8080, Protocol: api.ProtocolTCP, Verdict: flows.Allowed},
+		flows.Flow{Source: "10.0.0.1", Destination: "10.0.0.2", Port: 9090, Protocol: api.ProtocolUDP, Verdict: flows.Allowed},
+		flows.Flow{Source: "10.0.0.2", Destination: "10.0.1.1", Port: 5432, Protocol: api.ProtocolTCP, Verdict: flows.Allowed},
+		flows.Flow{Source: "192.168.1.1", Destination: "10.0.0.4", Port: 443, Protocol: api.ProtocolTCP, Verdict: flows.Allowed},
+		flows.Flow{Source: "10.0.0.9", Destination: "10.0.0.2", Port: 8080, Protocol: api.ProtocolTCP, Verdict: flows.Allowed},
+		flows.Flow{Source: "10.0.0.1", Destination: "10.0.1.1", Port: 5432, Protocol: api.ProtocolTCP, Verdict: flows.Denied},
+	}
+}
+
+func findPolicy(policies []networking.NetworkPolicy, namespace, name string) *networking.NetworkPolicy {
+	for i := range policies {
+		if policies[i].Namespace == namespace && policies[i].Name == name {
+			return &policies[i]
+		}
+	}
+	return nil
+}
+
+func TestRecommend(t *testing.T) {
+	result, err := Recommend(buildFlows(), buildState(), Options{Ingress: true, Egress: true})
+	if err != nil {
+		t.Fatalf("Error recommending policies: %s", err)
+	}
+
+	if len(result.Policies) != 3 {
+		t.Fatalf("Got %d policies expected 3: %+v", len(result.Policies), result.Policies)
+	}
+	if len(result.Warnings) != 0 {
+		t.Errorf("Got warnings %v expected none", result.Warnings)
+	}
+	if len(result.Skipped) != 1 || result.Skipped[0] != "web/nolabel" {
+		t.Errorf("Got skipped pods %v expected web/nolabel", result.Skipped)
+	}
+
+	frontend := findPolicy(result.Policies, "web", "frontend-least-privilege")
+	if frontend == nil {
+		t.Fatalf("No policy for frontend in %+v", result.Policies)
+	}
+	if len(frontend.Spec.PodSelector.MatchLabels) != 1 || frontend.Spec.PodSelector.MatchLabels["app"] != "frontend" {
+		t.Errorf("Got selector %+v expected app=frontend", frontend.Spec.PodSelector)
+	}
+	if len(frontend.Spec.Ingress) != 1 || frontend.Spec.Ingress[0].From[0].IPBlock == nil || frontend.Spec.Ingress[0].From[0].IPBlock.CIDR != "192.168.1.1/32" {
+		t.Errorf("Got ingress %+v expected 192.168.1.1/32", frontend.Spec.Ingress)
+	}
+
+	api := findPolicy(result.Policies, "web", "api-least-privilege")
+	if api == nil {
+		t.Fatalf("No policy for api in %+v", result.Policies)
+	}
+	if len(api.Spec.Ingress) != 2 {
+		t.Fatalf("Got ingress %+v expected 2 rules", api.Spec.Ingress)
+	}
+	ports := api.Spec.Ingress[1].Ports
+	if len(ports) != 2 || ports[0].Port.IntVal != 8080 || ports[1].Port.IntVal != 9090 || *ports[1].Protocol != "UDP" {
+		t.Errorf("Got ports %+v expected TCP/8080 and UDP/9090 merged", ports)
+	}
+	if len(api.Spec.Egress) != 1 || api.Spec.Egress[0].To[0].NamespaceSelector.MatchLabels[NamespaceNameLabel] != "data" {
+		t.Errorf("Got egress %+v expected a namespaceSelector on data", api.Spec.Egress)
+	}
+
+	db := findPolicy(result.Policies, "data", "db-least-privilege")
+	if db == nil {
+		t.Fatalf("No policy for db in %+v", result.Policies)
+	}
+	if len(db.Spec.Egress) != 0 || len(db.Spec.PolicyTypes) != 2 {
+		t.Errorf("Got policy %+v expected db isolated for egress without rules", db.Spec)
+	}
+}
+
+func TestRecommendIngressOnly(t *testing.T) {
+	result, err := Recommend(buildFlows(), buildState(), Options{Ingress: true})
+	if err != nil {
+		t.Fatalf("Error recommending policies: %s", err)
+	}
+	for _, policy := range result.Policies {
+		if len(policy.Spec.PolicyTypes) != 1 || policy.Spec.PolicyTypes[0] != networking.PolicyTypeIngress || len(policy.Spec.Egress) != 0 {
+			t.Errorf("Got policy %s/%s %+v expected ingress only", policy.Namespace, policy.Name, policy.Spec)
+		}
+	}
+}
+
+func TestRecommendSubsetLabels(t *testing.T) {
+	state := buildState()
+	state.Pods.Items = append(state.Pods.Items,
+		buildPod("web", "api-canary", "10.0.0.3", map[string]string{"app": "api", "tier": "canary"}),
+		buildPod("web", "api-debug", "10.0.0.5", map[string]string{"app": "api", "tier": "canary", "debug": "true"}),
+	)
+	result, err := Recommend(buildFlows(), state, Options{Ingress: true, Egress: true})
+	if err != nil {
+		t.Fatalf("Error recommending policies: %s", err)
+	}
+
+	api := findPolicy(result.Policies, "web", "api-least-privilege")
+	if api == nil {
+		t.Fatalf("No policy for api in %+v", result.Policies)
+	}
+	expressions := api.Spec.PodSelector.MatchExpressions
+	if len(expressions) != 1 || expressions[0].Key != "tier" || expressions[0].Operator != metav1.LabelSelectorOpDoesNotExist {
+		t.Errorf("Got selector %+v expected app=api without tier", api.Spec.PodSelector)
+	}
+	frontend := findPolicy(result.Policies, "web", "frontend-least-privilege")
+	if peer := frontend.Spec.Egress[0].To[0].PodSelector; peer == nil || len(peer.MatchExpressions) != 1 {
+		t.Errorf("Got egress peer %+v expected app=api without tier", frontend.Spec.Egress[0].To[0])
+	}
+}
+
+func TestRecommendNamespaceLabel(t *testing.T) {
+	state := buildState()
+	state.Namespaces.Items[1].Labels = nil
+
+	result, err := Recommend(buildFlows(), state, Options{Ingress: true, Egress: true})
+	if err == nil {
+		t.Errorf("Verified policies selecting namespace data without its name label")
+	}
+	if result == nil || len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], "namespace data has no") {
+		t.Errorf("Got result %+v expected a warning on namespace data", result)
+	}
+}
+
+func TestStableLabels(t *testing.T) {
+	labels := StableLabels(map[string]string{"app": "web", "pod-template-hash": "abc", "controller-revision-hash": "def"})
+	if len(labels) != 1 || labels["app"] != "web" {
+		t.Errorf("Got %v expected app=web", labels)
+	}
+}
@@ -0,0 +1,272 @@
+// Package server exposes the kubepox queries over a REST/JSON API.
+//
+// The API is read only:
+//
+//	GET /v1/namespaces/{namespace}/pods/{pod}/policies       NetworkPolicies selecting the pod
+//	GET /v1/namespaces/{namespace}/pods/{pod}/rules          effective ingress and egress rules of the pod
+//	GET /v1/namespaces/{namespace}/pods/{pod}/rules?normalize=true
+//	                                                         normalized rules, with the policies they come from
+//	GET /v1/namespaces/{namespace}/policies/{policy}/pods    pods selected by the NetworkPolicy
+//	GET /v1/connectivity?from=ns/pod&to=ns/pod&port=80[&protocol=TCP]
+//	GET /v1/connectivity/matrix?port=80[&protocol=TCP][&namespace=ns]
+//
+// Workloads can be queried in place of pods, with their kind as in kubectl: deployments/{name} instead of
+// pods/{pod} in the paths, and ns/kind/name, such as ns/deploy/web, in the connectivity queries. A workload
+// is evaluated with one of its pods, of its newest revision during a rollout.
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/aporeto-inc/kubepox"
+	"github.com/aporeto-inc/kubepox/cluster"
+
+	api "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+)
+
+// Server answers the kubepox queries on the State provided by a Source.
+type Server struct {
+	source cluster.Source
+	mux    *http.ServeMux
+}
+
+// Rules is the response of the effective rules query.
+// A nil list means that the pod is not isolated in that direction.
+type Rules struct {
+	Ingress *[]networking.NetworkPolicyIngressRule `json:"ingress"`
+	Egress  *[]networking.NetworkPolicyEgressRule  `json:"egress"`
+}
+
+// NormalizedRules is the response of the effective rules query with normalize=true.
+type NormalizedRules struct {
+	Ingress *[]kubepox.IngressRule `json:"ingress"`
+	Egress  *[]kubepox.EgressRule  `json:"egress"`
+}
+
+// Error is the body of every non successful response.
+type Error struct {
+	Error string `json:"error"`
+}
+
+// httpError is an error carrying the HTTP status to respond with.
+type httpError struct {
+	status  int
+	message string
+}
+
+func (e *httpError) Error() string {
+	return e.message
+}
+
+func errorf(status int, format string, args ...interface{}) error {
+	return &httpError{
+		status:  status,
+		message: fmt.Sprintf(format, args...),
+	}
+}
+
+// New returns a Server answering on the State provided by the source.
+func New(source cluster.Source) *Server {
+	s := &Server{
+		source: source,
+		mux:    http.NewServeMux(),
+	}
+	s.mux.HandleFunc("/v1/namespaces/", s.handle(s.namespaced))
+	s.mux.HandleFunc("/v1/connectivity", s.handle(s.connectivity))
+	s.mux.HandleFunc("/v1/connectivity/matrix", s.handle(s.matrix))
+	s.mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	return s
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// handle adapts a query to an http.HandlerFunc, encoding its result or its error as JSON.
+func (s *Server) handle(query func(*cluster.State, *http.Request) (interface{}, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if r.Method != http.MethodGet {
+			writeError(w, errorf(http.StatusMethodNotAllowed, "method %s not allowed", r.Method))
+			return
+		}
+
+		state, err := s.source.State()
+		if err != nil {
+			writeError(w, errorf(http.StatusServiceUnavailable, "couldn't get cluster state: %v", err))
+			return
+		}
+
+		result, err := query(state, r)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(result)
+	}
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	if e, ok := err.(*httpError); ok {
+		status = e.status
+	}
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(&Error{Error: err.Error()})
+}
+
+// namespaced dispatches the queries under /v1/namespaces/{namespace}/.
+func (s *Server) namespaced(state *cluster.State, r *http.Request) (interface{}, error) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/v1/namespaces/"), "/"), "/")
+	if len(parts) != 4 {
+		return nil, errorf(http.StatusNotFound, "unknown path %s", r.URL.Path)
+	}
+	namespace, kind, name, query := parts[0], parts[1], parts[2], parts[3]
+
+	switch {
+	case kind == "policies" && query == "pods":
+		policy := state.Policy(namespace, name)
+		if policy == nil {
+			return nil, errorf(http.StatusNotFound, "policy %s/%s not found", namespace, name)
+		}
+		return kubepox.ListPodsPerPolicy(policy, &state.Pods)
+
+	case query == "policies":
+		pod, err := findWorkloadPod(state, namespace, kind, name)
+		if err != nil {
+			return nil, err
+		}
+		return kubepox.ListPoliciesPerPod(pod, &state.Policies)
+
+	case query == "rules":
+		pod, err := findWorkloadPod(state, namespace, kind, name)
+		if err != nil {
+			return nil, err
+		}
+		if normalize, _ := strconv.ParseBool(r.URL.Query().Get("normalize")); normalize {
+			ingress, err := kubepox.ListNormalizedIngressRulesPerPod(pod, &state.Policies)
+			if err != nil {
+				return nil, err
+			}
+			egress, err := kubepox.ListNormalizedEgressRulesPerPod(pod, &state.Policies)
+			if err != nil {
+				return nil, err
+			}
+			return &NormalizedRules{Ingress: ingress, Egress: egress}, nil
+		}
+		ingress, err := kubepox.ListIngressRulesPerPod(pod, &state.Policies)
+		if err != nil {
+			return nil, err
+		}
+		egress, err := kubepox.ListEgressRulesPerPod(pod, &state.Policies)
+		if err != nil {
+			return nil, err
+		}
+		return &Rules{Ingress: ingress, Egress: egress}, nil
+	}
+
+	return nil, errorf(http.StatusNotFound, "unknown path %s", r.URL.Path)
+}
+
+// connectivity evaluates the traffic between two pods or workloads.
+func (s *Server) connectivity(state *cluster.State, r *http.Request) (interface{}, error) {
+	query := r.URL.Query()
+
+	src, err := findPodRef(state, query.Get("from"))
+	if err != nil {
+		return nil, err
+	}
+	dst, err := findPodRef(state, query.Get("to"))
+	if err != nil {
+		return nil, err
+	}
+	port, protocol, err := parsePort(query.Get("port"), query.Get("protocol"))
+	if err != nil {
+		return nil, err
+	}
+
+	return kubepox.EvaluateTraffic(kubepox.PodEndpoint(src), kubepox.PodEndpoint(dst), port, protocol, &state.Namespaces, &state.Policies)
+}
+
+// matrix evaluates the traffic between every pair of pods, optionally restricted to a namespace.
+func (s *Server) matrix(state *cluster.State, r *http.Request) (interface{}, error) {
+	query := r.URL.Query()
+
+	port, protocol, err := parsePort(query.Get("port"), query.Get("protocol"))
+	if err != nil {
+		return nil, err
+	}
+
+	pods := &state.Pods
+	if namespace := query.Get("namespace"); namespace != "" {
+		pods = state.PodsInNamespace(namespace)
+	}
+
+	// Terminated pods have no traffic.
+	pods = kubepox.FilterPods(pods, kubepox.PodFilter{ExcludeTerminated: true})
+
+	return kubepox.BuildConnectivityMatrix(pods, port, protocol, &state.Namespaces, &state.Policies)
+}
+
+// findWorkloadPod finds the pod evaluated for the workload of the given kind, such as pods or deployments.
+// An unknown kind is an unknown path.
+func findWorkloadPod(state *cluster.State, namespace, kind, name string) (*api.Pod, error) {
+	workload, err := cluster.ParseWorkload(kind+"/"+name, namespace)
+	if err != nil {
+		return nil, errorf(http.StatusNotFound, "unknown kind %s", kind)
+	}
+	return findWorkload(state, workload)
+}
+
+func findWorkload(state *cluster.State, workload cluster.Workload) (*api.Pod, error) {
+	pod := state.WorkloadPod(workload)
+	if pod == nil {
+		if workload.Kind == cluster.KindPod {
+			return nil, errorf(http.StatusNotFound, "pod %s/%s not found", workload.Namespace, workload.Name)
+		}
+		return nil, errorf(http.StatusNotFound, "no pod found for %s in namespace %s", workload, workload.Namespace)
+	}
+	return pod, nil
+}
+
+// findPodRef finds a pod given as namespace/name, or the pod of a workload given as namespace/kind/name.
+func findPodRef(state *cluster.State, ref string) (*api.Pod, error) {
+	parts := strings.Split(ref, "/")
+	switch len(parts) {
+	case 2:
+		return findWorkload(state, cluster.Workload{Kind: cluster.KindPod, Namespace: parts[0], Name: parts[1]})
+	case 3:
+		workload, err := cluster.ParseWorkload(parts[1]+"/"+parts[2], parts[0])
+		if err != nil {
+			return nil, errorf(http.StatusBadRequest, "invalid reference %q: %v", ref, err)
+		}
+		return findWorkload(state, workload)
+	}
+	return nil, errorf(http.StatusBadRequest, "invalid reference %q, expected namespace/name or namespace/kind/name", ref)
+}
+
+func parsePort(port, protocol string) (int32, api.Protocol, error) {
+	number, err := strconv.ParseInt(port, 10, 32)
+	if err != nil || number <= 0 || number > 65535 {
+		return 0, "", errorf(http.StatusBadRequest, "invalid port %q", port)
+	}
+	if protocol == "" {
+		return int32(number), api.ProtocolTCP, nil
+	}
+	switch p := api.Protocol(strings.ToUpper(protocol)); p {
+	case api.ProtocolTCP, api.ProtocolUDP, api.ProtocolSCTP:
+		return int32(number), p, nil
+	}
+	return 0, "", errorf(http.StatusBadRequest, "invalid protocol %q", protocol)
+}
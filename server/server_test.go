@@ -0,0 +1,251 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aporeto-inc/kubepox"
+	"github.com/aporeto-inc/kubepox/cluster"
+
+	apps "k8s.io/api/apps/v1"
+	api "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var frontend = &api.Pod{
+	ObjectMeta: metav1.ObjectMeta{
+		Name:      "frontend",
+		Namespace: "default",
+		Labels: map[string]string{
+			"role": "frontend",
+		},
+	},
+}
+
+var backend = &api.Pod{
+	ObjectMeta: metav1.ObjectMeta{
+		Name:      "backend",
+		Namespace: "default",
+		Labels: map[string]string{
+			"role": "backend",
+		},
+	},
+}
+
+// allowfrombackend only allows ingress to role=frontend from role=backend
+var allowfrombackend = &networking.NetworkPolicy{
+	ObjectMeta: metav1.ObjectMeta{
+		Name:      "allowfrombackend",
+		Namespace: "default",
+	},
+	Spec: networking.NetworkPolicySpec{
+		PodSelector: metav1.LabelSelector{
+			MatchLabels: map[string]string{
+				"role": "frontend",
+			},
+		},
+		Ingress: []networking.NetworkPolicyIngressRule{
+			networking.NetworkPolicyIngressRule{
+				From: []networking.NetworkPolicyPeer{
+					networking.NetworkPolicyPeer{
+						PodSelector: &metav1.LabelSelector{
+							MatchLabels: map[string]string{
+								"role": "backend",
+							},
+						},
+					},
+				},
+			},
+		},
+	},
+}
+
+func newTestServer(t *testing.T) *httptest.Server {
+	client := fake.NewSimpleClientset(frontend, backend, allowfrombackend)
+	state, err := cluster.Load(context.Background(), client, "")
+	if err != nil {
+		t.Fatalf("Error loading the state: %s", err)
+	}
+	return httptest.NewServer(New(cluster.NewStaticSource(state)))
+}
+
+func get(t *testing.T, url string, result interface{}) int {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("Error on GET %s: %s", url, err)
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		t.Fatalf("Error decoding response of %s: %s", url, err)
+	}
+	return resp.StatusCode
+}
+
+func TestServer(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	policies := networking.NetworkPolicyList{}
+	if status := get(t, ts.URL+"/v1/namespaces/default/pods/frontend/policies", &policies); status != http.StatusOK {
+		t.Fatalf("Got status %d on policies query", status)
+	}
+	if len(policies.Items) != 1 || policies.Items[0].Name != "allowfrombackend" {
+		t.Errorf("Got policies %+v expected allowfrombackend", policies.Items)
+	}
+
+	pods := api.PodList{}
+	if status := get(t, ts.URL+"/v1/namespaces/default/policies/allowfrombackend/pods", &pods); status != http.StatusOK {
+		t.Fatalf("Got status %d on pods query", status)
+	}
+	if len(pods.Items) != 1 || pods.Items[0].Name != "frontend" {
+		t.Errorf("Got pods %+v expected frontend", pods.Items)
+	}
+
+	rules := Rules{}
+	if status := get(t, ts.URL+"/v1/namespaces/default/pods/frontend/rules", &rules); status != http.StatusOK {
+		t.Fatalf("Got status %d on rules query", status)
+	}
+	if rules.Ingress == nil || len(*rules.Ingress) != 1 || rules.Egress != nil {
+		t.Errorf("Got rules %+v expected one ingress rule and no egress isolation", rules)
+	}
+
+	normalized := NormalizedRules{}
+	if status := get(t, ts.URL+"/v1/namespaces/default/pods/frontend/rules?normalize=true", &normalized); status != http.StatusOK {
+		t.Fatalf("Got status %d on normalized rules query", status)
+	}
+	if normalized.Ingress == nil || len(*normalized.Ingress) != 1 || (*normalized.Ingress)[0].Policies[0] != "allowfrombackend" {
+		t.Errorf("Got rules %+v expected one ingress rule from allowfrombackend", normalized)
+	}
+
+	verdict := kubepox.Verdict{}
+	if status := get(t, ts.URL+"/v1/connectivity?from=default/backend&to=default/frontend&port=80", &verdict); status != http.StatusOK {
+		t.Fatalf("Got status %d on connectivity query", status)
+	}
+	if !verdict.Allowed {
+		t.Errorf("Got verdict %+v expected backend to reach frontend", verdict)
+	}
+
+	verdict = kubepox.Verdict{}
+	get(t, ts.URL+"/v1/connectivity?from=default/frontend&to=default/frontend&port=80", &verdict)
+	if verdict.Allowed {
+		t.Errorf("Got verdict %+v expected frontend not to reach frontend", verdict)
+	}
+
+	matrix := kubepox.ConnectivityMatrix{}
+	if status := get(t, ts.URL+"/v1/connectivity/matrix?port=80&namespace=default", &matrix); status != http.StatusOK {
+		t.Fatalf("Got status %d on matrix query", status)
+	}
+	if len(matrix.Pods) != 2 {
+		t.Errorf("Got matrix %+v expected 2 pods", matrix)
+	}
+}
+
+// rolloutPod returns a pod of a ReplicaSet of the web Deployment.
+func rolloutPod(name, replicaSet string, labels map[string]string) *api.Pod {
+	controller := true
+	return &api.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       "default",
+			Labels:          labels,
+			OwnerReferences: []metav1.OwnerReference{{Kind: cluster.KindReplicaSet, Name: replicaSet, Controller: &controller}},
+		},
+		Status: api.PodStatus{Phase: api.PodRunning, PodIP: "10.0.0.1"},
+	}
+}
+
+// rolloutReplicaSet returns a ReplicaSet of the web Deployment at the given revision.
+func rolloutReplicaSet(name, revision string) *apps.ReplicaSet {
+	controller := true
+	return &apps.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       "default",
+			Annotations:     map[string]string{"deployment.kubernetes.io/revision": revision},
+			OwnerReferences: []metav1.OwnerReference{{Kind: cluster.KindDeployment, Name: "web", Controller: &controller}},
+		},
+	}
+}
+
+func TestServerWorkloads(t *testing.T) {
+	// The web Deployment is rolling out from role=legacy to role=frontend: the new revision is evaluated,
+	// whatever the order of the pods.
+	client := fake.NewSimpleClientset(backend, allowfrombackend,
+		rolloutReplicaSet("web-2", "2"), rolloutReplicaSet("web-1", "1"),
+		rolloutPod("web-1-a", "web-1", map[string]string{"role": "legacy"}),
+		rolloutPod("web-2-a", "web-2", map[string]string{"role": "frontend"}),
+		rolloutPod("web-1-b", "web-1", map[string]string{"role": "legacy"}),
+	)
+	state, err := cluster.Load(context.Background(), client, "")
+	if err != nil {
+		t.Fatalf("Error loading the state: %s", err)
+	}
+	ts := httptest.NewServer(New(cluster.NewStaticSource(state)))
+	defer ts.Close()
+
+	policies := networking.NetworkPolicyList{}
+	if status := get(t, ts.URL+"/v1/namespaces/default/deployments/web/policies", &policies); status != http.StatusOK {
+		t.Fatalf("Got status %d on policies query", status)
+	}
+	if len(policies.Items) != 1 || policies.Items[0].Name != "allowfrombackend" {
+		t.Errorf("Got policies %+v expected allowfrombackend", policies.Items)
+	}
+
+	rules := Rules{}
+	if status := get(t, ts.URL+"/v1/namespaces/default/rs/web-1/rules", &rules); status != http.StatusOK {
+		t.Fatalf("Got status %d on rules query", status)
+	}
+	if rules.Ingress != nil {
+		t.Errorf("Got rules %+v expected the old revision not to be isolated", rules)
+	}
+
+	verdict := kubepox.Verdict{}
+	if status := get(t, ts.URL+"/v1/connectivity?from=default/web-1-a&to=default/deploy/web&port=80", &verdict); status != http.StatusOK {
+		t.Fatalf("Got status %d on connectivity query", status)
+	}
+	if verdict.Allowed {
+		t.Errorf("Got verdict %+v expected the new revision of web to deny web-1-a", verdict)
+	}
+
+	tests := map[string]int{
+		"/v1/namespaces/default/deployments/unknown/policies":          http.StatusNotFound,
+		"/v1/namespaces/default/widgets/web/policies":                  http.StatusNotFound,
+		"/v1/connectivity?from=default/widget/web&to=default/backend":  http.StatusBadRequest,
+		"/v1/connectivity?from=default/deploy/nope&to=default/backend": http.StatusNotFound,
+	}
+	for path, expected := range tests {
+		result := Error{}
+		if status := get(t, ts.URL+path, &result); status != expected {
+			t.Errorf("Got status %d on %s expected %d", status, path, expected)
+		}
+	}
+}
+
+func TestServerErrors(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	tests := map[string]int{
+		"/v1/namespaces/default/pods/unknown/policies":                        http.StatusNotFound,
+		"/v1/namespaces/default/policies/unknown/pods":                        http.StatusNotFound,
+		"/v1/namespaces/default/pods/frontend":                                http.StatusNotFound,
+		"/v1/connectivity?from=backend&to=default/frontend":                   http.StatusBadRequest,
+		"/v1/connectivity?from=default/backend&to=default/frontend&port=http": http.StatusBadRequest,
+		"/v1/connectivity/matrix?port=80&protocol=icmp":                       http.StatusBadRequest,
+	}
+
+	for path, expected := range tests {
+		result := Error{}
+		if status := get(t, ts.URL+path, &result); status != expected {
+			t.Errorf("Got status %d on %s expected %d", status, path, expected)
+		}
+		if result.Error == "" {
+			t.Errorf("Got no error message on %s", path)
+		}
+	}
+}
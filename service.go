@@ -0,0 +1,194 @@
+package kubepox
+
+import (
+	"fmt"
+	"net"
+
+	api "k8s.io/api/core/v1"
+	discovery "k8s.io/api/discovery/v1beta1"
+	networking "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// Backend is an endpoint serving a port of a Service, and the port it serves it on.
+type Backend struct {
+	Endpoint *Endpoint
+	Port     int32
+	Protocol api.Protocol
+}
+
+// BackendVerdict is the verdict of a connection to a backend of a Service.
+type BackendVerdict struct {
+	Backend string   `json:"backend"`
+	Port    int32    `json:"port"`
+	Verdict *Verdict `json:"verdict"`
+}
+
+// ServiceVerdict is the result of the evaluation of a connection to a Service against a set of policies.
+type ServiceVerdict struct {
+	// Allowed is true if the connection is allowed to every backend of the Service.
+	Allowed bool `json:"allowed"`
+	// Reachable is true if the connection is allowed to at least one backend of the Service.
+	Reachable bool             `json:"reachable"`
+	Backends  []BackendVerdict `json:"backends"`
+}
+
+// FindServicePort returns the port of the Service with the given number and protocol, nil if it doesn't exist.
+// An empty protocol is considered as TCP.
+func FindServicePort(svc *api.Service, port int32, protocol api.Protocol) *api.ServicePort {
+	for i := range svc.Spec.Ports {
+		servicePort := &svc.Spec.Ports[i]
+		if servicePort.Port == port && defaultProtocol(servicePort.Protocol) == defaultProtocol(protocol) {
+			return servicePort
+		}
+	}
+	return nil
+}
+
+// ResolveTargetPort returns the port of the pod serving the port of a Service: the targetPort, resolved against
+// the containers of the pod if it is named, or the port of the Service itself if the targetPort is not set.
+func ResolveTargetPort(servicePort *api.ServicePort, pod *api.Pod) (int32, bool) {
+	switch {
+	case servicePort.TargetPort.Type == intstr.String && servicePort.TargetPort.StrVal != "":
+		return ResolveNamedPort(pod, servicePort.TargetPort.StrVal, defaultProtocol(servicePort.Protocol))
+	case servicePort.TargetPort.IntVal != 0:
+		return servicePort.TargetPort.IntVal, true
+	default:
+		return servicePort.Port, true
+	}
+}
+
+// ListServiceBackends returns the backends serving the port of a Service.
+// The EndpointSlices of the Service are used if there are any, as they also cover Services without selector:
+// their ready addresses are resolved to the pods owning them. Otherwise the backends are the pods of the
+// namespace of the Service selected by its selector, pods without the named targetPort being skipped.
+func ListServiceBackends(svc *api.Service, servicePort *api.ServicePort, allPods *api.PodList, slices []discovery.EndpointSlice) ([]Backend, error) {
+	protocol := defaultProtocol(servicePort.Protocol)
+	backends := []Backend{}
+
+	found := false
+	for _, slice := range slices {
+		if slice.Namespace != svc.Namespace || slice.Labels[discovery.LabelServiceName] != svc.Name {
+			continue
+		}
+		found = true
+
+		port, ok := endpointSlicePort(&slice, servicePort.Name, protocol)
+		if !ok {
+			continue
+		}
+		for _, endpoint := range slice.Endpoints {
+			if endpoint.Conditions.Ready != nil && !*endpoint.Conditions.Ready {
+				continue
+			}
+			for _, address := range endpoint.Addresses {
+				ip := net.ParseIP(address)
+				if ip == nil {
+					continue
+				}
+				backend := Backend{Endpoint: IPEndpoint(ip), Port: port, Protocol: protocol}
+				if pod := podOfEndpoint(&endpoint, address, slice.Namespace, allPods); pod != nil {
+					backend.Endpoint = &Endpoint{Pod: pod, IP: ip}
+				}
+				backends = append(backends, backend)
+			}
+		}
+	}
+	if found || len(svc.Spec.Selector) == 0 {
+		return backends, nil
+	}
+
+	selector := labels.SelectorFromSet(svc.Spec.Selector)
+	for i := range allPods.Items {
+		pod := &allPods.Items[i]
+		if pod.Namespace != svc.Namespace || !selector.Matches(labels.Set(pod.Labels)) {
+			continue
+		}
+		port, ok := ResolveTargetPort(servicePort, pod)
+		if !ok {
+			continue
+		}
+		backends = append(backends, Backend{Endpoint: PodEndpoint(pod), Port: port, Protocol: protocol})
+	}
+	return backends, nil
+}
+
+// EvaluateServiceTraffic evaluates a connection from src to the port of a Service, against every backend serving it.
+// An empty protocol is considered as TCP.
+func EvaluateServiceTraffic(src *Endpoint, svc *api.Service, port int32, protocol api.Protocol, allPods *api.PodList, slices []discovery.EndpointSlice, namespaces *api.NamespaceList, allPolicies *networking.NetworkPolicyList) (*ServiceVerdict, error) {
+	servicePort := FindServicePort(svc, port, protocol)
+	if servicePort == nil {
+		return nil, fmt.Errorf("service %s/%s has no port %s/%d", svc.Namespace, svc.Name, defaultProtocol(protocol), port)
+	}
+
+	backends, err := ListServiceBackends(svc, servicePort, allPods, slices)
+	if err != nil {
+		return nil, err
+	}
+
+	verdict := &ServiceVerdict{
+		Allowed:  len(backends) > 0,
+		Backends: []BackendVerdict{},
+	}
+	for _, backend := range backends {
+		backendVerdict, err := EvaluateTraffic(src, backend.Endpoint, backend.Port, backend.Protocol, namespaces, allPolicies)
+		if err != nil {
+			return nil, err
+		}
+		verdict.Allowed = verdict.Allowed && backendVerdict.Allowed
+		verdict.Reachable = verdict.Reachable || backendVerdict.Allowed
+		verdict.Backends = append(verdict.Backends, BackendVerdict{
+			Backend: backend.Endpoint.String(),
+			Port:    backend.Port,
+			Verdict: backendVerdict,
+		})
+	}
+	return verdict, nil
+}
+
+// endpointSlicePort returns the port of the EndpointSlice with the given name and protocol.
+func endpointSlicePort(slice *discovery.EndpointSlice, name string, protocol api.Protocol) (int32, bool) {
+	for _, port := range slice.Ports {
+		portName := ""
+		if port.Name != nil {
+			portName = *port.Name
+		}
+		portProtocol := api.ProtocolTCP
+		if port.Protocol != nil {
+			portProtocol = *port.Protocol
+		}
+		if portName == name && portProtocol == protocol && port.Port != nil {
+			return *port.Port, true
+		}
+	}
+	return 0, false
+}
+
+// podOfEndpoint returns the pod referenced by an endpoint of an EndpointSlice, or owning its address.
+func podOfEndpoint(endpoint *discovery.Endpoint, address, namespace string, allPods *api.PodList) *api.Pod {
+	for i := range allPods.Items {
+		pod := &allPods.Items[i]
+		if ref := endpoint.TargetRef; ref != nil && ref.Kind == "Pod" {
+			refNamespace := ref.Namespace
+			if refNamespace == "" {
+				refNamespace = namespace
+			}
+			if pod.Namespace == refNamespace && pod.Name == ref.Name {
+				return pod
+			}
+			continue
+		}
+		if pod.Status.PodIP == address && !pod.Spec.HostNetwork {
+			return pod
+		}
+	}
+	return nil
+}
+
+func defaultProtocol(protocol api.Protocol) api.Protocol {
+	if protocol == "" {
+		return api.ProtocolTCP
+	}
+	return protocol
+}
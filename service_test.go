@@ -0,0 +1,186 @@
+package kubepox
+
+import (
+	"testing"
+
+	api "k8s.io/api/core/v1"
+	discovery "k8s.io/api/discovery/v1beta1"
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// svcfrontend exposes the http named port of the role=frontend pods on port 443
+var svcfrontend = api.Service{
+	ObjectMeta: metav1.ObjectMeta{
+		Name: "frontend",
+	},
+	Spec: api.ServiceSpec{
+		Selector: map[string]string{
+			"role": "frontend",
+		},
+		Ports: []api.ServicePort{
+			api.ServicePort{
+				Name:       "https",
+				Port:       443,
+				TargetPort: intstr.FromString("http"),
+			},
+		},
+	},
+}
+
+// svcexternal is a service without selector, backed by an EndpointSlice
+var svcexternal = api.Service{
+	ObjectMeta: metav1.ObjectMeta{
+		Name: "external",
+	},
+	Spec: api.ServiceSpec{
+		Ports: []api.ServicePort{
+			api.ServicePort{
+				Port: 80,
+			},
+		},
+	},
+}
+
+var notReady = false
+
+var port9000 = int32(9000)
+
+var portName = ""
+
+// sliceexternal holds a ready address and a not ready one on port 9000
+var sliceexternal = discovery.EndpointSlice{
+	ObjectMeta: metav1.ObjectMeta{
+		Name: "external-abcde",
+		Labels: map[string]string{
+			discovery.LabelServiceName: "external",
+		},
+	},
+	AddressType: discovery.AddressTypeIPv4,
+	Endpoints: []discovery.Endpoint{
+		discovery.Endpoint{
+			Addresses: []string{"10.2.0.1"},
+		},
+		discovery.Endpoint{
+			Addresses:  []string{"10.2.0.2"},
+			Conditions: discovery.EndpointConditions{Ready: &notReady},
+		},
+	},
+	Ports: []discovery.EndpointPort{
+		discovery.EndpointPort{
+			Name:     &portName,
+			Protocol: &protocolTCP,
+			Port:     &port9000,
+		},
+	},
+}
+
+func TestEvaluateServiceTraffic(t *testing.T) {
+	type testStruct struct {
+		Policies  networking.NetworkPolicyList
+		Pods      api.PodList
+		Slices    []discovery.EndpointSlice
+		Service   api.Service
+		Src       *Endpoint
+		Port      int32
+		Backends  []string
+		Ports     []int32
+		Allowed   bool
+		Reachable bool
+		Error     bool
+	}
+
+	tests := []testStruct{
+		testStruct{
+			Policies:  buildNetworkPolicyList(npnamedport),
+			Pods:      buildPodList(pod1withport, pod2),
+			Service:   svcfrontend,
+			Src:       PodEndpoint(&pod2),
+			Port:      443,
+			Backends:  []string{"/pod1"},
+			Ports:     []int32{8080},
+			Allowed:   true,
+			Reachable: true,
+		},
+		testStruct{
+			Policies:  buildNetworkPolicyList(npnamedport),
+			Pods:      buildPodList(pod1withport, pod2),
+			Service:   svcfrontend,
+			Src:       PodEndpoint(&pod2namespacex),
+			Port:      443,
+			Backends:  []string{"/pod1"},
+			Ports:     []int32{8080},
+			Allowed:   false,
+			Reachable: false,
+		},
+		testStruct{
+			Policies: buildNetworkPolicyList(),
+			Pods:     buildPodList(pod1, pod2),
+			Service:  svcfrontend,
+			Src:      PodEndpoint(&pod2),
+			Port:     443,
+			Backends: []string{},
+			Ports:    []int32{},
+		},
+		testStruct{
+			Policies: buildNetworkPolicyList(),
+			Pods:     buildPodList(pod1withport),
+			Service:  svcfrontend,
+			Src:      PodEndpoint(&pod2),
+			Port:     80,
+			Error:    true,
+		},
+		testStruct{
+			Policies:  buildNetworkPolicyList(defaultdenyegress),
+			Pods:      buildPodList(pod2),
+			Slices:    []discovery.EndpointSlice{sliceexternal},
+			Service:   svcexternal,
+			Src:       PodEndpoint(&pod2namespacex),
+			Port:      80,
+			Backends:  []string{"10.2.0.1"},
+			Ports:     []int32{9000},
+			Allowed:   true,
+			Reachable: true,
+		},
+		testStruct{
+			Policies:  buildNetworkPolicyList(defaultdenyegress),
+			Pods:      buildPodList(pod2),
+			Slices:    []discovery.EndpointSlice{sliceexternal},
+			Service:   svcexternal,
+			Src:       PodEndpoint(&pod2),
+			Port:      80,
+			Backends:  []string{"10.2.0.1"},
+			Ports:     []int32{9000},
+			Allowed:   false,
+			Reachable: false,
+		},
+	}
+
+	for i, test := range tests {
+		t.Log("Testing EvaluateServiceTraffic ", i)
+		verdict, err := EvaluateServiceTraffic(test.Src, &test.Service, test.Port, api.ProtocolTCP, &test.Pods, test.Slices, &namespaces, &test.Policies)
+		if test.Error {
+			if err == nil {
+				t.Errorf("Expected an error for test %d", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Error on EvaluateServiceTraffic for test %d : %s", i, err)
+			continue
+		}
+		if verdict.Allowed != test.Allowed || verdict.Reachable != test.Reachable {
+			t.Errorf("Verdict error. Test %d Got %t/%t expected %t/%t (%+v)", i, verdict.Allowed, verdict.Reachable, test.Allowed, test.Reachable, verdict)
+		}
+		if len(verdict.Backends) != len(test.Backends) {
+			t.Errorf("Backends error. Test %d Got %+v expected %v", i, verdict.Backends, test.Backends)
+			continue
+		}
+		for j, backend := range verdict.Backends {
+			if backend.Backend != test.Backends[j] || backend.Port != test.Ports[j] {
+				t.Errorf("Backend error. Test %d Got %s:%d expected %s:%d", i, backend.Backend, backend.Port, test.Backends[j], test.Ports[j])
+			}
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package kubepox
+
+import (
+	api "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+)
+
+// PodFromTemplate synthesizes the pod that a PodTemplateSpec creates in the namespace, so that policies can be
+// evaluated for a workload before any of its pods runs. The pod has the labels and containers of the template,
+// and no IP.
+func PodFromTemplate(template *api.PodTemplateSpec, namespace string) *api.Pod {
+	pod := &api.Pod{
+		ObjectMeta: *template.ObjectMeta.DeepCopy(),
+		Spec:       *template.Spec.DeepCopy(),
+		Status: api.PodStatus{
+			Phase: api.PodPending,
+		},
+	}
+	pod.Namespace = namespace
+	return pod
+}
+
+// TemplateEndpoint returns the Endpoint of the pods created by a PodTemplateSpec in the namespace.
+func TemplateEndpoint(template *api.PodTemplateSpec, namespace string) *Endpoint {
+	return PodEndpoint(PodFromTemplate(template, namespace))
+}
+
+// ListPoliciesPerTemplate returns all the NetworkPolicies that are associated with the pods created by a PodTemplateSpec in the namespace.
+func ListPoliciesPerTemplate(template *api.PodTemplateSpec, namespace string, allPolicies *networking.NetworkPolicyList) (*networking.NetworkPolicyList, error) {
+	return ListPoliciesPerPod(PodFromTemplate(template, namespace), allPolicies)
+}
+
+// ListIngressRulesPerTemplate Generate a set of IngressRules that apply to the pods created by a PodTemplateSpec in the namespace.
+// returns nil if the policies in parameters are not applicable to Ingress
+func ListIngressRulesPerTemplate(template *api.PodTemplateSpec, namespace string, allPolicies *networking.NetworkPolicyList) (*[]networking.NetworkPolicyIngressRule, error) {
+	return ListIngressRulesPerPod(PodFromTemplate(template, namespace), allPolicies)
+}
+
+// ListEgressRulesPerTemplate Generate a set of EgressRules that apply to the pods created by a PodTemplateSpec in the namespace.
+// returns nil if the policies in parameters are not applicable to Egress
+func ListEgressRulesPerTemplate(template *api.PodTemplateSpec, namespace string, allPolicies *networking.NetworkPolicyList) (*[]networking.NetworkPolicyEgressRule, error) {
+	return ListEgressRulesPerPod(PodFromTemplate(template, namespace), allPolicies)
+}
+
+// IsTemplateSelected returns true for Ingress and/or Egress if the pods created by a PodTemplateSpec in the namespace
+// are selected by at least one of the policies.
+func IsTemplateSelected(template *api.PodTemplateSpec, namespace string, policies *networking.NetworkPolicyList) (bool, bool, error) {
+	return IsPodSelected(PodFromTemplate(template, namespace), policies)
+}
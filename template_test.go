@@ -0,0 +1,87 @@
+package kubepox
+
+import (
+	"testing"
+
+	api "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// template1 is the pod template of a workload with role=frontend
+var template1 = api.PodTemplateSpec{
+	ObjectMeta: metav1.ObjectMeta{
+		Labels: pod1.Labels,
+	},
+	Spec: api.PodSpec{
+		Containers: []api.Container{
+			api.Container{
+				Name: "nginx",
+			},
+		},
+	},
+}
+
+func TestPodFromTemplate(t *testing.T) {
+	pod := PodFromTemplate(&template1, "x")
+	if pod.Namespace != "x" || pod.Labels["role"] != "frontend" || len(pod.Spec.Containers) != 1 {
+		t.Errorf("Got pod %+v expected the labels and containers of the template in namespace x", pod)
+	}
+	if ClassifyPod(pod) != PodWithoutIP {
+		t.Errorf("Got class %s for a pod synthesized from a template expected %s", ClassifyPod(pod), PodWithoutIP)
+	}
+	pod.Labels["role"] = "backend"
+	if template1.Labels["role"] != "frontend" {
+		t.Errorf("Modifying the synthesized pod modified the template")
+	}
+}
+
+func TestListPoliciesPerTemplate(t *testing.T) {
+	type testStruct struct {
+		Namespace      string
+		Policies       networking.NetworkPolicyList
+		ExpectedResult []string
+	}
+
+	tests := []testStruct{
+		testStruct{
+			Namespace:      "",
+			Policies:       buildNetworkPolicyList(np1, np2),
+			ExpectedResult: []string{"np1", "np2"},
+		},
+		testStruct{
+			Namespace:      "x",
+			Policies:       buildNetworkPolicyList(np1, np1namespacex),
+			ExpectedResult: []string{"np1"},
+		},
+		testStruct{
+			Namespace:      "",
+			Policies:       buildNetworkPolicyList(np1namespacex),
+			ExpectedResult: []string{},
+		},
+	}
+
+	for i, test := range tests {
+		t.Log("Testing ListPoliciesPerTemplate ", i)
+		policies, err := ListPoliciesPerTemplate(&template1, test.Namespace, &test.Policies)
+		if err != nil {
+			t.Errorf("Error listing policies: %s", err)
+			continue
+		}
+		if len(policies.Items) != len(test.ExpectedResult) {
+			t.Errorf("Got %d policies expected %v", len(policies.Items), test.ExpectedResult)
+			continue
+		}
+		for j, policy := range policies.Items {
+			if policy.Name != test.ExpectedResult[j] || policy.Namespace != test.Namespace {
+				t.Errorf("Got policy %s/%s expected %s/%s", policy.Namespace, policy.Name, test.Namespace, test.ExpectedResult[j])
+			}
+		}
+	}
+
+	policies := buildNetworkPolicyList(np1)
+	ingress, egress, err := IsTemplateSelected(&template1, "", &policies)
+	if err != nil || !ingress || egress {
+		t.Errorf("Got ingress %t egress %t error %v expected the template selected for ingress only", ingress, egress, err)
+	}
+}
@@ -0,0 +1,253 @@
+// Package webhook implements a validating admission webhook for NetworkPolicies.
+//
+// Every created, updated or deleted NetworkPolicy is checked with the lint rules and
+// against a set of protected flows that must stay allowed. Findings with the error severity
+// and cut off protected flows reject the request, other findings are returned as warnings.
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/aporeto-inc/kubepox"
+	"github.com/aporeto-inc/kubepox/cluster"
+	"github.com/aporeto-inc/kubepox/lint"
+
+	admission "k8s.io/api/admission/v1"
+	api "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Config is the configuration of the webhook.
+type Config struct {
+	// ProtectedFlows are the connections that a policy change must not cut off.
+	ProtectedFlows []Flow `json:"protectedFlows,omitempty"`
+	// Reject lists the lint rules whose findings reject the request even if they are warnings.
+	Reject []string `json:"reject,omitempty"`
+}
+
+// Flow is a connection between two sets of pods.
+type Flow struct {
+	Name     string       `json:"name,omitempty"`
+	From     Peer         `json:"from"`
+	To       Peer         `json:"to"`
+	Port     int32        `json:"port"`
+	Protocol api.Protocol `json:"protocol,omitempty"`
+}
+
+// Peer selects the pods of a namespace.
+type Peer struct {
+	Namespace string `json:"namespace"`
+	// Selector is a label selector using the kubectl syntax (e.g. app=web,tier!=db). Empty selects all the pods.
+	Selector string `json:"selector,omitempty"`
+}
+
+// Webhook reviews the NetworkPolicy admission requests against the State provided by a Source.
+type Webhook struct {
+	source cluster.Source
+	config Config
+}
+
+// New returns a Webhook evaluating the requests against the State of the source.
+func New(source cluster.Source, config Config) *Webhook {
+	return &Webhook{
+		source: source,
+		config: config,
+	}
+}
+
+// ServeHTTP implements http.Handler. It answers an AdmissionReview with an AdmissionReview.
+func (w *Webhook) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(rw, fmt.Sprintf("method %s not allowed", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(rw, fmt.Sprintf("couldn't read request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	review := admission.AdmissionReview{}
+	if err := json.Unmarshal(body, &review); err != nil {
+		http.Error(rw, fmt.Sprintf("couldn't decode AdmissionReview: %v", err), http.StatusBadRequest)
+		return
+	}
+	if review.Request == nil {
+		http.Error(rw, "AdmissionReview has no request", http.StatusBadRequest)
+		return
+	}
+
+	review.Response = w.Review(review.Request)
+	review.Request = nil
+
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(&review)
+}
+
+// Review evaluates an admission request.
+func (w *Webhook) Review(request *admission.AdmissionRequest) *admission.AdmissionResponse {
+	response := &admission.AdmissionResponse{
+		UID:     request.UID,
+		Allowed: true,
+	}
+
+	if request.Resource.Group != networking.GroupName || request.Resource.Resource != "networkpolicies" {
+		return response
+	}
+
+	reject := func(format string, args ...interface{}) *admission.AdmissionResponse {
+		response.Allowed = false
+		response.Result = &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Message: fmt.Sprintf(format, args...),
+			Reason:  metav1.StatusReasonInvalid,
+			Code:    http.StatusUnprocessableEntity,
+		}
+		return response
+	}
+
+	raw := request.Object.Raw
+	if request.Operation == admission.Delete {
+		raw = request.OldObject.Raw
+	}
+	policy := &networking.NetworkPolicy{}
+	if err := json.Unmarshal(raw, policy); err != nil {
+		return reject("couldn't decode NetworkPolicy: %v", err)
+	}
+	if policy.Namespace == "" {
+		policy.Namespace = request.Namespace
+	}
+	if policy.Name == "" {
+		policy.Name = request.Name
+	}
+
+	before, err := w.source.State()
+	if err != nil {
+		return reject("couldn't get cluster state: %v", err)
+	}
+	after := withPolicy(before, policy, request.Operation == admission.Delete)
+
+	problems := []string{}
+
+	if request.Operation != admission.Delete {
+		for _, finding := range lint.Lint(policy, after, nil) {
+			message := fmt.Sprintf("%s: %s", finding.Rule, finding.Message)
+			if finding.Severity == lint.SeverityError || w.rejects(finding.Rule) {
+				problems = append(problems, message)
+				continue
+			}
+			response.Warnings = append(response.Warnings, message)
+		}
+	}
+
+	// Flows can't be evaluated on an invalid policy.
+	if len(problems) > 0 {
+		return reject("NetworkPolicy %s/%s rejected: %s", policy.Namespace, policy.Name, strings.Join(problems, "; "))
+	}
+
+	cutOff, err := w.cutOffFlows(before, after)
+	if err != nil {
+		return reject("couldn't evaluate protected flows: %v", err)
+	}
+	problems = append(problems, cutOff...)
+
+	if len(problems) > 0 {
+		return reject("NetworkPolicy %s/%s rejected: %s", policy.Namespace, policy.Name, strings.Join(problems, "; "))
+	}
+	return response
+}
+
+func (w *Webhook) rejects(rule string) bool {
+	for _, r := range w.config.Reject {
+		if r == rule {
+			return true
+		}
+	}
+	return false
+}
+
+// withPolicy returns a copy of the state where the policy is created, updated or deleted.
+func withPolicy(state *cluster.State, policy *networking.NetworkPolicy, deleted bool) *cluster.State {
+	after := *state
+	after.Policies = networking.NetworkPolicyList{
+		Items: []networking.NetworkPolicy{},
+	}
+	for _, existing := range state.Policies.Items {
+		if existing.Namespace == policy.Namespace && existing.Name == policy.Name {
+			continue
+		}
+		after.Policies.Items = append(after.Policies.Items, existing)
+	}
+	if !deleted {
+		after.Policies.Items = append(after.Policies.Items, *policy)
+	}
+	return &after
+}
+
+// cutOffFlows returns a message for every protected flow allowed before the change and denied after.
+func (w *Webhook) cutOffFlows(before, after *cluster.State) ([]string, error) {
+	messages := []string{}
+
+	for _, flow := range w.config.ProtectedFlows {
+		sources, err := selectPods(before, flow.From)
+		if err != nil {
+			return nil, err
+		}
+		destinations, err := selectPods(before, flow.To)
+		if err != nil {
+			return nil, err
+		}
+
+	Pairs:
+		for _, src := range sources {
+			for _, dst := range destinations {
+				wasAllowed, err := kubepox.IsTrafficAllowed(src, dst, flow.Port, flow.Protocol, &before.Namespaces, &before.Policies)
+				if err != nil {
+					return nil, err
+				}
+				isAllowed, err := kubepox.IsTrafficAllowed(src, dst, flow.Port, flow.Protocol, &after.Namespaces, &after.Policies)
+				if err != nil {
+					return nil, err
+				}
+				if wasAllowed && !isAllowed {
+					name := flow.Name
+					if name == "" {
+						name = fmt.Sprintf("%s -> %s:%d", flow.From, flow.To, flow.Port)
+					}
+					messages = append(messages, fmt.Sprintf("protected flow %s would be cut off (%s/%s -> %s/%s)", name, src.Namespace, src.Name, dst.Namespace, dst.Name))
+					break Pairs
+				}
+			}
+		}
+	}
+
+	return messages, nil
+}
+
+// String returns namespace[selector].
+func (p Peer) String() string {
+	return fmt.Sprintf("%s[%s]", p.Namespace, p.Selector)
+}
+
+// selectPods returns the pods of the state selected by the peer.
+func selectPods(state *cluster.State, peer Peer) ([]*api.Pod, error) {
+	selector, err := labels.Parse(peer.Selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid selector %q: %v", peer.Selector, err)
+	}
+	pods := []*api.Pod{}
+	for i := range state.Pods.Items {
+		pod := &state.Pods.Items[i]
+		if pod.Namespace == peer.Namespace && selector.Matches(labels.Set(pod.Labels)) {
+			pods = append(pods, pod)
+		}
+	}
+	return pods, nil
+}
@@ -0,0 +1,120 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aporeto-inc/kubepox/cluster"
+
+	admission "k8s.io/api/admission/v1"
+)
+
+var config = Config{
+	ProtectedFlows: []Flow{
+		Flow{
+			Name: "frontend-to-db",
+			From: Peer{Namespace: "web", Selector: "role=frontend"},
+			To:   Peer{Namespace: "web", Selector: "role=db"},
+			Port: 5432,
+		},
+		Flow{
+			Name: "db-to-frontend",
+			From: Peer{Namespace: "web", Selector: "role=db"},
+			To:   Peer{Namespace: "web", Selector: "role=frontend"},
+			Port: 80,
+		},
+	},
+}
+
+func review(t *testing.T, handler http.Handler, file string) *admission.AdmissionResponse {
+	body, err := ioutil.ReadFile(filepath.Join("testdata", file))
+	if err != nil {
+		t.Fatalf("Error reading %s: %s", file, err)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/validate", bytes.NewReader(body)))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Got status %d for %s: %s", recorder.Code, file, recorder.Body.String())
+	}
+
+	result := admission.AdmissionReview{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Error decoding response for %s: %s", file, err)
+	}
+	if result.Response == nil {
+		t.Fatalf("No response for %s", file)
+	}
+	return result.Response
+}
+
+func TestWebhook(t *testing.T) {
+	state, err := cluster.LoadManifests(filepath.Join("testdata", "state.yaml"))
+	if err != nil {
+		t.Fatalf("Error loading state: %s", err)
+	}
+	handler := New(cluster.NewStaticSource(state), config)
+
+	type testStruct struct {
+		File     string
+		Allowed  bool
+		Message  string
+		Warnings int
+	}
+
+	tests := []testStruct{
+		testStruct{
+			File:    "invalid-selector.json",
+			Allowed: false,
+			Message: "invalid-selector",
+		},
+		testStruct{
+			File:    "deny-all.json",
+			Allowed: false,
+			Message: "protected flow db-to-frontend",
+		},
+		testStruct{
+			File:     "allow-all-namespaces.json",
+			Allowed:  true,
+			Warnings: 1,
+		},
+		testStruct{
+			File:    "delete-allow.json",
+			Allowed: false,
+			Message: "protected flow frontend-to-db",
+		},
+	}
+
+	for i, test := range tests {
+		t.Log("Testing Webhook ", i)
+		response := review(t, handler, test.File)
+		if response.Allowed != test.Allowed {
+			t.Errorf("Test %d Got allowed %t expected %t (%+v)", i, response.Allowed, test.Allowed, response.Result)
+		}
+		if test.Message != "" && (response.Result == nil || !strings.Contains(response.Result.Message, test.Message)) {
+			t.Errorf("Test %d Got result %+v expected message containing %s", i, response.Result, test.Message)
+		}
+		if len(response.Warnings) != test.Warnings {
+			t.Errorf("Test %d Got warnings %v expected %d", i, response.Warnings, test.Warnings)
+		}
+	}
+}
+
+func TestWebhookReject(t *testing.T) {
+	state, err := cluster.LoadManifests(filepath.Join("testdata", "state.yaml"))
+	if err != nil {
+		t.Fatalf("Error loading state: %s", err)
+	}
+	handler := New(cluster.NewStaticSource(state), Config{Reject: []string{"allow-all-namespaces"}})
+
+	response := review(t, handler, "allow-all-namespaces.json")
+	if response.Allowed {
+		t.Errorf("Got allowed expected rejection by the allow-all-namespaces rule")
+	}
+}